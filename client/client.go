@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	sysnet "net"
+	sysSync "sync"
 	"sync/atomic"
 
 	"github.com/buraksezer/consistent"
@@ -16,6 +18,7 @@ import (
 	"github.com/sionreview/sion/common/net"
 	"github.com/sionreview/sion/common/redeo/client"
 	"github.com/sionreview/sion/common/sync"
+	protocol "github.com/sionreview/sion/common/types"
 	"github.com/sionreview/sion/common/util"
 )
 
@@ -51,53 +54,160 @@ type Client struct {
 	ParityShards int
 	Shards       int
 
-	conns map[string][]*client.Conn
+	conns   map[string][]*client.Conn
+	connsMu sysSync.RWMutex
+	// Proxies serving keys, owned if not shared with other clients.
+	members    *Membership
+	ownMembers bool
+	unwatch    func() // Unregisters the handler closing connections to proxies removed from the membership.
+	// Default scheme and schemes of storage classes indexed by name.
+	scheme    *ecScheme
+	classes   map[string]*ecScheme
+	maxShards int // Max shards among all schemes, which is also the number of connections per proxy.
+	// Codec to compress objects before erasure coding, nil if disabled.
+	codec Codec
+	// Codec to encrypt objects after compression, nil if disabled.
+	encryptor *envelopeCodec
 	// mappingTable map[string]*cuckoo.Filter
-	logEntry logEntry
 	shortcut *net.ShortcutConn
 	closed   bool
 }
 
 // NewClient Create a client instance.
 func NewClient(dataShards int, parityShards int, ecMaxGoroutine int) *Client {
+	scheme := newEcScheme("", dataShards, parityShards, ecMaxGoroutine)
 	return &Client{
 		conns: make(map[string][]*client.Conn),
-		EC:    NewEncoder(dataShards, parityShards, ecMaxGoroutine),
+		EC:    scheme.EC,
 		// mappingTable: make(map[string]*cuckoo.Filter),
 		DataShards:   dataShards,
 		ParityShards: parityShards,
-		Shards:       dataShards + parityShards,
+		Shards:       scheme.Shards,
+		scheme:       scheme,
+		maxShards:    scheme.Shards,
 	}
 }
 
-// Dial Dial proxies
+// UseStorageClasses Register storage classes that objects can be set with. Must be called before Dial.
+func (c *Client) UseStorageClasses(classes protocol.StorageClasses, ecMaxGoroutine int) {
+	c.classes = make(map[string]*ecScheme, len(classes))
+	for name, class := range classes {
+		c.classes[name] = newEcScheme(name, class.DataShards, class.ParityShards, ecMaxGoroutine)
+		if class.Shards() > c.maxShards {
+			c.maxShards = class.Shards()
+		}
+	}
+}
+
+// UseCodec Compress objects set with the registered codec, e.g. "flate", or empty to disable. Objects are stored as is if
+// not smaller after compression. Objects compressed are decompressed on getting regardless of the codec in use.
+func (c *Client) UseCodec(name string) (err error) {
+	if name == "" {
+		c.codec = nil
+		return nil
+	}
+	c.codec, err = getCodec(name)
+	return
+}
+
+// UseEncryption Encrypt objects set with data keys wrapped by the key provider, or nil to disable. Each object is
+// encrypted by AES-GCM with a data key of its own before erasure coding, so proxies and nodes only see ciphertext.
+// Objects encrypted can only be read by clients that use a key provider able to unwrap the data keys.
+func (c *Client) UseEncryption(provider KeyProvider) {
+	if provider == nil {
+		c.encryptor = nil
+		return
+	}
+	c.encryptor = &envelopeCodec{provider: provider}
+}
+
+// UseMembership Share the membership of proxies with other clients. Must be called before Dial.
+func (c *Client) UseMembership(members *Membership) {
+	c.members = members
+	c.ownMembers = false
+}
+
+// UseHashSlots Locate keys by hash slots of Redis Cluster over the proxies in order, see Membership.UseHashSlots.
+// Must be called before Dial.
+func (c *Client) UseHashSlots(addrs ...string) {
+	if c.members == nil {
+		c.members = NewMembership()
+		c.ownMembers = true
+	}
+	c.members.UseHashSlots(addrs...)
+}
+
+// Membership Get the membership of proxies.
+func (c *Client) Membership() *Membership {
+	return c.members
+}
+
+// Dial Dial proxies. Proxies failed to dial are marked down and retried by the health check.
+// Returns false if no proxy is available.
 func (c *Client) Dial(addrArr []string) bool {
-	//t0 := time.Now()
-	members := make([]consistent.Member, len(addrArr))
-	for i, addr := range addrArr {
+	if c.members == nil {
+		c.members = NewMembership()
+		c.ownMembers = true
+	}
+	c.Ring = c.members.Ring
+	if c.unwatch == nil {
+		c.unwatch = c.members.OnRemove(c.closeProxy)
+	}
+
+	for _, addr := range addrArr {
 		log.Debug("Dialing %s...", addr)
-		newaddr, err := c.initDial(addr)
-		members[i] = clientMember(newaddr)
-		if err != nil {
+		c.members.join(addr)
+		if _, err := c.initDial(addr); err != nil {
 			log.Error("Fail to dial %s: %v", addr, err)
-			c.Close()
-			return false
+			c.members.MarkDown(addr)
 		}
 	}
-	log.Debug("Creating consistent ring %v...", members)
-	c.Ring = consistent.New(members, ECConfig)
-	//time0 := time.Since(t0)
-	//fmt.Println("Dial all goroutines are done!")
-	//if err := nanolog.Log(LogClient, "Dial", time0.String()); err != nil {
-	//	fmt.Println(err)
-	//}
+	if len(c.Ring.GetMembers()) == 0 {
+		c.Close()
+		return false
+	}
 	return true
 }
 
+// AddProxy Dial and add the proxy. Keys will be redistributed.
+func (c *Client) AddProxy(addr string) error {
+	if _, err := c.initDial(addr); err != nil {
+		return err
+	}
+	c.members.Add(addr)
+	return nil
+}
+
+// RemoveProxy Remove the proxy and close connections to it. Keys will be redistributed.
+func (c *Client) RemoveProxy(addr string) {
+	c.members.Remove(addr)
+	c.closeProxy(addr)
+}
+
+// closeProxy closes connections to the proxy. Connections will be recreated if the proxy is added back.
+func (c *Client) closeProxy(addr string) {
+	c.connsMu.Lock()
+	conns := c.conns[addr]
+	delete(c.conns, addr)
+	c.connsMu.Unlock()
+	for _, cn := range conns {
+		if cn != nil {
+			cn.Close()
+		}
+	}
+}
+
+// Locate Get the address of the proxy that serves the key, empty if no proxy is available.
+func (c *Client) Locate(key string) string {
+	addr, _ := c.members.Locate(key)
+	return addr
+}
+
 // Close Close the client
 func (c *Client) Close() {
 	c.closed = true
 	// log.Debug("Cleaning up...")
+	c.connsMu.Lock()
 	for addr, conns := range c.conns {
 		for i, cn := range conns {
 			if cn != nil {
@@ -106,9 +216,41 @@ func (c *Client) Close() {
 			c.conns[addr][i] = nil
 		}
 	}
+	c.connsMu.Unlock()
+	if c.unwatch != nil {
+		c.unwatch()
+		c.unwatch = nil
+	}
+	if c.ownMembers {
+		c.members.Close()
+	}
 	// log.Debug("Client closed.")
 }
 
+// failover marks the proxy down if the request failed to connect the proxy or lost the connection. Returns true if
+// the request should be rerouted.
+func (c *Client) failover(addr string, ret *ecRet) bool {
+	if ret == nil || !isProxyFailed(ret.Err) || c.closed {
+		return false
+	}
+	c.members.MarkDown(addr)
+	return true
+}
+
+// isProxyFailed returns true if the error indicates the proxy is unreachable, either on dialing or on established
+// connections. Timeouts are not counted, which may be caused by slow nodes behind the proxy.
+func isProxyFailed(err error) bool {
+	if err == nil {
+		return false
+	} else if errors.Is(err, ErrProxyUnavailable) || errors.Is(err, client.ErrConnectionClosed) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.ErrClosedPipe) {
+		return true
+	}
+
+	var netErr sysnet.Error
+	return errors.As(err, &netErr) && !netErr.Timeout()
+}
+
 //func (c *Client) initDial(address string, wg *sync.WaitGroup) {
 func (c *Client) initDial(address string) (string, error) {
 	// initialize parallel connections under address
@@ -117,12 +259,14 @@ func (c *Client) initDial(address string) (string, error) {
 		connect = c.connectShortcut
 	}
 	// Connect use original address
-	err := connect(address, c.Shards)
+	err := connect(address, c.maxShards)
 	return address, err
 }
 
 func (c *Client) connect(addr string, n int) error {
+	c.connsMu.Lock()
 	c.conns[addr] = make([]*client.Conn, n)
+	c.connsMu.Unlock()
 	for i := 0; i < n; i++ {
 		_, err := c.validate(addr, i)
 		if err != nil {
@@ -138,7 +282,9 @@ func (c *Client) connectShortcut(addr string, n int) error {
 	if !ok {
 		return ErrDialShortcut
 	}
+	c.connsMu.Lock()
 	c.conns[addr] = make([]*client.Conn, n)
+	c.connsMu.Unlock()
 	for i := 0; i < n; i++ {
 		c.validate(addr, i)
 	}
@@ -146,27 +292,77 @@ func (c *Client) connectShortcut(addr string, n int) error {
 }
 
 func (c *Client) validate(address string, i int) (cn *client.Conn, err error) {
-	if c.conns[address][i] == nil || c.conns[address][i].IsClosed() {
+	c.connsMu.RLock()
+	conns, ok := c.conns[address]
+	if ok {
+		cn = conns[i]
+	}
+	c.connsMu.RUnlock()
+	if cn != nil && !cn.IsClosed() {
+		return
+	}
+
+	// Connections are created exclusively, so requests of concurrent operations share the connection.
+	c.connsMu.Lock()
+	defer c.connsMu.Unlock()
+	if conns, ok = c.conns[address]; !ok {
+		// Proxies added to the membership are connected lazily.
+		conns = make([]*client.Conn, c.maxShards)
+		c.conns[address] = conns
+	}
+
+	if conns[i] == nil || conns[i].IsClosed() {
 		var conn sysnet.Conn
 		// Dial
 		if c.shortcut == nil || c.shortcut.Address != address {
 			conn, err = sysnet.Dial("tcp", address)
+			if err != nil {
+				err = fmt.Errorf("%w: %v", ErrProxyUnavailable, err)
+			}
 		} else {
 			conn = c.shortcut.Validate(i).Conns[i].Client
 		}
 		// Wrap connection
 		if err == nil {
-			c.conns[address][i] = client.NewConn(conn, func(cn *client.Conn) {
+			conns[i] = client.NewConn(conn, func(cn *client.Conn) {
 				cn.Meta = &ClientConnMeta{Addr: address, AddrIdx: i}
-				cn.SetWindowSize(2) // use 2 to form pipeline
+				cn.SetWindowSize(PipelineWindowSize)
 				cn.Handler = c
 			})
 		}
 	}
-	cn = c.conns[address][i]
+	cn = conns[i]
 	return
 }
 
+// getScheme returns the scheme of specified storage class, or the default one if the class is not specified.
+func (c *Client) getScheme(class string) (*ecScheme, error) {
+	if class == "" {
+		return c.scheme, nil
+	} else if scheme, ok := c.classes[class]; ok {
+		return scheme, nil
+	}
+	return nil, protocol.ErrUnknownStorageClass
+}
+
+// matchScheme returns the scheme matches the layout of an object in the format "d-p" or "rN", or nil if no scheme
+// matches. The default scheme is returned if the layout is unknown.
+func (c *Client) matchScheme(layout string) *ecScheme {
+	if layout == "" || layout == c.scheme.String() {
+		return c.scheme
+	} else if layout == c.scheme.Replicas.String() {
+		return c.scheme.Replicas
+	}
+	for _, scheme := range c.classes {
+		if layout == scheme.String() {
+			return scheme
+		} else if layout == scheme.Replicas.String() {
+			return scheme.Replicas
+		}
+	}
+	return nil
+}
+
 type clientMember string
 
 func (m clientMember) String() string {
@@ -175,25 +371,42 @@ func (m clientMember) String() string {
 
 type ecRetMeta struct {
 	Raw      string
+	Shards   string // Layout of the object in the format "d-p", or "rN" if replicated.
+	Codec    string // Stages the object went through in the format "name:size[,name:size]", empty if stored as is.
+	Flags    uint32 // Opaque flags set by the client.
 	Size     int
 	NumFrags int
+	Version  int
+}
+
+type scanResult struct {
+	Cursor  uint64
+	Objects []ObjectInfo
 }
 
 type ecRet struct {
 	sync.WaitGroup
-	reqs  []*ClientRequest
-	numOK int32
+	ctx       context.Context
+	reqs      []*ClientRequest
+	reqMu     sysSync.Mutex
+	numOK     int32
+	firstOK   int32         // Index of the first request responded successfully, -1 if none.
+	first     chan struct{} // Closed on the first request responded successfully.
+	abandoned bool
 
 	Shards int
 	Err    error
-	Meta   ecRetMeta // only for get chunk
+	Meta   ecRetMeta // only for get chunk, except that Version is available for set chunk.
 	Stats  *logEntry
 }
 
-func newEcRet(shards int) *ecRet {
+func newEcRet(ctx context.Context, shards int) *ecRet {
 	return &ecRet{
-		reqs:   make([]*ClientRequest, shards),
-		Shards: shards,
+		ctx:     ctx,
+		reqs:    make([]*ClientRequest, shards),
+		firstOK: -1,
+		first:   make(chan struct{}),
+		Shards:  shards,
 	}
 }
 
@@ -202,8 +415,11 @@ func (r *ecRet) Len() int {
 }
 
 func (r *ecRet) Request(i int) *ClientRequest {
+	r.reqMu.Lock()
+	defer r.reqMu.Unlock()
+
 	if r.reqs[i] == nil {
-		ctx := context.WithValue(context.Background(), CtxKeyECRet, r)
+		ctx := context.WithValue(r.ctx, CtxKeyECRet, r)
 		req := &ClientRequest{Request: client.NewRequestWithContext(ctx)}
 		req.OnRespond(func(rsp interface{}, err error, reason string) {
 			// In case of timeout, we don't know what blocks the connection. Close it to force a new connection to be created next time.
@@ -213,10 +429,17 @@ func (r *ecRet) Request(i int) *ClientRequest {
 
 			// Keep record of the last error
 			if err != nil {
-				r.Err = err
+				r.reqMu.Lock()
+				if !r.abandoned {
+					r.Err = err
+				}
+				r.reqMu.Unlock()
 			} else if rsp != nil {
 				// Only count ok if response is not nil
-				atomic.AddInt32(&r.numOK, 1)
+				if atomic.AddInt32(&r.numOK, 1) == 1 {
+					atomic.StoreInt32(&r.firstOK, int32(i))
+					close(r.first)
+				}
 			}
 			r.Done()
 		})
@@ -225,6 +448,64 @@ func (r *ecRet) Request(i int) *ClientRequest {
 	return r.reqs[i]
 }
 
+// Wait waits for all requests to be responded. If the context is done before that, outstanding requests will be
+// aborted with the error of the context.
+func (r *ecRet) Wait() {
+	if r.ctx.Done() == nil {
+		r.WaitGroup.Wait()
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		r.WaitGroup.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-r.ctx.Done():
+		for i := 0; i < r.Len(); i++ {
+			r.Request(i).SetResponse(r.ctx.Err(), "context done")
+		}
+		<-done
+	}
+}
+
+// WaitFirst waits for the first request to be responded successfully, or all requests to be responded if none succeeds.
+func (r *ecRet) WaitFirst() {
+	done := make(chan struct{})
+	go func() {
+		r.Wait()
+		close(done)
+	}()
+	select {
+	case <-r.first:
+	case <-done:
+	}
+}
+
+// Abandon abandons requests not yet sent. Responses of requests in flight will be discarded, and errors of them will
+// not be recorded. Errors recorded so far are cleared.
+func (r *ecRet) Abandon() {
+	r.reqMu.Lock()
+	defer r.reqMu.Unlock()
+
+	r.abandoned = true
+	r.Err = nil
+}
+
+func (r *ecRet) IsAbandoned() bool {
+	r.reqMu.Lock()
+	defer r.reqMu.Unlock()
+
+	return r.abandoned
+}
+
+// FirstOK returns the index of the first request responded successfully, or -1 if none.
+func (r *ecRet) FirstOK() int {
+	return int(atomic.LoadInt32(&r.firstOK))
+}
+
 func (r *ecRet) RetStore(i int) (ret string) {
 	req := r.reqs[i]
 	if req == nil {
@@ -245,6 +526,18 @@ func (r *ecRet) RetChunk(i int) (ret []byte) {
 	return
 }
 
+func (r *ecRet) RetScan(i int) *scanResult {
+	req := r.reqs[i]
+	if req == nil {
+		return &scanResult{}
+	}
+	val, _ := req.Response()
+	if ret, ok := val.(*scanResult); ok {
+		return ret
+	}
+	return &scanResult{}
+}
+
 func (r *ecRet) Error(i int) (err error) {
 	req := r.reqs[i]
 	if req == nil {
@@ -2,8 +2,10 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"math"
 	"math/rand"
 	"strconv"
@@ -13,6 +15,7 @@ import (
 	"time"
 	"unsafe"
 
+	"github.com/cespare/xxhash"
 	"github.com/google/uuid"
 	"github.com/mason-leap-lab/go-utils"
 	"github.com/mason-leap-lab/redeo/resp"
@@ -25,6 +28,10 @@ import (
 const (
 	LargeObjectThreshold = 30000000 // 20 MB per chunk
 	LargeObjectSplitUnit = 10000000 // 10 MB per chunk
+	// StreamFragmentsWindow Number of fragments held in memory on streaming a large object.
+	StreamFragmentsWindow = 2
+
+	anyVersion = -1 // Skip version checking on setting.
 )
 
 var (
@@ -58,28 +65,124 @@ func (h *hasher) PartitionID(key []byte) int {
 // Set New set API
 // Internal error if result is false.
 func (c *Client) Set(key string, val []byte) bool {
-	_, err := c.EcSet(key, val)
+	_, _, err := c.EcSet(key, val)
 	return err == nil
 }
 
 // EcSet Internal API
-func (c *Client) EcSet(key string, val []byte, args ...interface{}) (string, error) {
-	// Debuging options
-	var dryrun int
-	var placements []int
-	reset := false
-	if len(args) > 0 {
-		dryrun, _ = args[0].(int)
+// Arguments are debugging options in order of [dryrun [placements ["Reset"]]], use EcSetContext for other options.
+// returns reqId, the version created, and error.
+func (c *Client) EcSet(key string, val []byte, args ...interface{}) (string, int, error) {
+	return c.ecSet(context.Background(), key, val, anyVersion, newSetOptions(args))
+}
+
+// EcSetContext Internal API
+// Sets the object with specified options, use nil for default options.
+// Cancelling the context aborts all outstanding chunk requests, and the error of the context will be returned.
+// ErrVersionConflict will be returned if SetOptions.IfVersion is specified and mismatched.
+// returns reqId, the version created, and error.
+func (c *Client) EcSetContext(ctx context.Context, key string, val []byte, opts *SetOptions) (string, int, error) {
+	ver := anyVersion
+	if opts != nil && opts.IfVersion != nil {
+		ver = *opts.IfVersion
+	}
+	return c.ecSet(ctx, key, val, ver, opts)
+}
+
+// EcSetStream Internal API
+// Sets the object of specified size from the reader. Large objects are read, erasure coded and sent in fragments,
+// so only a few fragments are held in memory at a time. Arguments are the same as EcSet.
+// Objects are read as a whole if encryption is enabled, for the object is encrypted before erasure coding.
+// returns reqId, the version created, and error.
+func (c *Client) EcSetStream(key string, r io.Reader, size int64, args ...interface{}) (string, int, error) {
+	return c.EcSetStreamContext(context.Background(), key, r, size, newSetOptions(args))
+}
+
+// EcSetStreamContext Internal API
+// Sets the object of specified size from the reader with specified options, use nil for default options.
+// ErrInvalidSize will be returned if the size is negative, e.g. unknown.
+// returns reqId, the version created, and error.
+func (c *Client) EcSetStreamContext(ctx context.Context, key string, r io.Reader, size int64, opts *SetOptions) (string, int, error) {
+	if size < 0 {
+		return "", 0, ErrInvalidSize
+	}
+	if opts == nil {
+		opts = &SetOptions{}
+	}
+	// Split by the same rule as EcSet on the scheme of the storage class.
+	scheme, err := c.getScheme(opts.Class)
+	if err != nil {
+		return "", 0, err
+	}
+	if size <= int64(LargeObjectThreshold*scheme.Shards) || c.encryptor != nil {
+		val := make([]byte, size)
+		if _, err := io.ReadFull(r, val); err != nil {
+			return "", 0, err
+		}
+		return c.EcSetContext(ctx, key, val, opts)
+	} else if opts.IfVersion != nil {
+		// Fragments are set one by one, which can not be checked as a whole.
+		return "", 0, ErrNotImplemented
+	}
+
+	var readErr error
+	// Streamed objects are neither compressed nor encrypted.
+	attrs := newObjectAttrs("", opts)
+	// The reader can not be replayed, so the request is not rerouted on failure.
+	reqId, version, err := c.doSet(ctx, key, int(size), false, func(ctx context.Context, host string, reqId string, scheme *ecScheme, placements []int, ttl time.Duration) *ecRet {
+		return c.setStream(ctx, host, key, reqId, scheme, r, int(size), placements, ttl, attrs, &readErr)
+	}, opts)
+	if readErr != nil {
+		return reqId, 0, readErr
+	}
+	return reqId, version, err
+}
+
+// EcSetIfVersion Internal API
+// Sets the object only if the latest version matches specified version, use 0 if the object should not exist.
+// ErrVersionConflict will be returned on mismatch, which includes the case that another setting is in progress.
+func (c *Client) EcSetIfVersion(key string, val []byte, ver int) (string, int, error) {
+	return c.ecSet(context.Background(), key, val, ver, nil)
+}
+
+func (c *Client) ecSet(ctx context.Context, key string, val []byte, ver int, opts *SetOptions) (string, int, error) {
+	val, codec, err := c.encodeValue(key, val)
+	if err != nil {
+		log.Warn("Failed to encode %s: %v", key, err)
+		return "", 0, err
 	}
-	if len(args) > 1 {
-		p, ok := args[1].([]int)
-		if ok && len(p) >= c.Shards {
-			placements = p
+	attrs := newObjectAttrs(codec, opts)
+	return c.doSet(ctx, key, len(val), true, func(ctx context.Context, host string, reqId string, scheme *ecScheme, placements []int, ttl time.Duration) *ecRet {
+		if len(val) <= LargeObjectThreshold*len(placements) {
+			return c.set(ctx, host, key, reqId, scheme, val, placements, ver, ttl, attrs)
+		} else {
+			return c.setLarge(ctx, host, key, reqId, scheme, val, placements, ver, ttl, attrs)
 		}
+	}, opts)
+}
+
+// valueSetter sends the value encoded with the scheme to specified placements.
+type valueSetter func(ctx context.Context, host string, reqId string, scheme *ecScheme, placements []int, ttl time.Duration) *ecRet
+
+func (c *Client) doSet(ctx context.Context, key string, size int, replayable bool, setter valueSetter, opts *SetOptions) (string, int, error) {
+	if opts == nil {
+		opts = &SetOptions{}
+	}
+	scheme, err := c.getScheme(opts.Class)
+	if err != nil {
+		return "", 0, err
 	}
-	if len(args) > 2 {
-		reset = args[2] == "Reset"
+	if size < SmallObjectThreshold {
+		// Replicas are cheaper than erasure coding for small objects.
+		scheme = scheme.Replicas
 	}
+	// Debuging options
+	dryrun := opts.DryRun
+	var placements []int
+	if len(opts.Placements) >= scheme.Shards {
+		placements = opts.Placements
+	}
+	ttl := opts.TTL
 
 	reqId := uuid.New().String()
 
@@ -88,45 +191,54 @@ func (c *Client) EcSet(key string, val []byte, args ...interface{}) (string, err
 	if dryrun > 0 {
 		numClusters = dryrun
 	}
-	index := random(numClusters, c.Shards)
+	index := random(numClusters, scheme.Shards)
 	if dryrun > 0 && placements != nil {
-		if !reset {
+		if !opts.KeepPlacements {
 			copy(placements, index)
 		}
-		return reqId, nil
+		return reqId, 0, nil
 	}
 
-	stats := &c.logEntry
+	stats := &logEntry{}
 	stats.Begin(reqId)
 
 	//addr, ok := c.getHost(key)
 	//fmt.Println("in SET, key is: ", key)
-	member := c.Ring.GetPartitionOwner(Hasher.PartitionID([]byte(key)))
-	host := member.String()
+	host, err := c.members.Locate(key)
+	if err != nil {
+		return reqId, 0, err
+	}
 	// log.Debug("ring LocateKey costs: %v", time.Since(stats.Begin))
 	// log.Debug("SET located host: %s", host)
 
-	var ret *ecRet
-	if len(val) <= LargeObjectThreshold*len(index) {
-		ret = c.set(host, key, reqId, val, index)
-	} else {
-		ret = c.setLarge(host, key, reqId, val, index)
+	ret := setter(ctx, host, reqId, scheme, index, ttl)
+	if replayable && c.failover(host, ret) {
+		// Reroute to the proxy taking over the key.
+		if host, err = c.members.Locate(key); err != nil {
+			return reqId, 0, err
+		}
+		ret = setter(ctx, host, reqId, scheme, index, ttl)
 	}
 	stats.ReqLatency = stats.Since()
 	stats.Duration = stats.ReqLatency
 
 	if ret == nil {
 		log.Warn("Failed to set %s,%s: %v", key, reqId, ErrUnknown)
-		return reqId, ErrClient
+		return reqId, 0, ErrClient
+	} else if ret.Err == ErrVersionConflict {
+		return reqId, 0, ret.Err
+	} else if ret.Err != nil && ctx.Err() != nil {
+		log.Warn("Aborted setting %s,%s: %v", key, reqId, ctx.Err())
+		return reqId, 0, ctx.Err()
 	} else if ret.Err != nil {
 		ret.PrintErrors("Failed to set %s,%s", key, reqId)
-		return reqId, ErrClient
+		return reqId, 0, ErrClient
 	}
 
 	nanoLog(logClient, "set", stats.ReqId, stats.Start.UnixNano(),
 		int64(stats.Duration), int64(stats.ReqLatency), int64(0), int64(0),
-		false, false, len(val))
-	log.Info("Set %s %d %d", key, len(val), int64(stats.Duration))
+		false, false, size)
+	log.Info("Set %s %d %d", key, size, int64(stats.Duration))
 
 	if placements != nil {
 		for i := 0; i < ret.Len(); i++ {
@@ -134,7 +246,7 @@ func (c *Client) EcSet(key string, val []byte, args ...interface{}) (string, err
 		}
 	}
 
-	return stats.ReqId, nil
+	return stats.ReqId, ret.Meta.Version, nil
 }
 
 // Get New get API. No size is required.
@@ -145,30 +257,158 @@ func (c *Client) Get(key string) (ReadAllCloser, bool) {
 }
 
 // EcGet Internal API
+// An int argument is the debugging option dryrun, see GetOptions.
 // returns reqId, reader, and a bool indicate error. If not found, the reader will be nil.
 func (c *Client) EcGet(key string, args ...interface{}) (string, ReadAllCloser, error) {
-	var dryrun int
+	opts := &GetOptions{}
 	if len(args) > 0 {
-		dryrun, _ = args[0].(int)
+		opts.DryRun, _ = args[0].(int)
 	}
+	return c.EcGetContext(context.Background(), key, opts)
+}
 
+// EcGetContext Internal API
+// Gets the object with specified options, use nil for default options.
+// Cancelling the context aborts all outstanding chunk requests, and the error of the context will be returned.
+// returns reqId, reader, and error. If not found, the reader will be nil.
+func (c *Client) EcGetContext(ctx context.Context, key string, opts *GetOptions) (string, ReadAllCloser, error) {
 	reqId := uuid.New().String()
 
-	if dryrun > 0 {
+	if opts != nil && opts.DryRun > 0 {
 		return reqId, nil, nil
 	}
 
+	_, reader, err := c.ecGet(ctx, key, reqId, 0)
+	return reqId, reader, err
+}
+
+// EcGetVersion Internal API
+// Gets specified version of the object, use 0 for the latest version.
+// returns reqId, the version read, reader, and error. If not found, the reader will be nil.
+func (c *Client) EcGetVersion(key string, ver int) (string, int, ReadAllCloser, error) {
+	reqId := uuid.New().String()
+	meta, reader, err := c.ecGet(context.Background(), key, reqId, ver)
+	return reqId, meta.Version, reader, err
+}
+
+// EcGetMeta Internal API
+// Gets the object along with the metadata stored with it, e.g. flags set by SetOptions.Flags.
+// returns reqId, metadata, reader, and error. If not found, the reader will be nil.
+func (c *Client) EcGetMeta(key string) (string, *ObjectMeta, ReadAllCloser, error) {
+	reqId := uuid.New().String()
+	meta, reader, err := c.ecGet(context.Background(), key, reqId, 0)
+	if err != nil {
+		return reqId, nil, nil, err
+	}
+	return reqId, &meta, reader, nil
+}
+
+// EcGetRange Internal API
+// Gets at most length bytes of the object starting from the offset. Only data chunks covering the range are fetched, and
+// a fragment is reconstructed from parity chunks only if any of its chunks covering the range is missing.
+// returns reqId, reader, and error. If not found, the reader will be nil.
+func (c *Client) EcGetRange(key string, offset int64, length int64) (string, ReadAllCloser, error) {
+	reqId := uuid.New().String()
+	if offset < 0 || length < 0 {
+		return reqId, nil, protocol.ErrInvalidRange
+	}
+
+	host, err := c.members.Locate(key)
+	if err != nil {
+		return reqId, nil, err
+	}
+
+	ctx := context.Background()
+	reader, ret := c.getRange(ctx, host, key, reqId, offset, length)
+	if c.failover(host, ret) {
+		// Reroute to the proxy taking over the key.
+		if host, err = c.members.Locate(key); err != nil {
+			return reqId, nil, err
+		}
+		reader, ret = c.getRange(ctx, host, key, reqId, offset, length)
+	}
+	if ret.Err == ErrKeyNotFound || ret.Err == ErrNotFound {
+		return reqId, nil, ErrNotFound
+	} else if ret.Err != nil {
+		ret.PrintErrors("Failed to get range %s,%s", key, reqId)
+		return reqId, nil, ErrClient
+	}
+
+	log.Info("Got range %s %d %d %d", key, offset, reader.Len(), int64(ret.Stats.Duration))
+	return reqId, reader, nil
+}
+
+// EcStat Internal API
+// Gets the metadata of the object without reading the object. Chunks are requested with an empty range, so only the
+// meta of the object is returned along with chunks skipped.
+// returns reqId, metadata, and error. ErrNotFound will be returned if the object does not exist.
+func (c *Client) EcStat(key string) (string, *ObjectMeta, error) {
+	reqId := uuid.New().String()
+
+	host, err := c.members.Locate(key)
+	if err != nil {
+		return reqId, nil, err
+	}
+
+	ctx := context.Background()
+	ret := c.stat(ctx, host, key, reqId)
+	if c.failover(host, ret) {
+		// Reroute to the proxy taking over the key.
+		if host, err = c.members.Locate(key); err != nil {
+			return reqId, nil, err
+		}
+		ret = c.stat(ctx, host, key, reqId)
+	}
+	if ret.Err == ErrKeyNotFound || ret.Err == ErrNotFound {
+		return reqId, nil, ErrNotFound
+	} else if ret.Err != nil {
+		ret.PrintErrors("Failed to stat %s,%s", key, reqId)
+		return reqId, nil, ErrClient
+	}
+
+	size, err := decodedSize(ret.Meta.Codec, int64(ret.Meta.Size))
+	if err != nil {
+		return reqId, nil, err
+	}
+	return reqId, &ObjectMeta{Version: ret.Meta.Version, Flags: ret.Meta.Flags, Size: size}, nil
+}
+
+func (c *Client) ecGet(ctx context.Context, key string, reqId string, ver int) (ObjectMeta, ReadAllCloser, error) {
 	//addr, ok := c.getHost(key)
-	member := c.Ring.GetPartitionOwner(Hasher.PartitionID([]byte(key)))
-	host := member.String()
+	host, err := c.members.Locate(key)
+	if err != nil {
+		return ObjectMeta{}, nil, err
+	}
 	//fmt.Println("ring LocateKey costs:", time.Since(t))
 	//fmt.Println("GET located host: ", host)
 
-	reader, allRets := c.get(host, key, reqId)
+	reader, allRets := c.get(ctx, host, key, reqId, ver)
 	ret := allRets[0]
-	if ret.Err != nil {
+	if c.failover(host, ret) {
+		// Reroute to the proxy taking over the key.
+		if host, err = c.members.Locate(key); err != nil {
+			return ObjectMeta{}, nil, err
+		}
+		reader, allRets = c.get(ctx, host, key, reqId, ver)
+		ret = allRets[0]
+	}
+	if ret.Err == ErrKeyNotFound {
+		return ObjectMeta{}, nil, ErrNotFound
+	} else if ret.Err != nil && ctx.Err() != nil {
+		log.Warn("Aborted getting %s,%s: %v", key, reqId, ctx.Err())
+		return ObjectMeta{}, nil, ctx.Err()
+	} else if ret.Err != nil {
 		ret.PrintErrors("Failed to get %s,%s", key, reqId)
-		return reqId, nil, utils.Ifelse(ret.Err == ErrNotFound, ret.Err, ErrClient).(error)
+		return ObjectMeta{}, nil, utils.Ifelse(ret.Err == ErrNotFound || ret.Err == ErrVersionedFragments, ret.Err, ErrClient).(error)
+	}
+
+	if ret.Meta.Codec != "" {
+		val, err := c.decodeValue(key, reader, ret.Meta.Codec)
+		if err != nil {
+			log.Warn("Failed to decode %s,%s: %v", key, reqId, err)
+			return ObjectMeta{}, nil, err
+		}
+		reader = NewByteJoinReader([][]byte{val}, len(val), joinBytes)
 	}
 
 	nanoLog(logClient, "get", reqId, ret.Stats.Start.UnixNano(),
@@ -176,7 +416,155 @@ func (c *Client) EcGet(key string, args ...interface{}) (string, ReadAllCloser,
 		ret.Stats.AllGood, ret.Stats.Corrupted, ret.Meta.Size)
 	log.Info("Got %s %d %d ( %d %d )", key, ret.Meta.Size, int64(ret.Stats.Duration), int64(ret.Stats.RecLatency), int64(ret.Stats.CodingLatency))
 
-	return reqId, reader, nil
+	return ObjectMeta{Version: ret.Meta.Version, Flags: ret.Meta.Flags, Size: int64(reader.Len())}, reader, nil
+}
+
+// Del New del API
+// Internal error if result is false.
+func (c *Client) Del(key string) bool {
+	_, err := c.EcDel(key)
+	return err == nil
+}
+
+// EcDel Internal API
+// Removes the latest version of the object. ErrNotFound will be returned if the object does not exist.
+func (c *Client) EcDel(key string) (string, error) {
+	reqId := uuid.New().String()
+
+	host, err := c.members.Locate(key)
+	if err != nil {
+		return reqId, err
+	}
+
+	// One request is enough, the proxy will remove all chunks.
+	ret := c.del(host, key, reqId)
+	if c.failover(host, ret) {
+		// Reroute to the proxy taking over the key.
+		if host, err = c.members.Locate(key); err != nil {
+			return reqId, err
+		}
+		ret = c.del(host, key, reqId)
+	}
+
+	if ret.Err == ErrKeyNotFound {
+		return reqId, ErrNotFound
+	} else if ret.Err != nil {
+		ret.PrintErrors("Failed to del %s,%s", key, reqId)
+		return reqId, ErrClient
+	}
+
+	log.Info("Del %s", key)
+	return reqId, nil
+}
+
+// MGet Gets objects of keys. Keys are read concurrently, bounded by windows of connections to proxies, see pipeline.
+// returns readers and errors in the order of keys. If not found, the reader will be nil and the error will be ErrNotFound.
+func (c *Client) MGet(keys []string) ([]ReadAllCloser, []error) {
+	readers := make([]ReadAllCloser, len(keys))
+	errs := make([]error, len(keys))
+	c.pipeline(len(keys), func(i int) {
+		_, readers[i], errs[i] = c.EcGet(keys[i])
+	})
+	return readers, errs
+}
+
+// MSet Sets objects of keys. Keys are written concurrently, bounded by windows of connections to proxies, see pipeline.
+// returns errors indexed by keys, nil if the object has been set.
+func (c *Client) MSet(objects map[string][]byte) map[string]error {
+	keys := make([]string, 0, len(objects))
+	for key := range objects {
+		keys = append(keys, key)
+	}
+	errs := make([]error, len(keys))
+	c.pipeline(len(keys), func(i int) {
+		_, _, errs[i] = c.EcSet(keys[i], objects[keys[i]])
+	})
+
+	results := make(map[string]error, len(keys))
+	for i, key := range keys {
+		results[key] = errs[i]
+	}
+	return results
+}
+
+// pipeline runs n operations concurrently, each operation in a goroutine of its own. Chunk requests of concurrent
+// operations share connections to proxies and are sent without waiting for responses of each other, up to the window of
+// a connection. So operations in flight are bounded by windows of connections to all proxies, further operations would
+// wait for windows anyway.
+func (c *Client) pipeline(n int, op func(int)) {
+	limit := PipelineWindowSize * len(c.Ring.GetMembers())
+	if limit < 1 {
+		limit = 1
+	}
+	slots := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			op(i)
+			<-slots
+		}(i)
+	}
+	wg.Wait()
+}
+
+// Scan lists at most about count keys that match the pattern, starting from the cursor. Use 0 to start a new scan and an
+// empty pattern to match all keys. Along with the keys, the cursor to continue is returned, which is 0 if the scan is
+// complete. Like the Redis SCAN, a key may be listed more than once, and keys set or deleted during the scan may or may
+// not be listed. All keys are listed at once if count is not positive.
+func (c *Client) Scan(cursor uint64, match string, count int) ([]string, uint64, error) {
+	objects, next, err := c.ScanObjects(cursor, match, count)
+	if err != nil {
+		return nil, next, err
+	}
+	keys := make([]string, len(objects))
+	for i := range objects {
+		keys[i] = objects[i].Key
+	}
+	return keys, next, nil
+}
+
+// ScanObjects lists objects like Scan, along with sizes and the time the objects were set.
+func (c *Client) ScanObjects(cursor uint64, match string, count int) ([]ObjectInfo, uint64, error) {
+	reqId := uuid.New().String()
+
+	// All proxies list keys in the same order, so a shared cursor is valid for all of them.
+	members := c.Ring.GetMembers()
+	if len(members) == 0 {
+		return nil, cursor, ErrNoProxy
+	}
+	ret := newEcRet(context.Background(), len(members))
+	ret.Add(len(members))
+	for i, member := range members {
+		go c.sendScan(member.String(), i, cursor, match, count, reqId, ret)
+	}
+	ret.Wait()
+
+	if ret.Err != nil {
+		ret.PrintErrors("Failed to scan %d,%s", cursor, reqId)
+		return nil, cursor, ErrClient
+	}
+
+	// Continue from the least cursor among proxies, keys beyond which are left to be listed in later scans.
+	next := uint64(0)
+	for i := 0; i < ret.Len(); i++ {
+		if result := ret.RetScan(i); result.Cursor != 0 && (next == 0 || result.Cursor < next) {
+			next = result.Cursor
+		}
+	}
+	objects := make([]ObjectInfo, 0, count)
+	for i := 0; i < ret.Len(); i++ {
+		for _, object := range ret.RetScan(i).Objects {
+			if next == 0 || protocol.ScanOrder(object.Key) < next {
+				objects = append(objects, object)
+			}
+		}
+	}
+
+	log.Debug("Scanned %d keys from %d, next %d", len(objects), cursor, next)
+	return objects, next, nil
 }
 
 func (c *Client) ReadResponse(req client.Request) error {
@@ -186,6 +574,10 @@ func (c *Client) ReadResponse(req client.Request) error {
 		return c.readSetResponse(cliReq)
 	case protocol.CMD_GET_CHUNK:
 		return c.readGetResponse(cliReq)
+	case protocol.CMD_DEL_CHUNK:
+		return c.readDelResponse(cliReq)
+	case protocol.CMD_SCAN_KEYS:
+		return c.readScanResponse(cliReq)
 	default:
 		return ErrUnexpectedResponse
 	}
@@ -203,6 +595,8 @@ func (c *Client) readErrorResponse(req *ClientRequest) (error, error) {
 		strErr, err := cn.ReadError()
 		if err != nil {
 			return nil, err
+		} else if strErr == ErrVersionConflict.Error() {
+			return ErrVersionConflict, nil
 		}
 		return errors.New(strErr), nil
 	case resp.TypeNil:
@@ -222,60 +616,89 @@ func random(cluster, n int) []int {
 	return rand.Perm(cluster)[:n]
 }
 
-func (c *Client) set(host string, key string, reqId string, val []byte, placements []int) *ecRet {
-	shards, err := c.encode(val)
+func (c *Client) set(ctx context.Context, host string, key string, reqId string, scheme *ecScheme, val []byte, placements []int, ver int, ttl time.Duration, attrs *objectAttrs) *ecRet {
+	shards, err := c.encode(scheme, val)
 	if err != nil {
 		log.Warn("EcSet failed to encode: %v", err)
 		return nil
 	}
 
-	ret := newEcRet(c.Shards)
+	ret := newEcRet(ctx, scheme.Shards)
 	for i := 0; i < ret.Len(); i++ {
 		ret.Add(1)
-		go c.sendSet(host, key, reqId, strconv.Itoa(len(val)), i, shards[i], placements[i], ret)
+		go c.sendSet(host, key, reqId, strconv.Itoa(len(val)), scheme, i, shards[i], placements[i], ver, ttl, attrs, ret)
 	}
 	ret.Wait()
 
 	return ret
 }
 
-func (c *Client) setLarge(host string, key string, reqId string, val []byte, placements []int) *ecRet {
-	numFrags := int(math.Round(float64(len(val)) / LargeObjectSplitUnit / float64(len(placements))))
+func (c *Client) setLarge(ctx context.Context, host string, key string, reqId string, scheme *ecScheme, val []byte, placements []int, ver int, ttl time.Duration, attrs *objectAttrs) *ecRet {
+	numFrags := numFragments(len(val), len(placements))
 	fragments, _ := NewEncoder(numFrags, 0, 0).Split(val)
+	return c.setFragments(ctx, host, key, reqId, scheme, len(val), numFrags, placements, ver, ttl, attrs, func(shardsSet [][][]byte, notifiers []WaitGroup, _ []*ecRet) {
+		c.encodeFragments(scheme, fragments, shardsSet, notifiers)
+	})
+}
+
+func (c *Client) setStream(ctx context.Context, host string, key string, reqId string, scheme *ecScheme, r io.Reader, size int, placements []int, ttl time.Duration, attrs *objectAttrs, readErr *error) *ecRet {
+	numFrags := numFragments(size, len(placements))
+	return c.setFragments(ctx, host, key, reqId, scheme, size, numFrags, placements, anyVersion, ttl, attrs, func(shardsSet [][][]byte, notifiers []WaitGroup, allRets []*ecRet) {
+		*readErr = c.encodeStream(scheme, r, size, shardsSet, notifiers, allRets)
+	})
+}
+
+// setFragments sends fragments prepared by the encoder. The encoder is expected to notify on each fragment prepared,
+// and leaves the fragment nil on failure.
+func (c *Client) setFragments(ctx context.Context, host string, key string, reqId string, scheme *ecScheme, size int, numFrags int, placements []int, ver int, ttl time.Duration, attrs *objectAttrs,
+	encoder func([][][]byte, []WaitGroup, []*ecRet)) *ecRet {
 	shardsSet := make([][][]byte, numFrags)
 	notifiers := make([]WaitGroup, numFrags)
 	for i := 0; i < numFrags; i++ {
 		notifiers[i] = &sync.WaitGroup{}
 		notifiers[i].Add(1)
 	}
-	go c.encodeFragments(fragments, shardsSet, notifiers)
 
 	allRets := make([]*ecRet, numFrags)
 	for i := 0; i < len(allRets); i++ {
-		ret := newEcRet(c.Shards)
+		ret := newEcRet(ctx, scheme.Shards)
 		ret.Add(ret.Len())
 		allRets[i] = ret
 	}
+	var encoded sync.WaitGroup
+	encoded.Add(1)
+	go func() {
+		defer encoded.Done()
+		encoder(shardsSet, notifiers, allRets)
+	}()
+
 	ret := allRets[0]
-	strSize := fmt.Sprintf("%d-%d", len(val), numFrags)
+	strSize := fmt.Sprintf("%d-%d", size, numFrags)
 	for i := 0; i < ret.Len(); i++ {
 		go func(i int) {
 			var lastError error
 			j := 0
-			for k, rid := key, reqId; j < numFrags; {
+			for k, rid, v := key, reqId, ver; j < numFrags; {
 				// Wait for fragments
 				notifiers[j].Wait()
+				shards := shardsSet[j]
+				if shards == nil {
+					// Failed to prepare the fragment.
+					lastError = ErrAbandonRequest
+					break
+				}
 				// TODO: sendSet set total size
 				// Use non-postfixed key and reqId in first iteration for backward compatibility
 				// and dynamic fragments detection in Get API
-				c.sendSet(host, k, rid, strSize, i, shardsSet[j][i], placements[i], allRets[j])
+				// Only the first fragment is checked against the version.
+				c.sendSet(host, k, rid, strSize, scheme, i, shards[i], placements[i], v, ttl, attrs, allRets[j])
 				j++
 				// Abort reset fragments on any error.
 				if allRets[j-1].Err != nil {
 					lastError = ErrAbandonRequest
 					break
 				}
-				k, rid = fmt.Sprintf("%s-%d", key, j), fmt.Sprintf("%s-%d", reqId, j)
+				k, rid, v = fmt.Sprintf("%s-%d", key, j), fmt.Sprintf("%s-%d", reqId, j), anyVersion
 			}
 			// Abandon rest on error
 			for ; j < numFrags; j++ {
@@ -294,20 +717,64 @@ func (c *Client) setLarge(host string, key string, reqId string, val []byte, pla
 	for ; i < len(allRets); i++ {
 		allRets[i].Wait()
 	}
+	// Ensure the encoder stops before return.
+	encoded.Wait()
 
 	// If any err, ret.Err will be error.
 	// If success, only placements of first fragment are returned.
 	return ret
 }
 
-func (c *Client) encodeFragments(fragments [][]byte, shardsSet [][][]byte, notifiers []WaitGroup) {
+func (c *Client) encodeFragments(scheme *ecScheme, fragments [][]byte, shardsSet [][][]byte, notifiers []WaitGroup) {
 	for i, fragment := range fragments {
-		shardsSet[i], _ = c.encode(fragment)
+		shardsSet[i], _ = c.encode(scheme, fragment)
+		notifiers[i].Done()
+	}
+}
+
+// encodeStream reads and encodes fragments from the reader. To bound the memory usage, a fragment will not be read
+// until the fragment StreamFragmentsWindow ahead of it has been sent.
+func (c *Client) encodeStream(scheme *ecScheme, r io.Reader, size int, shardsSet [][][]byte, notifiers []WaitGroup, rets []*ecRet) (err error) {
+	fragSize := (size + len(shardsSet) - 1) / len(shardsSet)
+	i := 0
+	for read := 0; i < len(shardsSet); i++ {
+		if i >= StreamFragmentsWindow {
+			rets[i-StreamFragmentsWindow].Wait()
+			shardsSet[i-StreamFragmentsWindow] = nil // Release sent fragment.
+			// Stop reading if the request has been abandoned.
+			if rets[i-StreamFragmentsWindow].Err != nil {
+				break
+			}
+		}
+
+		if read+fragSize > size {
+			fragSize = size - read
+		}
+		fragment := make([]byte, fragSize)
+		if _, err = io.ReadFull(r, fragment); err != nil {
+			break
+		}
+		read += fragSize
+
+		if shardsSet[i], err = c.encode(scheme, fragment); err != nil {
+			notifiers[i].Done()
+			i++
+			break
+		}
+		notifiers[i].Done()
+	}
+	// Unblock senders of fragments left, which will be abandoned.
+	for ; i < len(shardsSet); i++ {
 		notifiers[i].Done()
 	}
+	return
+}
+
+func numFragments(size int, numPlacements int) int {
+	return int(math.Round(float64(size) / LargeObjectSplitUnit / float64(numPlacements)))
 }
 
-func (c *Client) sendSet(addr string, key string, reqId string, size string, i int, val []byte, lambdaId int, ret *ecRet) {
+func (c *Client) sendSet(addr string, key string, reqId string, size string, scheme *ecScheme, i int, val []byte, lambdaId int, ver int, ttl time.Duration, attrs *objectAttrs, ret *ecRet) {
 	req := ret.Request(i)
 	if req == nil {
 		// Ret abandoned
@@ -315,16 +782,22 @@ func (c *Client) sendSet(addr string, key string, reqId string, size string, i i
 	}
 	req.Cmd = protocol.CMD_SET_CHUNK
 	req.ReqId = reqId
+	checksum := xxhash.Sum64(val)
 
 	var lastErr error
 	for attempt := 0; attempt < RequestAttempts; attempt++ {
+		// Stop attempts if the request has been cancelled.
+		if err := req.Context().Err(); err != nil {
+			req.SetResponse(err, "sendSet")
+			return
+		}
 		if attempt > 0 {
 			log.Info("Retry setting %d@%s(%s), %s, attempt %d", i, key, addr, reqId, attempt+1)
 		}
 
 		cn, err := c.validate(addr, i)
 		if err != nil {
-			req.SetResponse(fmt.Errorf("error on validating connection(%s): %v", addr, err), "sendSet")
+			req.SetResponse(fmt.Errorf("error on validating connection(%s): %w", addr, err), "sendSet")
 			return
 		}
 
@@ -334,17 +807,25 @@ func (c *Client) sendSet(addr string, key string, reqId string, size string, i i
 			cn.SetWriteDeadline(time.Now().Add(HeaderTimeout)) // Set deadline for request
 			defer cn.SetWriteDeadline(time.Time{})             // One defered reset is enough.
 
-			cn.WriteMultiBulkSize(11)
+			// Optional arguments are positional: [version [ttl [checksum [class [replicated [codec [flags]]]]]]]. All are always set.
+			cn.WriteMultiBulkSize(18)
 			cn.WriteBulkString(req.Cmd)
 			cn.WriteBulkString(strconv.FormatInt(req.Seq(), 10))
 			cn.WriteBulkString(key)
 			cn.WriteBulkString(req.ReqId)
 			cn.WriteBulkString(size)
 			cn.WriteBulkString(strconv.Itoa(i))
-			cn.WriteBulkString(strconv.Itoa(c.DataShards))
-			cn.WriteBulkString(strconv.Itoa(c.ParityShards))
+			cn.WriteBulkString(strconv.Itoa(scheme.DataShards))
+			cn.WriteBulkString(strconv.Itoa(scheme.ParityShards))
 			cn.WriteBulkString(strconv.Itoa(lambdaId))
 			cn.WriteBulkString(strconv.Itoa(MaxLambdaStores))
+			cn.WriteBulkString(strconv.Itoa(ver))
+			cn.WriteBulkString(strconv.FormatInt(ttl.Milliseconds(), 10))
+			cn.WriteBulkString(strconv.FormatUint(checksum, 10))
+			cn.WriteBulkString(scheme.Class)
+			cn.WriteBulkString(strconv.FormatBool(scheme.Replicated))
+			cn.WriteBulkString(attrs.Codec)
+			cn.WriteBulkString(strconv.FormatUint(uint64(attrs.Flags), 10))
 			if err := cn.Flush(); err != nil {
 				errPrompts = "Failed to flush headers of setting %d@%s(%v): %v, left attempts: %d"
 				return err
@@ -379,7 +860,7 @@ func (c *Client) sendSet(addr string, key string, reqId string, size string, i i
 		return
 	}
 
-	req.SetResponse(fmt.Errorf("stop attempts: %v, last error: %v", ErrMaxPreflightsReached, lastErr), "sendSet")
+	req.SetResponse(fmt.Errorf("stop attempts: %v, last error: %w", ErrMaxPreflightsReached, lastErr), "sendSet")
 }
 
 func (c *Client) readSetResponse(req *ClientRequest) error {
@@ -404,7 +885,8 @@ func (c *Client) readSetResponse(req *ClientRequest) error {
 
 	respId, _ := cn.ReadBulkString()
 	chunkId, _ := cn.ReadBulkString()
-	storeId, err := cn.ReadBulkString()
+	storeId, _ := cn.ReadBulkString()
+	version, err := cn.ReadBulkString()
 	if err != nil {
 		req.SetResponse(fmt.Errorf("error on reading header: %v", err), "readSetResponse")
 		return err
@@ -417,25 +899,41 @@ func (c *Client) readSetResponse(req *ClientRequest) error {
 		return nil
 	}
 
+	ret := req.Context().Value(CtxKeyECRet).(*ecRet)
+	if ret.Meta.Version == 0 {
+		ret.Meta.Version, _ = strconv.Atoi(version)
+	}
+
 	log.Debug("Set chunk %s(%d)", req.ReqId, cm.AddrIdx)
 	req.SetResponse(storeId, "readSetResponse")
 	return nil
 }
 
 // TODO, read first, return total Size, and request more if neccessary
-func (c *Client) get(host string, key string, reqId string) (ReadAllCloser, []*ecRet) {
-	// Send request and wait
-	ret := newEcRet(c.Shards)
-	ret.Stats = &c.logEntry
+func (c *Client) get(ctx context.Context, host string, key string, reqId string, ver int) (ReadAllCloser, []*ecRet) {
+	// Send request and wait. The scheme of the object is unknown yet, so chunks are requested up to the max shards.
+	ret := newEcRet(ctx, c.maxShards)
+	ret.Stats = &logEntry{}
 	ret.Stats.Begin(reqId)
 	ret.Stats.ReqLatency = 0
 	for i := 0; i < ret.Len(); i++ {
 		ret.Add(1)
-		go c.sendGet(host, key, reqId, i, ret)
+		go c.sendGet(host, key, reqId, i, ver, nil, ret)
+	}
+	// Replicas are identical, so a replicated object returns on the first replica verified, and other requests are
+	// abandoned. Erasure coded objects wait for all chunks.
+	ret.WaitFirst()
+	scheme := c.matchScheme(ret.Meta.Shards)
+	if scheme != nil && scheme.Replicated && ret.NumOK() > 0 {
+		ret.Abandon()
+	} else {
+		ret.Wait()
 	}
-	ret.Wait()
 
-	if ret.Err != nil && ret.NumOK() < c.DataShards {
+	if scheme == nil {
+		ret.Err = protocol.ErrUnknownStorageClass
+		return nil, []*ecRet{ret}
+	} else if ret.Err != nil && ret.NumOK() < scheme.DataShards {
 		return nil, []*ecRet{ret}
 	} else {
 		ret.Err = nil
@@ -457,12 +955,17 @@ func (c *Client) get(host string, key string, reqId string) (ReadAllCloser, []*e
 	if len(sizeFragments) > 1 {
 		ret.Meta.NumFrags, _ = strconv.Atoi(sizeFragments[1])
 	}
+	// Versions of fragments are maintained independently.
+	if ver > 0 && ret.Meta.NumFrags > 1 {
+		ret.Err = ErrVersionedFragments
+		return nil, []*ecRet{ret}
+	}
 	switch ret.Meta.NumFrags {
 	case 0:
 		ret.Err = ErrInvalidSize
 		return nil, []*ecRet{ret}
 	case 1:
-		reader, err := c.decodeFragment(ret, ret.Meta.Size)
+		reader, err := c.decodeFragment(ret, scheme, ret.Meta.Size)
 		if err != nil {
 			ret.Err = err
 		}
@@ -475,7 +978,7 @@ func (c *Client) get(host string, key string, reqId string) (ReadAllCloser, []*e
 	allRets := make([]*ecRet, ret.Meta.NumFrags)
 	allRets[0] = ret
 	for i := 1; i < len(allRets); i++ {
-		ret := newEcRet(c.Shards)
+		ret := newEcRet(ctx, scheme.Shards)
 		ret.Stats = &logEntry{}
 		ret.Stats.Begin(fmt.Sprintf("%s-%d", reqId, i))
 		ret.Stats.ReqLatency = 0
@@ -484,13 +987,13 @@ func (c *Client) get(host string, key string, reqId string) (ReadAllCloser, []*e
 	}
 	readers := make([]ReadAllCloser, ret.Meta.NumFrags)
 	chanErr := make(chan error, 1)
-	go c.decodeFragments(allRets, readers, chanErr)
+	go c.decodeFragments(allRets, scheme, readers, chanErr)
 
 	// Parallelly send all fragments of the same chunk id.
-	for i := 0; i < ret.Len(); i++ {
+	for i := 0; i < scheme.Shards; i++ {
 		go func(i int) {
 			for j := 1; j < ret.Meta.NumFrags; j++ {
-				c.sendGet(host, fmt.Sprintf("%s-%d", key, j), fmt.Sprintf("%s-%d", reqId, j), i, allRets[j])
+				c.sendGet(host, fmt.Sprintf("%s-%d", key, j), fmt.Sprintf("%s-%d", reqId, j), i, 0, nil, allRets[j])
 			}
 		}(i)
 	}
@@ -506,7 +1009,182 @@ func (c *Client) get(host string, key string, reqId string) (ReadAllCloser, []*e
 	return NewJoinReader(readers, ret.Meta.Size), allRets
 }
 
-func (c *Client) decodeFragments(rets []*ecRet, readers []ReadAllCloser, chanErr chan<- error) {
+// stat requests chunks of the object with an empty range to get the meta of the object.
+func (c *Client) stat(ctx context.Context, host string, key string, reqId string) *ecRet {
+	ret := newEcRet(ctx, c.maxShards)
+	ret.Stats = &logEntry{}
+	ret.Stats.Begin(reqId)
+	for i := 0; i < ret.Len(); i++ {
+		ret.Add(1)
+		go c.sendGet(host, key, reqId, i, 0, &rangeArgs{}, ret)
+	}
+	ret.Wait()
+
+	if ret.Meta.Raw == "" {
+		return ret
+	}
+	size, numFrags, err := protocol.ParseObjectSize(ret.Meta.Raw)
+	if err != nil || numFrags < 1 {
+		ret.Err = ErrInvalidSize
+		return ret
+	} else if size == 0 {
+		ret.Err = ErrNotFound
+		return ret
+	}
+	// All chunks are expected to be skipped.
+	ret.Err = nil
+	ret.Meta.Size, ret.Meta.NumFrags = int(size), numFrags
+	return ret
+}
+
+func (c *Client) getRange(ctx context.Context, host string, key string, reqId string, offset int64, length int64) (ReadAllCloser, *ecRet) {
+	// The layout of the object is unknown yet, so chunks of the first fragment are requested up to the max shards. The proxy
+	// serves chunks covering the range only, and skips others with the meta of the object.
+	ret := newEcRet(ctx, c.maxShards)
+	ret.Stats = &logEntry{}
+	ret.Stats.Begin(reqId)
+	ret.Stats.ReqLatency = 0
+	for i := 0; i < ret.Len(); i++ {
+		ret.Add(1)
+		go c.sendGet(host, key, reqId, i, 0, &rangeArgs{offset: offset, length: length}, ret)
+	}
+	ret.Wait()
+
+	if ret.Meta.Raw == "" {
+		return nil, ret
+	}
+	scheme := c.matchScheme(ret.Meta.Shards)
+	if scheme == nil {
+		ret.Err = protocol.ErrUnknownStorageClass
+		return nil, ret
+	}
+	size, numFrags, err := protocol.ParseObjectSize(ret.Meta.Raw)
+	if err != nil || numFrags < 1 {
+		ret.Err = ErrInvalidSize
+		return nil, ret
+	} else if size == 0 {
+		ret.Err = ErrNotFound
+		return nil, ret
+	}
+	// Skipped chunks are expected.
+	ret.Err = nil
+	ret.Meta.Size, ret.Meta.NumFrags = int(size), numFrags
+
+	if ret.Meta.Codec != "" {
+		// Ranges of compressed or encrypted objects are sliced from the whole object.
+		reader, allRets := c.get(ctx, host, key, fmt.Sprintf("%s-r", reqId), 0)
+		if allRets[0].Err != nil {
+			ret.Err = allRets[0].Err
+			return nil, ret
+		}
+		val, err := c.decodeValue(key, reader, ret.Meta.Codec)
+		if err != nil {
+			ret.Err = err
+			return nil, ret
+		}
+		if offset >= int64(len(val)) {
+			val = nil
+		} else if val = val[offset:]; int64(len(val)) > length {
+			val = val[:length]
+		}
+		ret.Stats.Duration = ret.Stats.Since()
+		return NewByteJoinReader([][]byte{val}, len(val), joinBytes), ret
+	}
+
+	if offset >= size {
+		length = 0
+	} else if offset+length > size {
+		length = size - offset
+	}
+	var pieces [][]byte
+	if length > 0 {
+		_, fragSize := protocol.FragmentOf(size, numFrags, 0)
+		for j := int(offset / fragSize); j <= int((offset+length-1)/fragSize); j++ {
+			fragKey, fragReqId, fragRet := key, reqId, ret
+			if j > 0 {
+				// Chunks of other fragments are requested with the layout known.
+				fragKey, fragReqId = fmt.Sprintf("%s-%d", key, j), fmt.Sprintf("%s-%d", reqId, j)
+				fragRet = newEcRet(ctx, scheme.Shards)
+				fragRet.Stats = &logEntry{}
+				fragRet.Stats.Begin(fragReqId)
+				for i := 0; i < fragRet.Len(); i++ {
+					fragRet.Add(1)
+					go c.sendGet(host, fragKey, fragReqId, i, 0, &rangeArgs{offset: offset, length: length, fragment: j}, fragRet)
+				}
+				fragRet.Wait()
+			}
+
+			piece, err := c.sliceFragment(ctx, host, fragKey, fragReqId, scheme, fragRet, size, numFrags, j, offset, length)
+			if err != nil {
+				ret.Err = err
+				return nil, ret
+			}
+			pieces = append(pieces, piece)
+		}
+	}
+
+	ret.Stats.Duration = ret.Stats.Since()
+	return NewByteJoinReader(pieces, int(length), joinBytes), ret
+}
+
+// sliceFragment returns the part of the range in the fragment. If any chunk covering the range is missing, the fragment
+// is reconstructed from other chunks.
+func (c *Client) sliceFragment(ctx context.Context, host string, key string, reqId string, scheme *ecScheme, ret *ecRet,
+	size int64, numFrags int, frag int, offset int64, length int64) ([]byte, error) {
+	span := protocol.LocateRange(size, numFrags, frag, scheme.DataShards, offset, length)
+	chunks := make([][]byte, 0, span.Len())
+	for i := span.First; i <= span.Last; i++ {
+		chunk := ret.RetChunk(i)
+		if len(chunk) == 0 {
+			chunks = nil
+			break
+		}
+		chunks = append(chunks, chunk)
+	}
+	if chunks != nil {
+		if joined := bytes.Join(chunks, nil); span.End <= int64(len(joined)) {
+			return joined[span.Start:span.End], nil
+		}
+	}
+
+	log.Debug("Chunks of range missing in %s,%s, reconstructing...", key, reqId)
+	full := newEcRet(ctx, scheme.Shards)
+	full.Stats = &logEntry{}
+	full.Stats.Begin(reqId)
+	for i := 0; i < full.Len(); i++ {
+		full.Add(1)
+		go c.sendGet(host, key, fmt.Sprintf("%s-r", reqId), i, 0, nil, full)
+	}
+	full.Wait()
+	if full.Err != nil && full.NumOK() < scheme.DataShards {
+		return nil, full.Err
+	}
+	full.Err = nil
+
+	_, fragSize := protocol.FragmentOf(size, numFrags, frag)
+	reader, err := c.decodeFragment(full, scheme, int(fragSize))
+	if err != nil {
+		return nil, err
+	}
+	data, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	start := int64(span.First)*((fragSize+int64(scheme.DataShards)-1)/int64(scheme.DataShards)) + span.Start
+	return data[start : start+span.End-span.Start], nil
+}
+
+// joinBytes ByteJoiner implementation that concats pieces in order.
+func joinBytes(dst io.Writer, pieces [][]byte, _ int) error {
+	for _, piece := range pieces {
+		if _, err := dst.Write(piece); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) decodeFragments(rets []*ecRet, scheme *ecScheme, readers []ReadAllCloser, chanErr chan<- error) {
 	var err error
 	fragSize := (rets[0].Meta.Size + rets[0].Meta.NumFrags - 1) / rets[0].Meta.NumFrags
 	read := fragSize
@@ -527,7 +1205,7 @@ func (c *Client) decodeFragments(rets []*ecRet, readers []ReadAllCloser, chanErr
 		}
 
 		// Decode, return on error
-		readers[i], err = c.decodeFragment(ret, fragSize)
+		readers[i], err = c.decodeFragment(ret, scheme, fragSize)
 		if err != nil {
 			chanErr <- err
 			return
@@ -538,7 +1216,7 @@ func (c *Client) decodeFragments(rets []*ecRet, readers []ReadAllCloser, chanErr
 	close(chanErr)
 }
 
-func (c *Client) decodeFragment(ret *ecRet, size int) (ReadAllCloser, error) {
+func (c *Client) decodeFragment(ret *ecRet, scheme *ecScheme, size int) (ReadAllCloser, error) {
 	ret.Stats.RecLatency = ret.Stats.Since()
 
 	if ret.Err != nil {
@@ -550,27 +1228,39 @@ func (c *Client) decodeFragment(ret *ecRet, size int) (ReadAllCloser, error) {
 	// 1. 4 shards
 	// 2. 6 shards
 	// Unexpectedly, 5 shards will fail.
-	chunks := make([][]byte, ret.Len())
-	tbRead := ret.NumOK()
-	if tbRead < c.DataShards+c.ParityShards {
-		tbRead = c.DataShards
-	}
-	read := 0
-	for i := 0; i < ret.Len() && read < tbRead; i++ {
-		chunks[i] = ret.RetChunk(i)
-		if len(chunks[i]) > 0 {
-			read++
+	chunks := make([][]byte, scheme.Shards)
+	if first := ret.FirstOK(); scheme.Replicated && first >= 0 && first < len(chunks) {
+		// Any replica serves, other requests may be still outstanding.
+		chunks[first] = ret.RetChunk(first)
+	} else {
+		tbRead := ret.NumOK()
+		if tbRead < scheme.Shards {
+			tbRead = scheme.DataShards
+		}
+		read := 0
+		for i := 0; i < len(chunks) && read < tbRead; i++ {
+			chunks[i] = ret.RetChunk(i)
+			if len(chunks[i]) > 0 {
+				read++
+			}
 		}
 	}
 
 	decodeStart := time.Now()
-	reader, err := c.decode(ret.Stats, chunks, size)
+	reader, err := c.decode(scheme, ret.Stats, chunks, size)
 	ret.Stats.CodingLatency = time.Since(decodeStart)
 	ret.Stats.Duration = ret.Stats.Since()
 	return reader, err
 }
 
-func (c *Client) sendGet(addr string, key string, reqId string, i int, ret *ecRet) {
+// rangeArgs The range to read, only data chunks covering the range in the fragment will be served.
+type rangeArgs struct {
+	offset   int64
+	length   int64
+	fragment int
+}
+
+func (c *Client) sendGet(addr string, key string, reqId string, i int, ver int, span *rangeArgs, ret *ecRet) {
 	req := ret.Request(i)
 	if req == nil {
 		// Ret abandoned
@@ -581,20 +1271,36 @@ func (c *Client) sendGet(addr string, key string, reqId string, i int, ret *ecRe
 
 	var lastErr error
 	for attempt := 0; attempt < RequestAttempts; attempt++ {
+		// Stop attempts if the request has been abandoned or cancelled.
+		if ret.IsAbandoned() {
+			req.SetResponse(ErrAbandon, "sendGet")
+			return
+		}
+		if err := req.Context().Err(); err != nil {
+			req.SetResponse(err, "sendGet")
+			return
+		}
 		if attempt > 0 {
 			log.Info("Retry getting %d@%s(%s), %s, attempt %d", i, key, addr, reqId, attempt+1)
 		}
 
 		cn, err := c.validate(addr, i)
 		if err != nil {
-			req.SetResponse(fmt.Errorf("error on validating connection(%s): %v", addr, err), "sendGet")
+			req.SetResponse(fmt.Errorf("error on validating connection(%s): %w", addr, err), "sendGet")
 			return
 		}
 
 		req.SetConn(cn)
 		err = cn.StartRequest(req, func(_ client.Request) error {
-			// cmd seq key reqId chunkId
-			cn.WriteCmdString(req.Cmd, strconv.FormatInt(req.Seq(), 10), key, req.ReqId, strconv.Itoa(i))
+			// cmd seq key reqId chunkId [version [offset length fragment]]
+			if span != nil {
+				cn.WriteCmdString(req.Cmd, strconv.FormatInt(req.Seq(), 10), key, req.ReqId, strconv.Itoa(i), strconv.Itoa(ver),
+					strconv.FormatInt(span.offset, 10), strconv.FormatInt(span.length, 10), strconv.Itoa(span.fragment))
+			} else if ver > 0 {
+				cn.WriteCmdString(req.Cmd, strconv.FormatInt(req.Seq(), 10), key, req.ReqId, strconv.Itoa(i), strconv.Itoa(ver))
+			} else {
+				cn.WriteCmdString(req.Cmd, strconv.FormatInt(req.Seq(), 10), key, req.ReqId, strconv.Itoa(i))
+			}
 			return nil
 		})
 		// if err != nil && err == client.ErrResponded {
@@ -616,7 +1322,7 @@ func (c *Client) sendGet(addr string, key string, reqId string, i int, ret *ecRe
 		return
 	}
 
-	req.SetResponse(fmt.Errorf("stop attempts: %v, last error %v", ErrMaxPreflightsReached, lastErr), "sendGet")
+	req.SetResponse(fmt.Errorf("stop attempts: %v, last error %w", ErrMaxPreflightsReached, lastErr), "sendGet")
 }
 
 func (c *Client) readGetResponse(req *ClientRequest) error {
@@ -636,6 +1342,11 @@ func (c *Client) readGetResponse(req *ClientRequest) error {
 
 	respId, _ := cn.ReadBulkString()
 	meta, _ := cn.ReadBulkString()
+	version, _ := cn.ReadBulkString()
+	checksum, _ := cn.ReadBulkString()
+	shards, _ := cn.ReadBulkString()
+	codec, _ := cn.ReadBulkString()
+	flags, _ := cn.ReadBulkString()
 	chunkId, err := cn.ReadBulkString()
 	if err != nil {
 		req.SetResponse(fmt.Errorf("error on reading header: %v", err), "readGetResponse")
@@ -657,6 +1368,14 @@ func (c *Client) readGetResponse(req *ClientRequest) error {
 
 	// Abandon?
 	if chunkId == "-1" {
+		// Chunks skipped by range reads carry the meta of the object.
+		if ret := req.Context().Value(CtxKeyECRet).(*ecRet); ret.Meta.Raw == "" && meta != "" {
+			ret.Meta.Raw = meta
+			ret.Meta.Shards = shards
+			ret.Meta.Codec = codec
+			ret.Meta.Flags = parseFlags(flags)
+			ret.Meta.Version, _ = strconv.Atoi(version)
+		}
 		req.SetResponse(ErrAbandon, "readGetResponse")
 		return nil
 	}
@@ -683,6 +1402,17 @@ func (c *Client) readGetResponse(req *ClientRequest) error {
 	ret := req.Context().Value(CtxKeyECRet).(*ecRet)
 	if ret.Meta.Raw == "" {
 		ret.Meta.Raw = meta
+		ret.Meta.Shards = shards
+		ret.Meta.Codec = codec
+		ret.Meta.Flags = parseFlags(flags)
+		ret.Meta.Version, _ = strconv.Atoi(version)
+	}
+
+	// Verify the chunk. A corrupted chunk is treated as lost and will be reconstructed.
+	if expected, _ := strconv.ParseUint(checksum, 10, 64); expected != 0 && xxhash.Sum64(val) != expected {
+		log.Warn("Checksum mismatched on getting chunk %s(%d), treated as lost.", req.ReqId, cm.AddrIdx)
+		req.SetResponse(ErrCorrupted, "readGetResponse")
+		return nil
 	}
 
 	log.Debug("Got chunk %s(%d)", req.ReqId, cm.AddrIdx)
@@ -690,6 +1420,191 @@ func (c *Client) readGetResponse(req *ClientRequest) error {
 	return nil
 }
 
+func (c *Client) del(host string, key string, reqId string) *ecRet {
+	ret := newEcRet(context.Background(), 1)
+	ret.Add(1)
+	go c.sendDel(host, key, reqId, ret)
+	ret.Wait()
+	return ret
+}
+
+func (c *Client) sendDel(addr string, key string, reqId string, ret *ecRet) {
+	req := ret.Request(0)
+	req.Cmd = protocol.CMD_DEL_CHUNK
+	req.ReqId = reqId
+
+	var lastErr error
+	for attempt := 0; attempt < RequestAttempts; attempt++ {
+		if attempt > 0 {
+			log.Info("Retry deleting %s(%s), %s, attempt %d", key, addr, reqId, attempt+1)
+		}
+
+		cn, err := c.validate(addr, 0)
+		if err != nil {
+			req.SetResponse(fmt.Errorf("error on validating connection(%s): %w", addr, err), "sendDel")
+			return
+		}
+
+		req.SetConn(cn)
+		err = cn.StartRequest(req, func(_ client.Request) error {
+			// cmd seq key reqId
+			cn.WriteCmdString(req.Cmd, strconv.FormatInt(req.Seq(), 10), key, req.ReqId)
+			return nil
+		})
+		if err != nil && c.closed {
+			req.SetResponse(ErrClientClosed, "sendDel")
+			return
+		} else if err != nil {
+			lastErr = err
+			log.Warn("Failed to initiate deleting %s(%v): %v, left attempts: %d", key, cn.GetConn(), err, RequestAttempts-attempt-1)
+			continue
+		}
+
+		log.Debug("Initiated deleting %s(%s), attempt %d", key, addr, attempt+1)
+		// Set deadline for response header.
+		cn.SetReadDeadline(time.Now().Add(Timeout))
+		return
+	}
+
+	req.SetResponse(fmt.Errorf("stop attempts: %v, last error %w", ErrMaxPreflightsReached, lastErr), "sendDel")
+}
+
+func (c *Client) readDelResponse(req *ClientRequest) error {
+	cn := req.Conn()
+
+	// Read header fields
+	cn.SetReadDeadline(time.Now().Add(HeaderTimeout))
+	appErr, err := c.readErrorResponse(req)
+	if err != nil {
+		req.SetResponse(err, "readDelResponse")
+		return err
+	} else if appErr != nil {
+		req.SetResponse(appErr, "readDelResponse")
+		return nil
+	}
+
+	respId, _ := cn.ReadBulkString()
+	version, err := cn.ReadBulkString()
+	if err != nil {
+		req.SetResponse(fmt.Errorf("error on reading header: %v", err), "readDelResponse")
+		return err
+	}
+
+	if respId != req.ReqId {
+		log.Warn("Unexpected response %s, expects %s", logger.SafeString(respId, len(req.ReqId)), req.ReqId)
+		req.SetResponse(ErrUnexpectedResponse, "readDelResponse")
+		return nil
+	}
+
+	log.Debug("Deleted %s(v%s)", req.ReqId, version)
+	req.SetResponse(version, "readDelResponse")
+	return nil
+}
+
+func (c *Client) sendScan(addr string, i int, cursor uint64, match string, count int, reqId string, ret *ecRet) {
+	req := ret.Request(i)
+	req.Cmd = protocol.CMD_SCAN_KEYS
+	req.ReqId = reqId
+
+	var lastErr error
+	for attempt := 0; attempt < RequestAttempts; attempt++ {
+		if attempt > 0 {
+			log.Info("Retry scanning %s, %s, attempt %d", addr, reqId, attempt+1)
+		}
+
+		cn, err := c.validate(addr, 0)
+		if err != nil {
+			req.SetResponse(fmt.Errorf("error on validating connection(%s): %w", addr, err), "sendScan")
+			return
+		}
+
+		req.SetConn(cn)
+		err = cn.StartRequest(req, func(_ client.Request) error {
+			// cmd seq reqId cursor count [pattern]
+			args := []string{strconv.FormatInt(req.Seq(), 10), req.ReqId, strconv.FormatUint(cursor, 10), strconv.Itoa(count)}
+			if match != "" {
+				args = append(args, match)
+			}
+			cn.WriteCmdString(req.Cmd, args...)
+			return nil
+		})
+		if err != nil && c.closed {
+			req.SetResponse(ErrClientClosed, "sendScan")
+			return
+		} else if err != nil {
+			lastErr = err
+			log.Warn("Failed to initiate scanning %v: %v, left attempts: %d", cn.GetConn(), err, RequestAttempts-attempt-1)
+			continue
+		}
+
+		log.Debug("Initiated scanning %s, attempt %d", addr, attempt+1)
+		// Set deadline for response header.
+		cn.SetReadDeadline(time.Now().Add(Timeout))
+		return
+	}
+
+	req.SetResponse(fmt.Errorf("stop attempts: %v, last error %w", ErrMaxPreflightsReached, lastErr), "sendScan")
+}
+
+func (c *Client) readScanResponse(req *ClientRequest) error {
+	cn := req.Conn()
+
+	// Read header fields
+	cn.SetReadDeadline(time.Now().Add(HeaderTimeout))
+	appErr, err := c.readErrorResponse(req)
+	if err != nil {
+		req.SetResponse(err, "readScanResponse")
+		return err
+	} else if appErr != nil {
+		req.SetResponse(appErr, "readScanResponse")
+		return nil
+	}
+
+	respId, _ := cn.ReadBulkString()
+	strCursor, _ := cn.ReadBulkString()
+	n, err := cn.ReadArrayLen()
+	if err != nil {
+		req.SetResponse(fmt.Errorf("error on reading header: %v", err), "readScanResponse")
+		return err
+	}
+	// Each object is listed as key, size, and modified time.
+	result := &scanResult{Objects: make([]ObjectInfo, n/3)}
+	for i := 0; i < n; i++ {
+		field, err := cn.ReadBulkString()
+		if err != nil {
+			req.SetResponse(fmt.Errorf("error on reading keys: %v", err), "readScanResponse")
+			return err
+		} else if i/3 >= len(result.Objects) {
+			continue
+		}
+		object := &result.Objects[i/3]
+		switch i % 3 {
+		case 0:
+			object.Key = field
+		case 1:
+			object.Size, _ = strconv.ParseInt(field, 10, 64)
+		case 2:
+			modified, _ := strconv.ParseInt(field, 10, 64)
+			object.Modified = time.Unix(modified, 0)
+		}
+	}
+
+	if respId != req.ReqId {
+		log.Warn("Unexpected response %s, expects %s", logger.SafeString(respId, len(req.ReqId)), req.ReqId)
+		req.SetResponse(ErrUnexpectedResponse, "readScanResponse")
+		return nil
+	}
+	result.Cursor, err = strconv.ParseUint(strCursor, 10, 64)
+	if err != nil {
+		req.SetResponse(fmt.Errorf("invalid cursor %s: %v", strCursor, err), "readScanResponse")
+		return nil
+	}
+
+	log.Debug("Scanned %s: %d keys, next %d", req.ReqId, len(result.Objects), result.Cursor)
+	req.SetResponse(result, "readScanResponse")
+	return nil
+}
+
 // func (c *Client) recover(addr string, key string, reqId string, size int, failed []int, shards [][]byte) {
 // 	var wg sync.WaitGroup
 // 	ret := newEcRet(c.Shards)
@@ -707,20 +1622,20 @@ func (c *Client) readGetResponse(req *ClientRequest) error {
 // 	}
 // }
 
-func (c *Client) encode(obj []byte) ([][]byte, error) {
+func (c *Client) encode(scheme *ecScheme, obj []byte) ([][]byte, error) {
 	// split obj first
-	shards, err := c.EC.Split(obj)
+	shards, err := scheme.EC.Split(obj)
 	if err != nil {
 		log.Warn("Encoding split err: %v", err)
 		return nil, err
 	}
 	// Encode parity
-	err = c.EC.Encode(shards)
+	err = scheme.EC.Encode(shards)
 	if err != nil {
 		log.Warn("Encoding encode err: %v", err)
 		return nil, err
 	}
-	ok, err := c.EC.Verify(shards)
+	ok, err := scheme.EC.Verify(shards)
 	if !ok {
 		log.Warn("Failed to verify encoding: %v", err)
 		return nil, err
@@ -729,9 +1644,9 @@ func (c *Client) encode(obj []byte) ([][]byte, error) {
 	return shards, err
 }
 
-func (c *Client) decode(stats *logEntry, data [][]byte, size int) (ReadAllCloser, error) {
+func (c *Client) decode(scheme *ecScheme, stats *logEntry, data [][]byte, size int) (ReadAllCloser, error) {
 	// var err error
-	stats.AllGood, _ = c.EC.Verify(data)
+	stats.AllGood, _ = scheme.EC.Verify(data)
 	if stats.AllGood {
 		log.Debug("No reconstruction needed.")
 		// } else if err != nil {
@@ -740,11 +1655,11 @@ func (c *Client) decode(stats *logEntry, data [][]byte, size int) (ReadAllCloser
 		// 	return nil, err
 	} else {
 		log.Debug("Verification failed. Reconstructing data...")
-		if err := c.EC.Reconstruct(data); err != nil {
+		if err := scheme.EC.Reconstruct(data); err != nil {
 			// log.Warn("Reconstruction failed: %v", err)
 			return nil, err
 		}
-		if good, err := c.EC.Verify(data); err != nil {
+		if good, err := scheme.EC.Verify(data); err != nil {
 			return nil, err
 		} else if !good {
 			// log.Warn("Verification failed after reconstruction, data could be corrupted: %v", err)
@@ -755,5 +1670,5 @@ func (c *Client) decode(stats *logEntry, data [][]byte, size int) (ReadAllCloser
 		log.Debug("Reconstructed")
 	}
 
-	return NewByteJoinReader(data, size, c.EC.Join), nil
+	return NewByteJoinReader(data, size, scheme.EC.Join), nil
 }
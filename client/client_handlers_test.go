@@ -0,0 +1,290 @@
+package client
+
+import (
+	"context"
+	sysnet "net"
+	"strconv"
+	"strings"
+	sysSync "sync"
+	"sync/atomic"
+
+	"github.com/mason-leap-lab/redeo/resp"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	protocol "github.com/sionreview/sion/common/types"
+)
+
+// testStore serves chunk requests of a connection like a proxy, keeping chunks in memory. Requests of the key "bad"
+// are rejected.
+type testStore struct {
+	chunks   sysSync.Map // key/chunkId -> chunk
+	sizes    sysSync.Map // key -> size
+	layouts  sysSync.Map // key -> layout of shards
+	codecs   sysSync.Map // key -> codec
+	served   int32       // Number of chunks served.
+	mu       sysSync.Mutex
+	versions map[string]int    // key -> version
+	setters  map[string]string // key -> reqId of the version
+}
+
+// version Returns the version set by the request, or false if the version expected is mismatched.
+func (s *testStore) version(key string, reqId string, expected string) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.versions == nil {
+		s.versions, s.setters = make(map[string]int), make(map[string]string)
+	}
+	if s.setters[key] == reqId {
+		return s.versions[key], true
+	} else if expected != strconv.Itoa(anyVersion) && expected != strconv.Itoa(s.versions[key]) {
+		return 0, false
+	}
+	s.versions[key]++
+	s.setters[key] = reqId
+	return s.versions[key], true
+}
+
+func (s *testStore) serve(conn sysnet.Conn) {
+	defer conn.Close()
+	r := resp.NewRequestReader(conn)
+	w := resp.NewResponseWriter(conn)
+	for {
+		cmd, err := r.StreamCmd(nil)
+		if err != nil {
+			return
+		}
+		// Values can be too long to read as a whole command.
+		args := make([]string, 0, cmd.ArgN())
+		for cmd.More() {
+			arg, err := cmd.Next()
+			if err != nil {
+				return
+			}
+			val, err := arg.ReadAll()
+			arg.Close()
+			if err != nil {
+				return
+			}
+			args = append(args, string(val))
+		}
+
+		seq, _ := strconv.ParseInt(args[0], 10, 64)
+		key, reqId := args[1], args[2]
+		w.AppendInt(seq)
+		switch {
+		case key == "bad":
+			w.AppendError("rejected")
+		case cmd.Name == protocol.CMD_SET_CHUNK:
+			// cmd seq key reqId size chunkId dataShards parityShards lambdaId maxLambda version ... replicated codec flags value
+			version, ok := s.version(key, reqId, args[9])
+			if !ok {
+				w.AppendError(ErrVersionConflict.Error())
+				break
+			}
+			chunkId := args[4]
+			layout := args[5] + "-" + args[6]
+			if args[13] == "true" {
+				data, _ := strconv.Atoi(args[5])
+				parity, _ := strconv.Atoi(args[6])
+				layout = "r" + strconv.Itoa(data+parity)
+			}
+			s.sizes.Store(key, args[3])
+			s.layouts.Store(key, layout)
+			s.codecs.Store(key, args[14])
+			s.chunks.Store(key+"/"+chunkId, []byte(args[16]))
+			w.AppendBulkString(reqId)
+			w.AppendBulkString(chunkId)
+			w.AppendBulkString(chunkId)
+			w.AppendBulkString(strconv.Itoa(version))
+		case cmd.Name == protocol.CMD_GET_CHUNK && len(args) > 5:
+			// cmd seq key reqId chunkId version offset length fragment. Only empty ranges are supported, which skip all
+			// chunks with the meta returned.
+			size, ok := s.sizes.Load(key)
+			if !ok {
+				w.AppendNil()
+				break
+			}
+			layout, _ := s.layouts.Load(key)
+			codec, _ := s.codecs.Load(key)
+			for _, field := range []string{reqId, size.(string), "1", "0", layout.(string), codec.(string), "", "-1"} {
+				w.AppendBulkString(field)
+			}
+		case cmd.Name == protocol.CMD_GET_CHUNK:
+			// cmd seq key reqId chunkId
+			chunkId := args[3]
+			size, _ := s.sizes.Load(key)
+			layout, _ := s.layouts.Load(key)
+			codec, _ := s.codecs.Load(key)
+			chunk, ok := s.chunks.Load(key + "/" + chunkId)
+			if !ok {
+				w.AppendNil()
+				break
+			}
+			for _, field := range []string{reqId, size.(string), "1", "0", layout.(string), codec.(string), "", chunkId} {
+				w.AppendBulkString(field)
+			}
+			w.AppendBulk(chunk.([]byte))
+			atomic.AddInt32(&s.served, 1)
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+var _ = Describe("Client", func() {
+	newTestEcRet := func(shards int) *ecRet {
+		ret := newEcRet(context.Background(), shards)
+		ret.Stats = &logEntry{}
+		ret.Stats.Begin("req")
+		ret.Add(shards)
+		for i := 0; i < shards; i++ {
+			ret.Request(i)
+		}
+		return ret
+	}
+
+	It("should serve replicated objects on the first replica", func() {
+		c := &Client{}
+		scheme := newEcScheme("", 2, 2, 1).Replicas
+		ret := newTestEcRet(scheme.Shards)
+
+		ret.Request(0).SetResponse(ErrCorrupted, "test")
+		go ret.Request(2).SetResponse([]byte("replica"), "test")
+		// Returns with request 1 outstanding.
+		ret.WaitFirst()
+		Expect(ret.NumOK()).To(Equal(1))
+		Expect(ret.FirstOK()).To(Equal(2))
+
+		ret.Abandon()
+		Expect(ret.Err).To(BeNil())
+		reader, err := c.decodeFragment(ret, scheme, 7)
+		Expect(err).To(BeNil())
+		data, err := reader.ReadAll()
+		Expect(err).To(BeNil())
+		Expect(string(data)).To(Equal("replica"))
+
+		// Outstanding requests are not sent, and their errors are discarded.
+		c.sendGet("localhost:0", "key", "req", 1, 0, nil, ret)
+		Expect(ret.Error(1)).To(Equal(ErrAbandon))
+		Expect(ret.Err).To(BeNil())
+		ret.Wait()
+	})
+
+	It("should wait for all requests if none succeeds", func() {
+		ret := newTestEcRet(2)
+		ret.Request(0).SetResponse(ErrCorrupted, "test")
+		go ret.Request(1).SetResponse(ErrNotFound, "test")
+		ret.WaitFirst()
+		Expect(ret.NumOK()).To(Equal(0))
+		Expect(ret.FirstOK()).To(Equal(-1))
+		Expect(ret.Error(1)).To(Equal(ErrNotFound))
+	})
+
+	It("should get and set objects of keys in batch", func() {
+		store := &testStore{}
+		lis := newTestProxy(store.serve)
+		defer lis.Close()
+
+		c := NewClient(2, 1, 1)
+		Expect(c.Dial([]string{lis.Addr().String()})).To(BeTrue())
+		defer c.Close()
+
+		errs := c.MSet(map[string][]byte{"key0": []byte("value0"), "key1": []byte("value1"), "bad": []byte("value")})
+		Expect(errs).To(HaveLen(3))
+		Expect(errs["key0"]).To(BeNil())
+		Expect(errs["key1"]).To(BeNil())
+		Expect(errs["bad"]).To(Equal(ErrClient))
+
+		// Results are in the order of keys, and errors are per key.
+		readers, getErrs := c.MGet([]string{"key1", "unknown", "key0", "bad"})
+		Expect(readers).To(HaveLen(4))
+		Expect(getErrs).To(Equal([]error{nil, ErrNotFound, nil, ErrClient}))
+		for i, expected := range map[int]string{0: "value1", 2: "value0"} {
+			data, err := readers[i].ReadAll()
+			Expect(err).To(BeNil())
+			Expect(string(data)).To(Equal(expected))
+		}
+		Expect(readers[1]).To(BeNil())
+		Expect(readers[3]).To(BeNil())
+	})
+
+	It("should bound operations in flight by windows of connections", func() {
+		c := NewClient(2, 1, 1)
+		c.Ring = NewMembership("127.0.0.1:1", "127.0.0.1:2").Ring
+		limit := int32(PipelineWindowSize * 2)
+
+		var inflight, max, done int32
+		release := make(chan struct{})
+		go func() {
+			defer close(release)
+			Eventually(func() int32 { return atomic.LoadInt32(&inflight) }).Should(Equal(limit))
+			// No more operation starts until any finishes.
+			Consistently(func() int32 { return atomic.LoadInt32(&inflight) }, "50ms").Should(Equal(limit))
+		}()
+		c.pipeline(10, func(i int) {
+			n := atomic.AddInt32(&inflight, 1)
+			for m := atomic.LoadInt32(&max); n > m && !atomic.CompareAndSwapInt32(&max, m, n); m = atomic.LoadInt32(&max) {
+			}
+			<-release
+			atomic.AddInt32(&inflight, -1)
+			atomic.AddInt32(&done, 1)
+		})
+		Expect(done).To(Equal(int32(10)))
+		Expect(max).To(Equal(limit))
+	})
+
+	It("should stat objects without reading them", func() {
+		store := &testStore{}
+		lis := newTestProxy(store.serve)
+		defer lis.Close()
+
+		c := NewClient(2, 1, 1)
+		Expect(c.UseCodec("flate")).To(BeNil())
+		Expect(c.Dial([]string{lis.Addr().String()})).To(BeTrue())
+		defer c.Close()
+
+		val := make([]byte, 5000)
+		_, _, err := c.EcSet("key", val)
+		Expect(err).To(BeNil())
+
+		_, meta, err := c.EcStat("key")
+		Expect(err).To(BeNil())
+		Expect(meta.Size).To(Equal(int64(5000)))
+		Expect(store.served).To(Equal(int32(0)))
+
+		_, _, err = c.EcStat("unknown")
+		Expect(err).To(Equal(ErrNotFound))
+	})
+
+	It("should set objects only if the version expected matches", func() {
+		store := &testStore{}
+		lis := newTestProxy(store.serve)
+		defer lis.Close()
+
+		c := NewClient(2, 1, 1)
+		Expect(c.Dial([]string{lis.Addr().String()})).To(BeTrue())
+		defer c.Close()
+
+		_, ver, err := c.EcSet("key", []byte("value"))
+		Expect(err).To(BeNil())
+		Expect(ver).To(Equal(1))
+
+		notExist := 0
+		_, _, err = c.EcSetContext(context.Background(), "key", []byte("value"), &SetOptions{IfVersion: &notExist})
+		Expect(err).To(Equal(ErrVersionConflict))
+
+		_, ver, err = c.EcSetContext(context.Background(), "key", []byte("value"), &SetOptions{IfVersion: &ver})
+		Expect(err).To(BeNil())
+		Expect(ver).To(Equal(2))
+	})
+
+	It("should reject streams of unknown sizes", func() {
+		c := NewClient(2, 1, 1)
+		defer c.Close()
+
+		_, _, err := c.EcSetStream("key", strings.NewReader("value"), -1)
+		Expect(err).To(Equal(ErrInvalidSize))
+	})
+})
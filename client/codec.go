@@ -0,0 +1,182 @@
+package client
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+	sysSync "sync"
+
+	protocol "github.com/sionreview/sion/common/types"
+)
+
+var (
+	ErrUnknownCodec = errors.New("unknown codec")
+	ErrCodecSize    = errors.New("size mismatched after decoding")
+
+	codecs   = map[string]Codec{}
+	codecsMu sysSync.RWMutex
+)
+
+func init() {
+	RegisterCodec(&FlateCodec{Level: flate.DefaultCompression})
+}
+
+// Codec Compresses objects before erasure coding. Codecs are identified by names stored along with objects, so objects
+// compressed can be read by any client that registered the codec.
+type Codec interface {
+	// Name returns the name of the codec.
+	Name() string
+
+	// Encode returns the compressed value.
+	Encode(val []byte) ([]byte, error)
+
+	// Decode returns the decompressed value of specified size. The size is read from the metadata of the object, so
+	// implementations should not trust it for allocation, and return ErrCodecSize if the value decoded mismatches.
+	Decode(val []byte, size int) ([]byte, error)
+}
+
+// RegisterCodec Register the codec by name, e.g. codecs of snappy or zstd.
+func RegisterCodec(codec Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+
+	codecs[codec.Name()] = codec
+}
+
+func getCodec(name string) (Codec, error) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	codec, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCodec, name)
+	}
+	return codec, nil
+}
+
+// FlateCodec Codec of the DEFLATE format, named "flate".
+type FlateCodec struct {
+	Level int
+}
+
+// Name Codec implementation
+func (c *FlateCodec) Name() string {
+	return "flate"
+}
+
+// Encode Codec implementation
+func (c *FlateCodec) Encode(val []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer, err := flate.NewWriter(&buf, c.Level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write(val); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode Codec implementation
+func (c *FlateCodec) Decode(val []byte, size int) ([]byte, error) {
+	if size < 0 {
+		return nil, ErrCodecSize
+	}
+	reader := flate.NewReader(bytes.NewReader(val))
+	defer reader.Close()
+
+	// Read one more byte to tell if the value decoded exceeds the size, and let the buffer grow with bytes decoded.
+	var decoded bytes.Buffer
+	decoded.Grow(len(val))
+	if _, err := decoded.ReadFrom(io.LimitReader(reader, int64(size)+1)); err != nil {
+		return nil, err
+	} else if decoded.Len() != size {
+		return nil, fmt.Errorf("%w: expects %d bytes", ErrCodecSize, size)
+	}
+	return decoded.Bytes(), nil
+}
+
+// compress compresses the value with the codec. The value is returned as is if not smaller after compression.
+// Returns the value to store and how the value is compressed, empty if not compressed.
+func compress(codec Codec, val []byte) ([]byte, string) {
+	if codec == nil || len(val) == 0 {
+		return val, ""
+	}
+	encoded, err := codec.Encode(val)
+	if err != nil {
+		log.Warn("Failed to compress with %s, stored as is: %v", codec.Name(), err)
+		return val, ""
+	} else if len(encoded) >= len(val) {
+		return val, ""
+	}
+	return encoded, protocol.FormatObjectCodec(codec.Name(), int64(len(val)))
+}
+
+// encodeValue compresses and then encrypts the value of the key if enabled. Returns the value to store and the stages
+// the value went through, empty if stored as is. Failing to encrypt fails the setting, so plaintext never leaves the
+// client.
+func (c *Client) encodeValue(key string, val []byte) ([]byte, string, error) {
+	val, stage := compress(c.codec, val)
+	if c.encryptor == nil {
+		return val, stage, nil
+	}
+	encrypted, err := c.encryptor.Encode(key, val)
+	if err != nil {
+		return nil, "", err
+	}
+	return encrypted, protocol.JoinObjectCodecs(stage, protocol.FormatObjectCodec(c.encryptor.Name(), int64(len(val)))), nil
+}
+
+// decodedSize returns the size of the object stored in specified size after reverting the stages of the codec.
+func decodedSize(rawCodec string, size int64) (int64, error) {
+	stages := protocol.SplitObjectCodecs(rawCodec)
+	if len(stages) == 0 {
+		return size, nil
+	}
+	// Stages are recorded with the size of the value they were applied to.
+	_, size, err := protocol.ParseObjectCodec(stages[0])
+	return size, err
+}
+
+// decodeValue reads all from the reader and reverts the stages specified by the codec of the object of the key.
+func (c *Client) decodeValue(key string, reader ReadAllCloser, rawCodec string) ([]byte, error) {
+	stages := protocol.SplitObjectCodecs(rawCodec)
+	codecs := make([]Codec, len(stages)) // nil for the stage of encryption.
+	sizes := make([]int, len(stages))
+	for i, stage := range stages {
+		name, size, err := protocol.ParseObjectCodec(stage)
+		if err == nil && name == EncryptionCodecName {
+			if c.encryptor == nil {
+				err = ErrNoKeyProvider
+			}
+		} else if err == nil {
+			codecs[i], err = getCodec(name)
+		}
+		if err != nil {
+			reader.Close()
+			return nil, err
+		}
+		sizes[i] = int(size)
+	}
+
+	val, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	for i := len(codecs) - 1; i >= 0; i-- {
+		if codecs[i] == nil {
+			val, err = c.encryptor.Decode(key, val, sizes[i])
+		} else {
+			val, err = codecs[i].Decode(val, sizes[i])
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return val, nil
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FlateCodec", func() {
+	codec := &FlateCodec{Level: 6}
+	val := bytes.Repeat([]byte("value"), 1000)
+
+	It("should decode values encoded", func() {
+		encoded, err := codec.Encode(val)
+		Expect(err).To(BeNil())
+		Expect(len(encoded)).To(BeNumerically("<", len(val)))
+
+		decoded, err := codec.Decode(encoded, len(val))
+		Expect(err).To(BeNil())
+		Expect(decoded).To(Equal(val))
+	})
+
+	It("should reject sizes mismatched", func() {
+		encoded, err := codec.Encode(val)
+		Expect(err).To(BeNil())
+
+		// Sizes are not trusted for allocation.
+		_, err = codec.Decode(encoded, 1<<40)
+		Expect(errors.Is(err, ErrCodecSize)).To(BeTrue())
+		_, err = codec.Decode(encoded, len(val)-1)
+		Expect(errors.Is(err, ErrCodecSize)).To(BeTrue())
+		_, err = codec.Decode(encoded, -1)
+		Expect(err).To(Equal(ErrCodecSize))
+	})
+
+	It("should read objects with or without the codec", func() {
+		store := &testStore{}
+		lis := newTestProxy(store.serve)
+		defer lis.Close()
+
+		plain := NewClient(2, 1, 1)
+		Expect(plain.Dial([]string{lis.Addr().String()})).To(BeTrue())
+		defer plain.Close()
+		compressed := NewClient(2, 1, 1)
+		Expect(compressed.UseCodec("flate")).To(BeNil())
+		Expect(compressed.Dial([]string{lis.Addr().String()})).To(BeTrue())
+		defer compressed.Close()
+
+		// Objects written before the codec is enabled are read as is.
+		_, _, err := plain.EcSet("plain", val)
+		Expect(err).To(BeNil())
+		_, _, err = compressed.EcSet("compressed", val)
+		Expect(err).To(BeNil())
+		size, _ := store.sizes.Load("compressed")
+		Expect(size).NotTo(Equal("5000"))
+
+		for _, c := range []*Client{plain, compressed} {
+			for _, key := range []string{"plain", "compressed"} {
+				_, reader, err := c.EcGet(key)
+				Expect(err).To(BeNil())
+				data, err := reader.ReadAll()
+				Expect(err).To(BeNil())
+				Expect(data).To(Equal(val))
+			}
+		}
+	})
+})
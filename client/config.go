@@ -15,4 +15,15 @@ var (
 
 	// Timeout The timeout for sending header fields, and reading response headers.
 	HeaderTimeout = 1 * time.Second
+
+	// PipelineWindowSize The number of requests in flight on a connection. Chunk requests of concurrent operations,
+	// e.g. MGet and MSet, are pipelined on connections to proxies.
+	PipelineWindowSize = 2
+
+	// HealthCheckInterval The interval of dialing proxies that are down.
+	HealthCheckInterval = 1 * time.Second
+
+	// SmallObjectThreshold Objects smaller than the threshold in bytes are stored as ParityShards+1 full replicas
+	// instead of being erasure coded, 0 to disable.
+	SmallObjectThreshold = 16 * 1024
 )
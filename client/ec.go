@@ -2,6 +2,7 @@ package client
 
 import (
 	"errors"
+	"fmt"
 	"io"
 
 	"github.com/klauspost/reedsolomon"
@@ -12,6 +13,44 @@ var (
 	ErrNotImplemented = errors.New("not implemented")
 )
 
+// ecScheme Erasure coding scheme of objects, either the default one of the client or the one of a storage class.
+type ecScheme struct {
+	EC           reedsolomon.Encoder
+	Class        string // Name of the storage class, empty for the default scheme.
+	DataShards   int
+	ParityShards int
+	Shards       int
+	Replicated   bool      // Shards are full replicas, DataShards is always 1.
+	Replicas     *ecScheme // Scheme to store small objects as replicas, tolerating the same number of losses.
+}
+
+func newEcScheme(class string, dataShards int, parityShards int, ecMaxGoroutine int) *ecScheme {
+	return &ecScheme{
+		EC:           NewEncoder(dataShards, parityShards, ecMaxGoroutine),
+		Class:        class,
+		DataShards:   dataShards,
+		ParityShards: parityShards,
+		Shards:       dataShards + parityShards,
+		Replicas: &ecScheme{
+			EC:           NewReplicaEncoder(parityShards + 1),
+			Class:        class,
+			DataShards:   1,
+			ParityShards: parityShards,
+			Shards:       parityShards + 1,
+			Replicated:   true,
+		},
+	}
+}
+
+// String returns the layout in the format "d-p", or "rN" for N replicas, which is the same as the one responded by
+// the proxy.
+func (s *ecScheme) String() string {
+	if s.Replicated {
+		return fmt.Sprintf("r%d", s.Shards)
+	}
+	return fmt.Sprintf("%d-%d", s.DataShards, s.ParityShards)
+}
+
 // NewEncoder Helper function to create a encoder
 func NewEncoder(dataShards int, parityShards int, ecMaxGoroutine int) reedsolomon.Encoder {
 	if parityShards == 0 {
@@ -130,3 +169,68 @@ func (enc *DummyEncoder) Join(dst io.Writer, shards [][]byte, outSize int) error
 	}
 	return nil
 }
+
+// ReplicaEncoder Encoder to store full replicas of small objects. It works as the DummyEncoder of one data shard,
+// while any of the replicas can be used as the data shard.
+type ReplicaEncoder struct {
+	DummyEncoder
+	Replicas int
+}
+
+// NewReplicaEncoder Helper function to create a replica encoder
+func NewReplicaEncoder(replicas int) *ReplicaEncoder {
+	return &ReplicaEncoder{DummyEncoder: DummyEncoder{DataShards: 1}, Replicas: replicas}
+}
+
+// Verify reedsolomon.Encoder implmentation, all replicas must be available.
+func (enc *ReplicaEncoder) Verify(shards [][]byte) (bool, error) {
+	if len(shards) != enc.Replicas {
+		return false, reedsolomon.ErrTooFewShards
+	}
+
+	for _, shard := range shards {
+		if len(shard) == 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Reconstruct reedsolomon.Encoder implmentation, lost replicas are restored from any available one.
+func (enc *ReplicaEncoder) Reconstruct(shards [][]byte) error {
+	var available []byte
+	for _, shard := range shards {
+		if len(shard) > 0 {
+			available = shard
+			break
+		}
+	}
+	if available == nil {
+		return reedsolomon.ErrTooFewShards
+	}
+
+	for i := range shards {
+		if len(shards[i]) == 0 {
+			shards[i] = available
+		}
+	}
+	return nil
+}
+
+// ReconstructData reedsolomon.Encoder implmentation
+func (enc *ReplicaEncoder) ReconstructData(shards [][]byte) error {
+	return enc.Reconstruct(shards)
+}
+
+// Split reedsolomon.Encoder implmentation, replicas share the same data.
+func (enc *ReplicaEncoder) Split(data []byte) ([][]byte, error) {
+	if len(data) == 0 {
+		return nil, reedsolomon.ErrShortData
+	}
+
+	dst := make([][]byte, enc.Replicas)
+	for i := range dst {
+		dst[i] = data
+	}
+	return dst, nil
+}
@@ -0,0 +1,40 @@
+package client
+
+import (
+	"bytes"
+
+	"github.com/klauspost/reedsolomon"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ReplicaEncoder", func() {
+	It("should split data into full replicas", func() {
+		enc := NewReplicaEncoder(3)
+		shards, err := enc.Split([]byte("replica"))
+		Expect(err).To(BeNil())
+		Expect(shards).To(HaveLen(3))
+		for _, shard := range shards {
+			Expect(string(shard)).To(Equal("replica"))
+		}
+		Expect(enc.Verify(shards)).To(BeTrue())
+
+		_, err = enc.Split(nil)
+		Expect(err).To(Equal(reedsolomon.ErrShortData))
+	})
+
+	It("should reconstruct lost replicas from any available one", func() {
+		enc := NewReplicaEncoder(3)
+		shards := [][]byte{nil, nil, []byte("replica")}
+		Expect(enc.Verify(shards)).To(BeFalse())
+		Expect(enc.Reconstruct(shards)).To(BeNil())
+		Expect(enc.Verify(shards)).To(BeTrue())
+		Expect(string(shards[0])).To(Equal("replica"))
+
+		var buf bytes.Buffer
+		Expect(enc.Join(&buf, shards, 4)).To(BeNil())
+		Expect(buf.String()).To(Equal("repl"))
+
+		Expect(enc.Reconstruct(make([][]byte, 3))).To(Equal(reedsolomon.ErrTooFewShards))
+	})
+})
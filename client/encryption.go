@@ -0,0 +1,208 @@
+package client
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	// EncryptionCodecName The name of the codec stage that encrypts objects, see UseEncryption.
+	EncryptionCodecName = "aes-gcm"
+
+	dataKeySize = 32 // AES-256
+)
+
+var (
+	ErrNoKeyProvider   = errors.New("no key provider to decrypt the object")
+	ErrUnknownKey      = errors.New("unknown master key")
+	ErrInvalidEnvelope = errors.New("invalid envelope")
+)
+
+// KeyProvider Wraps data keys of objects with master keys, e.g. keys managed by a KMS. Master keys never leave the
+// provider, only wrapped data keys are stored along with objects.
+type KeyProvider interface {
+	// WrapKey encrypts the data key with the active master key. Returns the id of the master key and the wrapped key.
+	WrapKey(dataKey []byte) (string, []byte, error)
+
+	// UnwrapKey decrypts the data key wrapped by the master key of the id.
+	UnwrapKey(keyId string, wrapped []byte) ([]byte, error)
+}
+
+// FileKeyProvider KeyProvider of master keys loaded from a local file. The file lists one key per line in the format
+// "id:hex", where hex is the 32 bytes key in hex. The last key is active for wrapping, and earlier keys are kept to unwrap
+// keys of objects set before rotation. Empty lines and lines start with "#" are ignored.
+type FileKeyProvider struct {
+	keys   map[string]cipher.AEAD
+	active string
+}
+
+// NewFileKeyProvider Load master keys from the file.
+func NewFileKeyProvider(path string) (*FileKeyProvider, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	provider := &FileKeyProvider{keys: make(map[string]cipher.AEAD)}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) < 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid key \"%s\": expects \"id:hex\"", parts[0])
+		}
+		key, err := hex.DecodeString(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %s: %v", parts[0], err)
+		}
+		if provider.keys[parts[0]], err = newGCM(key); err != nil {
+			return nil, fmt.Errorf("invalid key %s: %v", parts[0], err)
+		}
+		provider.active = parts[0]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	} else if provider.active == "" {
+		return nil, fmt.Errorf("no key found in %s", path)
+	}
+	return provider, nil
+}
+
+// WrapKey KeyProvider implementation. The id of the master key is authenticated along with the data key.
+func (p *FileKeyProvider) WrapKey(dataKey []byte) (string, []byte, error) {
+	wrapped, err := seal(p.keys[p.active], dataKey, []byte(p.active))
+	return p.active, wrapped, err
+}
+
+// UnwrapKey KeyProvider implementation
+func (p *FileKeyProvider) UnwrapKey(keyId string, wrapped []byte) ([]byte, error) {
+	gcm, ok := p.keys[keyId]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, keyId)
+	}
+	return open(gcm, wrapped, []byte(keyId))
+}
+
+// envelopeCodec Encrypts objects with AES-GCM by a data key generated per object. The data key wrapped by the key
+// provider is stored in the envelope ahead of the encrypted object:
+// [key id length(1)][key id][wrapped key length(2)][wrapped key][nonce][encrypted object]
+// The header of the envelope, the key and the size of the object are authenticated along with the object, so neither
+// the header nor the envelope can be swapped with those of another object. Versions are assigned by proxies after
+// encryption and can not be authenticated, so an envelope can only be replaced by that of another version of the object.
+type envelopeCodec struct {
+	provider KeyProvider
+}
+
+// Name Codec implementation
+func (c *envelopeCodec) Name() string {
+	return EncryptionCodecName
+}
+
+// Encode Encrypts the value of the object of the key.
+func (c *envelopeCodec) Encode(key string, val []byte) ([]byte, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	keyId, wrapped, err := c.provider.WrapKey(dataKey)
+	if err != nil {
+		return nil, err
+	} else if len(keyId) > 0xFF || len(wrapped) > 0xFFFF {
+		return nil, fmt.Errorf("%w: key id or wrapped key too long", ErrInvalidEnvelope)
+	}
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 3+len(keyId)+len(wrapped))
+	header[0] = byte(len(keyId))
+	copy(header[1:], keyId)
+	binary.BigEndian.PutUint16(header[1+len(keyId):], uint16(len(wrapped)))
+	copy(header[3+len(keyId):], wrapped)
+	sealed, err := seal(gcm, val, envelopeAAD(header, key, len(val)))
+	if err != nil {
+		return nil, err
+	}
+	return append(header, sealed...), nil
+}
+
+// Decode Decrypts the value of the object of the key, which is of specified size after decryption.
+func (c *envelopeCodec) Decode(key string, val []byte, size int) ([]byte, error) {
+	if len(val) < 1 || len(val) < 3+int(val[0]) {
+		return nil, ErrInvalidEnvelope
+	}
+	keyId := string(val[1 : 1+val[0]])
+	wrappedLen := int(binary.BigEndian.Uint16(val[1+val[0]:]))
+	headerLen := 3 + len(keyId) + wrappedLen
+	if len(val) < headerLen {
+		return nil, ErrInvalidEnvelope
+	}
+	header := val[:headerLen]
+	wrapped := val[3+len(keyId) : headerLen]
+	val = val[headerLen:]
+
+	dataKey, err := c.provider.UnwrapKey(keyId, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	decrypted, err := open(gcm, val, envelopeAAD(header, key, size))
+	if err != nil {
+		return nil, err
+	} else if len(decrypted) != size {
+		return nil, fmt.Errorf("%w: expects %d bytes, got %d", ErrInvalidEnvelope, size, len(decrypted))
+	}
+	return decrypted, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// envelopeAAD returns the additional data authenticated along with the object: the header of the envelope, which is
+// self-delimited, followed by the key and the size of the object.
+func envelopeAAD(header []byte, key string, size int) []byte {
+	aad := make([]byte, len(header)+len(key)+8)
+	copy(aad, header)
+	copy(aad[len(header):], key)
+	binary.BigEndian.PutUint64(aad[len(header)+len(key):], uint64(size))
+	return aad
+}
+
+// seal encrypts the plaintext with a random nonce prepended, and authenticates the additional data.
+func seal(gcm cipher.AEAD, plaintext []byte, aad []byte) ([]byte, error) {
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(plaintext)+gcm.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+// open decrypts the ciphertext sealed by seal with the same additional data.
+func open(gcm cipher.AEAD, sealed []byte, aad []byte) ([]byte, error) {
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrInvalidEnvelope
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], aad)
+}
@@ -0,0 +1,123 @@
+package client
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Encryption", func() {
+	var dir string
+
+	const (
+		key1 = "key1:000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+		key2 = "key2:1f1e1d1c1b1a191817161514131211100f0e0d0c0b0a09080706050403020100"
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "encryption")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	newCodec := func(name string, keys ...string) *envelopeCodec {
+		path := filepath.Join(dir, name)
+		content := ""
+		for _, key := range keys {
+			content += key + "\n"
+		}
+		Expect(os.WriteFile(path, []byte(content), 0600)).To(BeNil())
+		provider, err := NewFileKeyProvider(path)
+		Expect(err).To(BeNil())
+		return &envelopeCodec{provider: provider}
+	}
+
+	It("should decrypt objects encrypted", func() {
+		codec := newCodec("keys", key1)
+		encrypted, err := codec.Encode("foo", []byte("value"))
+		Expect(err).To(BeNil())
+		Expect(string(encrypted)).NotTo(ContainSubstring("value"))
+
+		decrypted, err := codec.Decode("foo", encrypted, 5)
+		Expect(err).To(BeNil())
+		Expect(string(decrypted)).To(Equal("value"))
+	})
+
+	It("should decrypt objects encrypted by keys rotated", func() {
+		old := newCodec("old", key1)
+		encrypted, err := old.Encode("foo", []byte("value"))
+		Expect(err).To(BeNil())
+
+		rotated := newCodec("rotated", key1, key2)
+		decrypted, err := rotated.Decode("foo", encrypted, 5)
+		Expect(err).To(BeNil())
+		Expect(string(decrypted)).To(Equal("value"))
+
+		// New objects are encrypted by the active key.
+		encrypted, err = rotated.Encode("foo", []byte("value"))
+		Expect(err).To(BeNil())
+		Expect(string(encrypted[1 : 1+encrypted[0]])).To(Equal("key2"))
+		_, err = old.Decode("foo", encrypted, 5)
+		Expect(errors.Is(err, ErrUnknownKey)).To(BeTrue())
+	})
+
+	It("should reject envelopes tampered", func() {
+		codec := newCodec("keys", key1)
+		encrypted, err := codec.Encode("foo", []byte("value"))
+		Expect(err).To(BeNil())
+		another, err := codec.Encode("bar", []byte("value"))
+		Expect(err).To(BeNil())
+
+		// Any byte flipped, including bytes of the wrapped key.
+		for _, i := range []int{10, len(encrypted) - 1} {
+			tampered := append([]byte{}, encrypted...)
+			tampered[i] ^= 1
+			_, err = codec.Decode("foo", tampered, 5)
+			Expect(err).NotTo(BeNil())
+		}
+		// Envelopes swapped between objects.
+		_, err = codec.Decode("foo", another, 5)
+		Expect(err).NotTo(BeNil())
+		// Sizes altered.
+		_, err = codec.Decode("foo", encrypted, 4)
+		Expect(err).NotTo(BeNil())
+		// Envelopes truncated.
+		_, err = codec.Decode("foo", encrypted[:2], 5)
+		Expect(err).To(Equal(ErrInvalidEnvelope))
+	})
+
+	It("should reject objects swapped in the store", func() {
+		store := &testStore{}
+		lis := newTestProxy(store.serve)
+		defer lis.Close()
+
+		c := NewClient(2, 1, 1)
+		c.encryptor = newCodec("keys", key1)
+		Expect(c.Dial([]string{lis.Addr().String()})).To(BeTrue())
+		defer c.Close()
+
+		_, _, err := c.EcSet("foo", []byte("value"))
+		Expect(err).To(BeNil())
+		_, _, err = c.EcSet("bar", []byte("value"))
+		Expect(err).To(BeNil())
+		_, reader, err := c.EcGet("foo")
+		Expect(err).To(BeNil())
+		data, err := reader.ReadAll()
+		Expect(err).To(BeNil())
+		Expect(string(data)).To(Equal("value"))
+
+		chunk, _ := store.chunks.Load("bar/0")
+		store.chunks.Store("foo/0", chunk)
+		chunk, _ = store.chunks.Load("bar/1")
+		store.chunks.Store("foo/1", chunk)
+		_, _, err = c.EcGet("foo")
+		Expect(err).NotTo(BeNil())
+	})
+})
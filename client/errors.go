@@ -7,4 +7,6 @@ var (
 	ErrInvalidNumFragments = errors.New("invalid number of fragments")
 	ErrAbandon             = errors.New("late chunk abandoned")
 	ErrCorrupted           = errors.New("data corrupted")
+	ErrVersionConflict     = errors.New("version conflict")
+	ErrVersionedFragments  = errors.New("versioned reading of fragmented object is not supported")
 )
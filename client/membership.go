@@ -0,0 +1,352 @@
+package client
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	sysnet "net"
+	"os"
+	"strings"
+	sysSync "sync"
+	"time"
+
+	"github.com/buraksezer/consistent"
+	"github.com/sionreview/sion/common/net"
+	protocol "github.com/sionreview/sion/common/types"
+)
+
+var (
+	ErrNoProxy          = errors.New("no proxy available")
+	ErrProxyUnavailable = errors.New("proxy unavailable")
+)
+
+// Discoverer Source of proxy addresses.
+type Discoverer interface {
+	// Discover returns addresses of all proxies.
+	Discover() ([]string, error)
+}
+
+// DNSDiscoverer Discovers proxies by resolving the DNS name, proxies listen on the same port.
+type DNSDiscoverer struct {
+	Name string
+	Port int
+}
+
+// Discover Discoverer implementation
+func (d *DNSDiscoverer) Discover() ([]string, error) {
+	hosts, err := sysnet.LookupHost(d.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := make([]string, len(hosts))
+	for i, host := range hosts {
+		addrs[i] = sysnet.JoinHostPort(host, fmt.Sprint(d.Port))
+	}
+	return addrs, nil
+}
+
+// FileDiscoverer Discovers proxies from the file listing one address per line. Empty lines and lines start with "#"
+// are ignored.
+type FileDiscoverer struct {
+	Path string
+}
+
+// Discover Discoverer implementation
+func (d *FileDiscoverer) Discover() ([]string, error) {
+	file, err := os.Open(d.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var addrs []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			addrs = append(addrs, line)
+		}
+	}
+	return addrs, scanner.Err()
+}
+
+// Membership Proxies that keys are distributed over. A proxy failed to connect is removed from the ring, so keys are
+// rerouted to other proxies, until the proxy passes the health check. Membership can be shared by clients, e.g. clients
+// of a PooledClient.
+type Membership struct {
+	Ring *consistent.Consistent
+
+	proxies  map[string]bool // All known proxies, true if the proxy is up.
+	slots    []string        // Proxies owning hash slots in order, see UseHashSlots.
+	checking bool            // The health check is running.
+	closed   chan struct{}
+	mu       sysSync.Mutex
+
+	// Handlers called on proxies removed, e.g. to close connections of clients sharing the membership.
+	removeHandlers map[int]func(string)
+	nextHandler    int
+}
+
+// NewMembership Create a membership of specified proxies.
+func NewMembership(addrs ...string) *Membership {
+	m := &Membership{
+		Ring:           consistent.New(nil, ECConfig),
+		proxies:        make(map[string]bool),
+		closed:         make(chan struct{}),
+		removeHandlers: make(map[int]func(string)),
+	}
+	for _, addr := range addrs {
+		m.Add(addr)
+	}
+	return m
+}
+
+// Add Add the proxy. A known proxy that is down will be added back to the ring.
+func (m *Membership) Add(addr string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if up := m.proxies[addr]; !up {
+		m.proxies[addr] = true
+		m.Ring.Add(clientMember(addr))
+	}
+}
+
+// join adds the proxy only if the proxy is unknown.
+func (m *Membership) join(addr string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.proxies[addr]; !ok {
+		m.proxies[addr] = true
+		m.Ring.Add(clientMember(addr))
+	}
+}
+
+// Remove Remove the proxy. Handlers registered by OnRemove are called if the proxy is known.
+func (m *Membership) Remove(addr string) {
+	m.mu.Lock()
+	_, ok := m.proxies[addr]
+	delete(m.proxies, addr)
+	m.Ring.Remove(addr)
+	handlers := make([]func(string), 0, len(m.removeHandlers))
+	for _, handler := range m.removeHandlers {
+		handlers = append(handlers, handler)
+	}
+	m.mu.Unlock()
+
+	if !ok {
+		return
+	}
+	for _, handler := range handlers {
+		handler(addr)
+	}
+}
+
+// OnRemove Register the handler called with the address of the proxy removed. Returns a function to unregister the
+// handler.
+func (m *Membership) OnRemove(handler func(addr string)) func() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := m.nextHandler
+	m.nextHandler++
+	m.removeHandlers[id] = handler
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.removeHandlers, id)
+	}
+}
+
+// Update Add proxies not known yet and remove proxies not listed.
+func (m *Membership) Update(addrs []string) {
+	listed := make(map[string]struct{}, len(addrs))
+	for _, addr := range addrs {
+		listed[addr] = struct{}{}
+		m.join(addr)
+	}
+	for _, addr := range m.Proxies() {
+		if _, ok := listed[addr]; !ok {
+			m.Remove(addr)
+			log.Info("Proxy %s removed.", addr)
+		}
+	}
+}
+
+// Proxies Returns all known proxies, including those are down.
+func (m *Membership) Proxies() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	addrs := make([]string, 0, len(m.proxies))
+	for addr := range m.proxies {
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
+
+// UseHashSlots Locate keys by hash slots of Redis Cluster evenly assigned to the proxies in order, so keys are served
+// by the proxies that own them in a cluster of proxies. Keys of a proxy that is down are rerouted by the ring. Must be
+// called before the membership is used.
+func (m *Membership) UseHashSlots(addrs ...string) {
+	m.slots = addrs
+	for _, addr := range addrs {
+		m.join(addr)
+	}
+}
+
+// Locate Get the address of the proxy that serves the key, ErrNoProxy if all proxies are down.
+func (m *Membership) Locate(key string) (string, error) {
+	if addr, ok := m.locateSlot(key); ok {
+		return addr, nil
+	}
+	member := m.Ring.GetPartitionOwner(Hasher.PartitionID([]byte(key)))
+	if member == nil {
+		return "", ErrNoProxy
+	}
+	return member.String(), nil
+}
+
+// locateSlot returns the proxy owning the hash slot of the key, false if hash slots are not used or the proxy is down.
+func (m *Membership) locateSlot(key string) (string, bool) {
+	if len(m.slots) == 0 {
+		return "", false
+	}
+
+	addr := m.slots[protocol.SlotOwner(protocol.HashSlot(key), len(m.slots))]
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return addr, m.proxies[addr]
+}
+
+// MarkDown Remove the proxy from the ring until it passes the health check.
+func (m *Membership) MarkDown(addr string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if up := m.proxies[addr]; !up {
+		// Unknown or down already.
+		return
+	}
+	m.proxies[addr] = false
+	m.Ring.Remove(addr)
+	log.Warn("Proxy %s is down, keys are rerouted.", addr)
+
+	if !m.checking {
+		m.checking = true
+		go m.healthCheck()
+	}
+}
+
+// Watch Synchronize proxies with the discoverer every interval until the membership is closed.
+func (m *Membership) Watch(discoverer Discoverer, interval time.Duration) error {
+	if err := m.discover(discoverer); err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.closed:
+				return
+			case <-ticker.C:
+				if err := m.discover(discoverer); err != nil {
+					log.Warn("Failed to discover proxies: %v", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// Close Stop the health check and watching.
+func (m *Membership) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	select {
+	case <-m.closed:
+	default:
+		close(m.closed)
+	}
+}
+
+func (m *Membership) discover(discoverer Discoverer) error {
+	addrs, err := discoverer.Discover()
+	if err != nil {
+		return err
+	} else if len(addrs) == 0 {
+		// Keep proxies on transient failures of the source.
+		return ErrNoProxy
+	}
+	m.Update(addrs)
+	return nil
+}
+
+// healthCheck dials proxies that are down every HealthCheckInterval, and stops once all proxies are up.
+func (m *Membership) healthCheck() {
+	ticker := time.NewTicker(HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.closed:
+			return
+		case <-ticker.C:
+		}
+
+		down := m.down()
+		if len(down) == 0 {
+			return
+		}
+		for _, addr := range down {
+			if isProxyHealthy(addr) {
+				m.markUp(addr)
+			}
+		}
+	}
+}
+
+// down returns proxies that are down, the health check will be flagged stopped if none.
+func (m *Membership) down() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var addrs []string
+	for addr, up := range m.proxies {
+		if !up {
+			addrs = append(addrs, addr)
+		}
+	}
+	if len(addrs) == 0 {
+		m.checking = false
+	}
+	return addrs
+}
+
+func (m *Membership) markUp(addr string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if up, ok := m.proxies[addr]; ok && !up {
+		m.proxies[addr] = true
+		m.Ring.Add(clientMember(addr))
+		log.Info("Proxy %s is up.", addr)
+	}
+}
+
+func isProxyHealthy(addr string) bool {
+	if _, ok := net.Shortcut.Validate(addr); ok {
+		return true
+	}
+
+	conn, err := sysnet.DialTimeout("tcp", addr, HeaderTimeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
@@ -0,0 +1,112 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	sysnet "net"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/sionreview/sion/common/redeo/client"
+)
+
+// newTestProxy listens on a random port and handles accepted connections. Connections are kept open if handle is nil.
+func newTestProxy(handle func(sysnet.Conn)) sysnet.Listener {
+	lis, err := sysnet.Listen("tcp", "127.0.0.1:0")
+	Expect(err).To(BeNil())
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			if handle != nil {
+				go handle(conn)
+			}
+		}
+	}()
+	return lis
+}
+
+var _ = Describe("Membership", func() {
+	It("should close connections of clients to proxies removed", func() {
+		lis := newTestProxy(nil)
+		defer lis.Close()
+		addr := lis.Addr().String()
+
+		members := NewMembership()
+		defer members.Close()
+		clients := []*Client{NewClient(2, 1, 1), NewClient(2, 1, 1)}
+		var conns []*client.Conn
+		for _, c := range clients {
+			c.UseMembership(members)
+			Expect(c.Dial([]string{addr})).To(BeTrue())
+			defer c.Close()
+			conns = append(conns, c.conns[addr]...)
+		}
+		Expect(conns).To(HaveLen(6))
+
+		members.Remove(addr)
+		for _, c := range clients {
+			c.connsMu.RLock()
+			Expect(c.conns).NotTo(HaveKey(addr))
+			c.connsMu.RUnlock()
+		}
+		for _, cn := range conns {
+			Expect(cn.IsClosed()).To(BeTrue())
+		}
+
+		// Closed clients are no longer notified.
+		clients[0].Close()
+		members.Add(addr)
+		_, err := clients[0].validate(addr, 0)
+		Expect(err).To(BeNil())
+		members.Remove(addr)
+		Expect(clients[0].conns).To(HaveKey(addr))
+	})
+
+	It("should mark the proxy down on connection errors", func() {
+		c := NewClient(2, 1, 1)
+		c.members = NewMembership("127.0.0.1:1", "127.0.0.1:2")
+		defer c.members.Close()
+
+		Expect(c.failover("127.0.0.1:1", &ecRet{Err: ErrNotFound})).To(BeFalse())
+		Expect(c.failover("127.0.0.1:1", &ecRet{Err: os.ErrDeadlineExceeded})).To(BeFalse())
+		Expect(c.failover("127.0.0.1:1", &ecRet{Err: fmt.Errorf("stop attempts: %v, last error %w", ErrMaxPreflightsReached, client.ErrConnectionClosed)})).To(BeTrue())
+		Expect(c.members.Locate("key")).To(Equal("127.0.0.1:2"))
+		Expect(c.failover("127.0.0.1:2", &ecRet{Err: io.EOF})).To(BeTrue())
+		_, err := c.members.Locate("key")
+		Expect(err).To(Equal(ErrNoProxy))
+	})
+
+	It("should reroute requests if the proxy closes established connections", func() {
+		// Proxies close the connection on the first request.
+		closing := func(conn sysnet.Conn) {
+			conn.Read(make([]byte, 1))
+			conn.Close()
+		}
+		lis1 := newTestProxy(closing)
+		defer lis1.Close()
+		lis2 := newTestProxy(closing)
+		defer lis2.Close()
+		addr1, addr2 := lis1.Addr().String(), lis2.Addr().String()
+
+		c := NewClient(2, 1, 1)
+		Expect(c.Dial([]string{addr1, addr2})).To(BeTrue())
+		defer c.Close()
+
+		// Find a key served by the first proxy.
+		key := "key0"
+		for i := 1; c.Locate(key) != addr1; i++ {
+			key = fmt.Sprintf("key%d", i)
+		}
+
+		// The request is rerouted to the second proxy, which fails again.
+		_, err := c.EcDel(key)
+		Expect(err).To(Equal(ErrClient))
+		Expect(c.members.Proxies()).To(ConsistOf(addr1, addr2))
+		Expect(c.Locate(key)).To(Equal(addr2))
+	})
+})
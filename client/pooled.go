@@ -1,6 +1,9 @@
 package client
 
 import (
+	"io"
+	"time"
+
 	"github.com/sionreview/sion/common/sync"
 )
 
@@ -17,8 +20,9 @@ type PooledClient struct {
 	// Max goroutine used by Erasure Coding
 	ECMaxGoroutine int
 
-	addrs []string
-	pool  *sync.Pool
+	addrs   []string
+	members *Membership
+	pool    *sync.Pool
 }
 
 func NewPooledClient(addrArr []string, options ...func(*PooledClient)) *PooledClient {
@@ -28,6 +32,7 @@ func NewPooledClient(addrArr []string, options ...func(*PooledClient)) *PooledCl
 		NumParityShards: 2,
 		ECMaxGoroutine:  32,
 		addrs:           addrArr,
+		members:         NewMembership(),
 	}
 	if len(options) > 0 {
 		for _, option := range options {
@@ -38,6 +43,7 @@ func NewPooledClient(addrArr []string, options ...func(*PooledClient)) *PooledCl
 	cli.pool = sync.InitPool(&sync.Pool{
 		New: func() interface{} {
 			c := NewClient(cli.NumDataShards, cli.NumParityShards, cli.ECMaxGoroutine)
+			c.UseMembership(cli.members)
 			c.Dial(cli.addrs)
 			return c
 		},
@@ -57,14 +63,95 @@ func (c *PooledClient) Get(key string) (ReadAllCloser, error) {
 	return reader, err
 }
 
+// GetVersion gets specified version of the object, use 0 for the latest version. The version read is returned.
+func (c *PooledClient) GetVersion(key string, ver int) (ReadAllCloser, int, error) {
+	cli := c.pool.Get().(*Client)
+	defer c.pool.Put(cli)
+
+	_, version, reader, err := cli.EcGetVersion(key, ver)
+	return reader, version, err
+}
+
+// GetRange gets at most length bytes of the object starting from the offset, fetching only chunks covering the range.
+func (c *PooledClient) GetRange(key string, offset int64, length int64) (ReadAllCloser, error) {
+	cli := c.pool.Get().(*Client)
+	defer c.pool.Put(cli)
+
+	_, reader, err := cli.EcGetRange(key, offset, length)
+	return reader, err
+}
+
+// MGet gets objects of keys concurrently, see Client.MGet. Readers and errors are returned in the order of keys.
+func (c *PooledClient) MGet(keys []string) ([]ReadAllCloser, []error) {
+	cli := c.pool.Get().(*Client)
+	defer c.pool.Put(cli)
+
+	return cli.MGet(keys)
+}
+
 func (c *PooledClient) Set(key string, val []byte) error {
 	cli := c.pool.Get().(*Client)
 	defer c.pool.Put(cli)
 
-	_, err := cli.EcSet(key, val)
+	_, _, err := cli.EcSet(key, val)
+	return err
+}
+
+// SetStream sets the object of specified size from the reader without holding the whole object in memory.
+func (c *PooledClient) SetStream(key string, r io.Reader, size int64) error {
+	cli := c.pool.Get().(*Client)
+	defer c.pool.Put(cli)
+
+	_, _, err := cli.EcSetStream(key, r, size)
 	return err
 }
 
+// SetIfVersion sets the object only if the latest version matches specified version. The version created is returned.
+func (c *PooledClient) SetIfVersion(key string, val []byte, ver int) (int, error) {
+	cli := c.pool.Get().(*Client)
+	defer c.pool.Put(cli)
+
+	_, version, err := cli.EcSetIfVersion(key, val, ver)
+	return version, err
+}
+
+// MSet sets objects of keys concurrently, see Client.MSet. Errors are returned indexed by keys.
+func (c *PooledClient) MSet(objects map[string][]byte) map[string]error {
+	cli := c.pool.Get().(*Client)
+	defer c.pool.Put(cli)
+
+	return cli.MSet(objects)
+}
+
+func (c *PooledClient) Del(key string) error {
+	cli := c.pool.Get().(*Client)
+	defer c.pool.Put(cli)
+
+	_, err := cli.EcDel(key)
+	return err
+}
+
+// AddProxy adds the proxy shared by pooled clients, which connect the proxy on demand.
+func (c *PooledClient) AddProxy(addr string) {
+	c.members.Add(addr)
+}
+
+// RemoveProxy removes the proxy shared by pooled clients, which close connections to the proxy.
+func (c *PooledClient) RemoveProxy(addr string) {
+	c.members.Remove(addr)
+}
+
+// Watch synchronizes proxies with the discoverer every interval until the client is closed.
+func (c *PooledClient) Watch(discoverer Discoverer, interval time.Duration) error {
+	return c.members.Watch(discoverer, interval)
+}
+
+// Membership returns proxies shared by pooled clients.
+func (c *PooledClient) Membership() *Membership {
+	return c.members
+}
+
 func (c *PooledClient) Close() {
 	c.pool.Close()
+	c.members.Close()
 }
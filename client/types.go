@@ -2,6 +2,8 @@ package client
 
 import (
 	"context"
+	"strconv"
+	"time"
 
 	"github.com/sionreview/sion/common/redeo/client"
 )
@@ -32,3 +34,95 @@ func (r *ClientRequest) Conn() *client.Conn {
 func (r *ClientRequest) SetConn(cn *client.Conn) {
 	r.cn = cn
 }
+
+// SetOptions Options for setting an object.
+type SetOptions struct {
+	// TTL The time to live of the object, the object never expires if not specified.
+	TTL time.Duration
+
+	// DryRun Generate placements among specified number of lambda stores without sending requests, 0 to disable.
+	DryRun int
+
+	// Placements If specified, placements of the first fragment will be filled on success or in dry run mode.
+	// The length of Placements must be no less than the number of shards.
+	Placements []int
+
+	// KeepPlacements Keep Placements untouched in dry run mode.
+	KeepPlacements bool
+
+	// Class The name of the storage class registered by Client.UseStorageClasses. The default erasure coding is used
+	// if not specified.
+	Class string
+
+	// Flags Opaque flags stored along with the object, e.g. flags of memcached, see Client.EcGetMeta.
+	Flags uint32
+
+	// IfVersion If specified, the object is set only if the latest version matches, see Client.EcSetIfVersion.
+	// Not supported on streaming objects in fragments.
+	IfVersion *int
+}
+
+// ObjectMeta Metadata stored along with the object.
+type ObjectMeta struct {
+	// Version The version of the object.
+	Version int
+
+	// Flags Opaque flags set by SetOptions.Flags.
+	Flags uint32
+
+	// Size The size of the object as set, regardless of compression or encryption.
+	Size int64
+}
+
+// objectAttrs Attributes sent along with chunks of the object.
+type objectAttrs struct {
+	Codec string // Stages the object went through, see ecRetMeta.Codec.
+	Flags uint32
+}
+
+func newObjectAttrs(codec string, opts *SetOptions) *objectAttrs {
+	attrs := &objectAttrs{Codec: codec}
+	if opts != nil {
+		attrs.Flags = opts.Flags
+	}
+	return attrs
+}
+
+// parseFlags parses flags of the object, 0 if not set.
+func parseFlags(raw string) uint32 {
+	flags, _ := strconv.ParseUint(raw, 10, 32)
+	return uint32(flags)
+}
+
+// ObjectInfo Information of the object listed by Client.ScanObjects.
+type ObjectInfo struct {
+	// Key The key of the object.
+	Key string
+
+	// Size The size of the object as set, regardless of compression or encryption.
+	Size int64
+
+	// Modified The time the object was set, in seconds.
+	Modified time.Time
+}
+
+// GetOptions Options for getting an object.
+type GetOptions struct {
+	// DryRun Return without sending requests if greater than 0.
+	DryRun int
+}
+
+// newSetOptions converts legacy arguments in order of [dryrun [placements ["Reset"]]].
+func newSetOptions(args []interface{}) *SetOptions {
+	opts := &SetOptions{}
+	if len(args) > 0 {
+		opts.DryRun, _ = args[0].(int)
+	}
+	if len(args) > 1 {
+		opts.Placements, _ = args[1].([]int)
+	}
+	if len(args) > 2 {
+		opts.KeepPlacements = args[2] == "Reset"
+	}
+	return opts
+}
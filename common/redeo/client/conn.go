@@ -80,6 +80,11 @@ func (conn *Conn) StartRequest(req Request, writes ...RequestWriter) (err error)
 		return conn.writeEnd(req, ErrConnectionClosed)
 	}
 
+	// Abort if the request was responded (e.g. cancelled) while waiting for the window.
+	if reason, ok := req.IsResponded(); ok {
+		return conn.writeEnd(req, fmt.Errorf("%v: %s", ErrResponded, reason))
+	}
+
 	// Both calback writer and request writer (Flush) are supported.
 	conn.SetWriteDeadline(time.Now().Add(DefaultTimeout))
 	for _, write := range writes {
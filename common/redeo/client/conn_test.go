@@ -5,6 +5,7 @@ import (
 	//"testing"
 	//"time"
 
+	"context"
 	"io"
 	"time"
 
@@ -114,6 +115,47 @@ var _ = Describe("Connection", func() {
 		conn.Close()
 	})
 
+	It("Should startRequest skip sending if the request responded while waiting for the window", func() {
+		net.InitShortcut()
+		shortcut := net.Shortcut.Prepare("shortcut", 1, 1)
+		mockconn := shortcut.Validate(0).Conns[0]
+		conn := NewConn(mockconn.Client)
+		conn.SetWindowSize(1)
+
+		go func() {
+			// consume the first request only
+			buff := make([]byte, 1024)
+			mockconn.Server.Read(buff)
+		}()
+
+		req1 := NewRequest()
+		err := conn.StartRequest(req1, func(_ Request) error {
+			conn.WriteBulkString("test")
+			return nil
+		})
+		Expect(err).To(BeNil())
+
+		req2 := NewRequest()
+		chErr := make(chan error)
+		go func() {
+			chErr <- conn.StartRequest(req2, func(_ Request) error {
+				conn.WriteBulkString("test")
+				return nil
+			})
+		}()
+
+		<-time.After(100 * time.Millisecond)
+		req2.SetResponse(context.Canceled, "context done")
+		req1.SetResponse("OK", "test")
+
+		err = shouldNotTimeout(func() interface{} { return <-chErr }).(error)
+		Expect(err.Error()).To(ContainSubstring(ErrResponded.Error()))
+		_, err = req2.Response()
+		Expect(err).To(Equal(context.Canceled))
+
+		conn.Close()
+	})
+
 	It("Should close the connection correctly", func() {
 		net.InitShortcut()
 		shortcut := net.Shortcut.Prepare("shortcut", 1, 1)
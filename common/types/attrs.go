@@ -0,0 +1,54 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ObjectAttrs Attributes of the object a chunk belongs to. Proxies send them along with chunks, and nodes report them in
+// the inventory as they are, so objects can be rebuilt from chunks without metas, see ChunkInventory.
+type ObjectAttrs struct {
+	// Size of the object in bytes as set, before erasure coding.
+	Size int64 `json:"size"`
+
+	// Number of data chunks, 1 for replicated objects.
+	DChunks int `json:"d"`
+
+	// Number of parity chunks, or the number of replicas less 1 for replicated objects.
+	PChunks int `json:"p"`
+
+	// Name of the storage class, empty for the default.
+	Class string `json:"class,omitempty"`
+
+	// Chunks are full replicas of the object.
+	Replicated bool `json:"replicated,omitempty"`
+
+	// Number of fragments of a large object, 0 if not fragmented.
+	NumFrags int `json:"frags,omitempty"`
+
+	// Stages the object went through, see FormatObjectCodec.
+	Codec string `json:"codec,omitempty"`
+
+	// Opaque flags set by the client.
+	ClientFlags uint32 `json:"flags,omitempty"`
+
+	// Time in unix nano when the object expires, 0 if the object never expires.
+	ExpireAt int64 `json:"expire,omitempty"`
+}
+
+// FormatObjectAttrs formats attributes to be stored along with chunks.
+func FormatObjectAttrs(attrs *ObjectAttrs) string {
+	raw, _ := json.Marshal(attrs)
+	return string(raw)
+}
+
+// ParseObjectAttrs parses attributes in the format of FormatObjectAttrs.
+func ParseObjectAttrs(raw string) (*ObjectAttrs, error) {
+	var attrs ObjectAttrs
+	if err := json.Unmarshal([]byte(raw), &attrs); err != nil {
+		return nil, fmt.Errorf("invalid object attributes \"%s\": %v", raw, err)
+	} else if attrs.Size < 0 || attrs.DChunks < 1 || attrs.PChunks < 0 {
+		return nil, fmt.Errorf("invalid object attributes \"%s\"", raw)
+	}
+	return &attrs, nil
+}
@@ -0,0 +1,21 @@
+package types_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/sionreview/sion/common/types"
+)
+
+var _ = Describe("ObjectAttrs", func() {
+	It("should parse attributes formatted", func() {
+		attrs := &ObjectAttrs{Size: 100, DChunks: 1, PChunks: 2, Class: "hot", Replicated: true, Codec: "flate:100", ClientFlags: 5}
+		parsed, err := ParseObjectAttrs(FormatObjectAttrs(attrs))
+		Expect(err).To(BeNil())
+		Expect(parsed).To(Equal(attrs))
+
+		for _, raw := range []string{"", "size", `{"size":100}`, `{"size":-1,"d":1}`} {
+			_, err = ParseObjectAttrs(raw)
+			Expect(err).To(Not(BeNil()), raw)
+		}
+	})
+})
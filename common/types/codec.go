@@ -0,0 +1,45 @@
+package types
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ObjectCodecSeparator separates stages of the codec, e.g. compression followed by encryption.
+const ObjectCodecSeparator = ","
+
+// FormatObjectCodec formats a stage of the codec in the format "name:size", where size is the size of the object
+// before the stage.
+func FormatObjectCodec(name string, size int64) string {
+	return fmt.Sprintf("%s:%d", name, size)
+}
+
+// ParseObjectCodec parses a stage of the codec in the format accepted by FormatObjectCodec.
+func ParseObjectCodec(raw string) (name string, size int64, err error) {
+	parts := strings.SplitN(raw, ":", 2)
+	if len(parts) < 2 || parts[0] == "" {
+		return "", 0, fmt.Errorf("invalid codec \"%s\"", raw)
+	}
+	size, err = strconv.ParseInt(parts[1], 10, 64)
+	return parts[0], size, err
+}
+
+// JoinObjectCodecs joins stages of the codec in the order applied, empty stages are skipped.
+func JoinObjectCodecs(stages ...string) string {
+	joined := make([]string, 0, len(stages))
+	for _, stage := range stages {
+		if stage != "" {
+			joined = append(joined, stage)
+		}
+	}
+	return strings.Join(joined, ObjectCodecSeparator)
+}
+
+// SplitObjectCodecs splits the codec into stages in the order applied.
+func SplitObjectCodecs(raw string) []string {
+	if raw == "" {
+		return nil
+	}
+	return strings.Split(raw, ObjectCodecSeparator)
+}
@@ -0,0 +1,28 @@
+package types_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/sionreview/sion/common/types"
+)
+
+var _ = Describe("ObjectCodec", func() {
+	It("should parse the codec", func() {
+		name, size, err := ParseObjectCodec(FormatObjectCodec("flate", 100))
+		Expect(err).To(BeNil())
+		Expect(name).To(Equal("flate"))
+		Expect(size).To(Equal(int64(100)))
+
+		for _, raw := range []string{"", "flate", ":100", "flate:x"} {
+			_, _, err = ParseObjectCodec(raw)
+			Expect(err).To(Not(BeNil()), raw)
+		}
+	})
+
+	It("should join and split stages of the codec", func() {
+		raw := JoinObjectCodecs("", FormatObjectCodec("flate", 100), FormatObjectCodec("aes-gcm", 40))
+		Expect(raw).To(Equal("flate:100,aes-gcm:40"))
+		Expect(SplitObjectCodecs(raw)).To(Equal([]string{"flate:100", "aes-gcm:40"}))
+		Expect(SplitObjectCodecs("")).To(BeEmpty())
+	})
+})
@@ -0,0 +1,95 @@
+package types
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidRange = errors.New("invalid range")
+)
+
+// ParseObjectSize parses the size of the object in the format "size[-fragments]". Large objects are stored in fragments,
+// each fragment is a sub-object of the key postfixed with "-i" except the first one.
+func ParseObjectSize(raw string) (size int64, numFrags int, err error) {
+	parts := strings.SplitN(raw, "-", 2)
+	size, err = strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	numFrags = 1
+	if len(parts) > 1 {
+		numFrags, err = strconv.Atoi(parts[1])
+	}
+	return
+}
+
+// FormatObjectSize formats the size of the object in the format accepted by ParseObjectSize.
+func FormatObjectSize(size int64, numFrags int) string {
+	if numFrags > 1 {
+		return strconv.FormatInt(size, 10) + "-" + strconv.Itoa(numFrags)
+	}
+	return strconv.FormatInt(size, 10)
+}
+
+// ChunkRange Data chunks of a fragment that cover a byte range of the object.
+type ChunkRange struct {
+	First int   // The first chunk.
+	Last  int   // The last chunk, less than First if the fragment holds nothing of the range.
+	Start int64 // Where the range starts in the joined chunks from First to Last.
+	End   int64 // Where the range ends in the joined chunks from First to Last, exclusive.
+}
+
+// LocateRange locates the range [offset, offset+length) of the object in data chunks of specified fragment. The object is
+// split evenly into fragments except the last one, and each fragment is split evenly into d data chunks except the last one.
+func LocateRange(size int64, numFrags int, frag int, d int, offset int64, length int64) ChunkRange {
+	fragStart, fragSize := FragmentOf(size, numFrags, frag)
+	start, end := offset-fragStart, offset+length-fragStart
+	if start < 0 {
+		start = 0
+	}
+	if end > fragSize {
+		end = fragSize
+	}
+	if start >= end || d < 1 {
+		return ChunkRange{First: 0, Last: -1}
+	}
+
+	chunkSize := (fragSize + int64(d) - 1) / int64(d)
+	first := start / chunkSize
+	return ChunkRange{
+		First: int(first),
+		Last:  int((end - 1) / chunkSize),
+		Start: start - first*chunkSize,
+		End:   end - first*chunkSize,
+	}
+}
+
+// FragmentOf returns where the fragment starts in the object and the size of the fragment.
+func FragmentOf(size int64, numFrags int, frag int) (int64, int64) {
+	if numFrags < 1 {
+		numFrags = 1
+	}
+	fragSize := (size + int64(numFrags) - 1) / int64(numFrags)
+	start := fragSize * int64(frag)
+	if start >= size {
+		return size, 0
+	} else if start+fragSize > size {
+		fragSize = size - start
+	}
+	return start, fragSize
+}
+
+// Len returns the number of chunks in the range.
+func (r ChunkRange) Len() int {
+	if r.Last < r.First {
+		return 0
+	}
+	return r.Last - r.First + 1
+}
+
+// Contains returns true if the chunk is in the range.
+func (r ChunkRange) Contains(chunk int) bool {
+	return chunk >= r.First && chunk <= r.Last
+}
@@ -0,0 +1,64 @@
+package types_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/sionreview/sion/common/types"
+)
+
+var _ = Describe("ChunkRange", func() {
+	It("should parse the size of objects", func() {
+		size, numFrags, err := ParseObjectSize("100")
+		Expect(err).To(BeNil())
+		Expect(size).To(Equal(int64(100)))
+		Expect(numFrags).To(Equal(1))
+
+		size, numFrags, err = ParseObjectSize("100-3")
+		Expect(err).To(BeNil())
+		Expect(size).To(Equal(int64(100)))
+		Expect(numFrags).To(Equal(3))
+		Expect(FormatObjectSize(size, numFrags)).To(Equal("100-3"))
+		Expect(FormatObjectSize(size, 1)).To(Equal("100"))
+
+		_, _, err = ParseObjectSize("")
+		Expect(err).To(Not(BeNil()))
+	})
+
+	It("should locate fragments", func() {
+		start, size := FragmentOf(100, 3, 0)
+		Expect([]int64{start, size}).To(Equal([]int64{0, 34}))
+		start, size = FragmentOf(100, 3, 2)
+		Expect([]int64{start, size}).To(Equal([]int64{68, 32}))
+		_, size = FragmentOf(100, 3, 3)
+		Expect(size).To(Equal(int64(0)))
+	})
+
+	It("should locate chunks covering the range", func() {
+		// 100 bytes in 4 chunks of 25 bytes.
+		r := LocateRange(100, 1, 0, 4, 30, 40)
+		Expect(r).To(Equal(ChunkRange{First: 1, Last: 2, Start: 5, End: 45}))
+		Expect(r.Len()).To(Equal(2))
+		Expect(r.Contains(0)).To(BeFalse())
+		Expect(r.Contains(2)).To(BeTrue())
+
+		// Range beyond the object is truncated.
+		r = LocateRange(100, 1, 0, 4, 90, 40)
+		Expect(r).To(Equal(ChunkRange{First: 3, Last: 3, Start: 15, End: 25}))
+
+		Expect(LocateRange(100, 1, 0, 4, 100, 10).Len()).To(Equal(0))
+		Expect(LocateRange(100, 1, 0, 4, 10, 0).Len()).To(Equal(0))
+	})
+
+	It("should locate chunks in fragments", func() {
+		// Fragments of 34, 34, and 32 bytes, in chunks of 17, 17, and 16 bytes.
+		r := LocateRange(100, 3, 0, 2, 30, 10)
+		Expect(r).To(Equal(ChunkRange{First: 1, Last: 1, Start: 13, End: 17}))
+		r = LocateRange(100, 3, 1, 2, 30, 10)
+		Expect(r).To(Equal(ChunkRange{First: 0, Last: 0, Start: 0, End: 6}))
+		r = LocateRange(100, 3, 2, 2, 30, 10)
+		Expect(r.Len()).To(Equal(0))
+
+		r = LocateRange(100, 3, 2, 2, 90, 100)
+		Expect(r).To(Equal(ChunkRange{First: 1, Last: 1, Start: 6, End: 16}))
+	})
+})
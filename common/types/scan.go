@@ -0,0 +1,11 @@
+package types
+
+import (
+	"github.com/cespare/xxhash"
+)
+
+// ScanOrder returns the position of the key in the order of scanning. Keys are scanned in the same order on all proxies,
+// so a cursor can be shared to scan multiple proxies.
+func ScanOrder(key string) uint64 {
+	return xxhash.Sum64String(key)
+}
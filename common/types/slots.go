@@ -0,0 +1,51 @@
+package types
+
+import "strings"
+
+// NumHashSlots is the number of hash slots of Redis Cluster.
+const NumHashSlots = 16384
+
+// HashSlot returns the hash slot of the key as Redis Cluster does. If the key contains a non-empty hash tag enclosed by
+// the first "{" and the following "}", only the hash tag is hashed, so keys of the same hash tag share the slot.
+func HashSlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key) % NumHashSlots)
+}
+
+// SlotOwner returns the index of the node that owns the slot. Slots are evenly assigned to nodes in contiguous ranges.
+func SlotOwner(slot int, numNodes int) int {
+	if numNodes < 1 {
+		return 0
+	}
+	return slot * numNodes / NumHashSlots
+}
+
+// SlotRange returns the first and the last slot owned by the node of specified index.
+func SlotRange(node int, numNodes int) (int, int) {
+	if numNodes < 1 {
+		numNodes = 1
+	}
+	first := (node*NumHashSlots + numNodes - 1) / numNodes
+	last := ((node+1)*NumHashSlots+numNodes-1)/numNodes - 1
+	return first, last
+}
+
+// crc16 implements CRC16-CCITT (XMODEM) used by Redis Cluster.
+func crc16(s string) uint16 {
+	crc := uint16(0)
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
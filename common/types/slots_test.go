@@ -0,0 +1,37 @@
+package types_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/sionreview/sion/common/types"
+)
+
+var _ = Describe("HashSlot", func() {
+	It("should hash keys as Redis Cluster does", func() {
+		Expect(HashSlot("123456789")).To(Equal(0x31C3 % NumHashSlots))
+		Expect(HashSlot("foo")).To(Equal(12182))
+		Expect(HashSlot("bar")).To(Equal(5061))
+	})
+
+	It("should hash only hash tags", func() {
+		Expect(HashSlot("{user1000}.following")).To(Equal(HashSlot("user1000")))
+		// Empty hash tags are ignored, the whole key is hashed.
+		Expect(HashSlot("foo{}{bar}")).NotTo(Equal(HashSlot("bar")))
+		Expect(HashSlot("foo{{bar}}zap")).To(Equal(HashSlot("{bar")))
+		Expect(HashSlot("foo{bar}{zap}")).To(Equal(HashSlot("bar")))
+	})
+
+	It("should assign slots to nodes in ranges", func() {
+		for _, n := range []int{1, 2, 3, 7} {
+			next := 0
+			for i := 0; i < n; i++ {
+				first, last := SlotRange(i, n)
+				Expect(first).To(Equal(next))
+				Expect(SlotOwner(first, n)).To(Equal(i))
+				Expect(SlotOwner(last, n)).To(Equal(i))
+				next = last + 1
+			}
+			Expect(next).To(Equal(NumHashSlots))
+		}
+	})
+})
@@ -0,0 +1,129 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PersistencePolicy How chunks of objects are persisted to COS.
+type PersistencePolicy int
+
+const (
+	// PERSIST_DEFAULT Follow the feature flags of the lambda, see FLAG_DISABLE_WAIT_FOR_COS.
+	PERSIST_DEFAULT PersistencePolicy = iota
+	// PERSIST_NO_COS Keep chunks in memory only. Chunks lost are reconstructed from other chunks of the object.
+	PERSIST_NO_COS
+	// PERSIST_ASYNC_COS Acknowledge chunks before they are persisted to COS.
+	PERSIST_ASYNC_COS
+	// PERSIST_WAIT_COS Acknowledge chunks after they are persisted to COS.
+	PERSIST_WAIT_COS
+)
+
+var (
+	ErrInvalidStorageClass = errors.New("invalid storage class")
+	ErrUnknownStorageClass = errors.New("unknown storage class")
+
+	persistencePolicies = []string{"", "no-cos", "async-cos", "wait-cos"}
+)
+
+// ParsePersistencePolicy parses the policy of name "no-cos", "async-cos", or "wait-cos".
+func ParsePersistencePolicy(name string) (PersistencePolicy, bool) {
+	for i, policy := range persistencePolicies {
+		if policy == name {
+			return PersistencePolicy(i), true
+		}
+	}
+	return PERSIST_DEFAULT, false
+}
+
+func (p PersistencePolicy) String() string {
+	if p < 0 || int(p) >= len(persistencePolicies) {
+		return strconv.Itoa(int(p))
+	}
+	return persistencePolicies[p]
+}
+
+// IsCOSEnabled returns true if chunks are persisted to COS.
+func (p PersistencePolicy) IsCOSEnabled() bool {
+	return p != PERSIST_NO_COS
+}
+
+// StorageClass defines how objects are erasure coded and persisted.
+type StorageClass struct {
+	Name         string
+	DataShards   int
+	ParityShards int
+	Persistence  PersistencePolicy
+}
+
+// ParseStorageClass parses the class in the format "name: d=4,p=1,no-cos". The persistence policy is optional.
+func ParseStorageClass(spec string) (*StorageClass, error) {
+	parts := strings.SplitN(spec, ":", 2)
+	class := &StorageClass{Name: strings.TrimSpace(parts[0])}
+	if class.Name == "" || len(parts) < 2 {
+		return nil, fmt.Errorf("%w \"%s\": expects \"name: d=4,p=1,no-cos\"", ErrInvalidStorageClass, spec)
+	}
+
+	for _, option := range strings.Split(parts[1], ",") {
+		option = strings.TrimSpace(option)
+		var err error
+		if strings.HasPrefix(option, "d=") {
+			class.DataShards, err = strconv.Atoi(option[2:])
+		} else if strings.HasPrefix(option, "p=") {
+			class.ParityShards, err = strconv.Atoi(option[2:])
+		} else if policy, ok := ParsePersistencePolicy(option); ok && option != "" {
+			class.Persistence = policy
+		} else {
+			err = errors.New("unknown option")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w %s: %s, %v", ErrInvalidStorageClass, class.Name, option, err)
+		}
+	}
+
+	if class.DataShards < 1 || class.ParityShards < 0 {
+		return nil, fmt.Errorf("%w %s: d must be positive and p must not be negative", ErrInvalidStorageClass, class.Name)
+	}
+	return class, nil
+}
+
+// Shards returns the number of chunks of objects in the class.
+func (c *StorageClass) Shards() int {
+	return c.DataShards + c.ParityShards
+}
+
+func (c *StorageClass) String() string {
+	if c.Persistence == PERSIST_DEFAULT {
+		return fmt.Sprintf("%s: d=%d,p=%d", c.Name, c.DataShards, c.ParityShards)
+	}
+	return fmt.Sprintf("%s: d=%d,p=%d,%v", c.Name, c.DataShards, c.ParityShards, c.Persistence)
+}
+
+// StorageClasses Storage classes indexed by name.
+type StorageClasses map[string]*StorageClass
+
+// ParseStorageClasses parses classes in the format accepted by ParseStorageClass.
+func ParseStorageClasses(specs []string) (StorageClasses, error) {
+	classes := make(StorageClasses, len(specs))
+	for _, spec := range specs {
+		class, err := ParseStorageClass(spec)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := classes[class.Name]; ok {
+			return nil, fmt.Errorf("%w %s: defined more than once", ErrInvalidStorageClass, class.Name)
+		}
+		classes[class.Name] = class
+	}
+	return classes, nil
+}
+
+// Persistence returns the persistence policy of the class, PERSIST_DEFAULT if the class is not defined.
+func (classes StorageClasses) Persistence(name string) PersistencePolicy {
+	if class, ok := classes[name]; ok {
+		return class.Persistence
+	}
+	return PERSIST_DEFAULT
+}
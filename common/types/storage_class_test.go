@@ -0,0 +1,48 @@
+package types_test
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/sionreview/sion/common/types"
+)
+
+var _ = Describe("StorageClass", func() {
+	It("should parse the class", func() {
+		class, err := ParseStorageClass("hot: d=4,p=1,no-cos")
+		Expect(err).To(BeNil())
+		Expect(*class).To(Equal(StorageClass{Name: "hot", DataShards: 4, ParityShards: 1, Persistence: PERSIST_NO_COS}))
+		Expect(class.Shards()).To(Equal(5))
+		Expect(class.String()).To(Equal("hot: d=4,p=1,no-cos"))
+
+		class, err = ParseStorageClass("durable:d=10, p=2, wait-cos")
+		Expect(err).To(BeNil())
+		Expect(*class).To(Equal(StorageClass{Name: "durable", DataShards: 10, ParityShards: 2, Persistence: PERSIST_WAIT_COS}))
+
+		// Persistence policy is optional.
+		class, err = ParseStorageClass("plain: d=2,p=0")
+		Expect(err).To(BeNil())
+		Expect(class.Persistence).To(Equal(PERSIST_DEFAULT))
+		Expect(class.Persistence.IsCOSEnabled()).To(BeTrue())
+	})
+
+	It("should reject invalid classes", func() {
+		for _, spec := range []string{"", "hot", ": d=4,p=1", "hot: p=1", "hot: d=4,p=-1", "hot: d=x,p=1", "hot: d=4,p=1,cos"} {
+			_, err := ParseStorageClass(spec)
+			Expect(errors.Is(err, ErrInvalidStorageClass)).To(BeTrue(), spec)
+		}
+	})
+
+	It("should parse classes indexed by name", func() {
+		classes, err := ParseStorageClasses([]string{"hot: d=4,p=1,no-cos", "durable: d=10,p=2,wait-cos"})
+		Expect(err).To(BeNil())
+		Expect(len(classes)).To(Equal(2))
+		Expect(classes.Persistence("hot")).To(Equal(PERSIST_NO_COS))
+		Expect(classes.Persistence("durable")).To(Equal(PERSIST_WAIT_COS))
+		Expect(classes.Persistence("nonexistent")).To(Equal(PERSIST_DEFAULT))
+
+		_, err = ParseStorageClasses([]string{"hot: d=4,p=1", "hot: d=2,p=1"})
+		Expect(errors.Is(err, ErrInvalidStorageClass)).To(BeTrue())
+	})
+})
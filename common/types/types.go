@@ -39,6 +39,10 @@ func (i *InputEvent) IsWaitForCOSDisabled() bool {
 	return (i.Flags & FLAG_DISABLE_WAIT_FOR_COS) > 0
 }
 
+func (i *InputEvent) IsInventoryRequested() bool {
+	return (i.Flags & FLAG_REPORT_INVENTORY) > 0
+}
+
 type Status struct {
 	Capacity  uint64 `json:"cap"`
 	Mem       uint64 `json:"mem"`
@@ -93,6 +97,32 @@ type ShortMeta struct {
 	Hash string `json:"hash"`
 }
 
+// ChunkInventory A chunk stored on the node.
+type ChunkInventory struct {
+	// Key of the chunk in the format "chunkId@key@vN".
+	Key string `json:"key"`
+
+	// Chunk id of the object.
+	Id string `json:"id"`
+
+	Size uint64 `json:"size"`
+
+	// Lineage term of last write operation.
+	Term uint64 `json:"term"`
+
+	// Checksum of the chunk, 0 if unknown.
+	Checksum uint64 `json:"checksum"`
+
+	// Attributes of the object in the format of FormatObjectAttrs, empty if unknown.
+	Attrs string `json:"attrs,omitempty"`
+}
+
+// InventoryPayload The payload of PONG_INVENTORY. Meta is included if PONG_RECONCILE is set.
+type InventoryPayload struct {
+	Meta   ShortMeta        `json:"meta"`
+	Chunks []ChunkInventory `json:"chunks"`
+}
+
 type OutputError struct {
 	Message string `json:"errorMessage"`
 	Type    string `json:"errorType"`
@@ -120,6 +150,8 @@ const (
 	FLAG_BACKING_ONLY = 0x1000
 	// FLAG_DISABLE_WAIT_FOR_COS Disable waiting for COS on PUT chunks.
 	FLAG_DISABLE_WAIT_FOR_COS = 0x2000
+	// FLAG_REPORT_INVENTORY Report chunks stored on PONG for the proxy to rebuild metas.
+	FLAG_REPORT_INVENTORY = 0x4000
 
 	// PONG_FOR_DATA Pong for data link
 	PONG_FOR_DATA = int64(0x0000)
@@ -137,6 +169,8 @@ const (
 
 	// PONG_RECONCILE Pong with reconcile meta included.
 	PONG_RECONCILE = int64(0x0100)
+	// PONG_INVENTORY Pong with chunks stored included, the payload is InventoryPayload.
+	PONG_INVENTORY = int64(0x0200)
 
 	CMD_TEST           = "test"
 	CMD_ACK            = "ack"            // Control command
@@ -147,9 +181,10 @@ const (
 	CMD_PERSISTED      = "persisted"      // Control command
 	CMD_PERSIST_FAILED = "persist failed" // Control command
 	CMD_RECOVER        = "recover"        // Control command
-	CMD_DEL            = "del"            // Control command
+	CMD_DEL            = "del"            // Redis and Control command
+	CMD_DEL_CHUNK      = "del chunk"      // Client command
 	CMD_WARMUP         = "warmup"         // Control command
-	CMD_PING           = "ping"           // Control command
+	CMD_PING           = "ping"           // Redis and Control command
 	CMD_PONG           = "pong"           // Control command
 	CMD_RECOVERED      = "recovered"      // Control command
 	CMD_INITMIGRATE    = "initMigrate"    // Control command
@@ -157,6 +192,16 @@ const (
 	CMD_MHELLO         = "mhello"         // Control command
 	CMD_DATA           = "data"           // Control command
 	CMD_BYE            = "bye"            // Control command
+	CMD_EXISTS         = "exists"         // Redis command
+	CMD_STRLEN         = "strlen"         // Redis command
+	CMD_MGET           = "mget"           // Redis command
+	CMD_MSET           = "mset"           // Redis command
+	CMD_INFO           = "info"           // Redis command
+	CMD_SCAN           = "scan"           // Redis command
+	CMD_KEYS           = "keys"           // Redis command
+	CMD_SCAN_KEYS      = "scan keys"      // Client command
+	CMD_GETRANGE       = "getrange"       // Redis command
+	CMD_CLUSTER        = "cluster"        // Redis command
 
 	REQUEST_GET_OPTIONAL      = 0x0001 // Flag response is optional. There is a compete fallback will eventually fulfill the request.
 	REQUEST_GET_OPTION_BUFFER = 0x0002 // Flag the chunk should be put in buffer area.
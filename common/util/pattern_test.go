@@ -0,0 +1,42 @@
+package util
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MatchPattern", func() {
+	It("should match literals and wildcards", func() {
+		Expect(MatchPattern("foo", "foo")).To(BeTrue())
+		Expect(MatchPattern("foo", "foobar")).To(BeFalse())
+		Expect(MatchPattern("*", "")).To(BeTrue())
+		Expect(MatchPattern("foo*", "foo/bar")).To(BeTrue())
+		Expect(MatchPattern("*bar", "foobar")).To(BeTrue())
+		Expect(MatchPattern("f*o*r", "foobar")).To(BeTrue())
+		Expect(MatchPattern("f*o*z", "foobar")).To(BeFalse())
+		Expect(MatchPattern("h?llo", "hello")).To(BeTrue())
+		Expect(MatchPattern("h?llo", "hllo")).To(BeFalse())
+	})
+
+	It("should match character classes", func() {
+		Expect(MatchPattern("h[ae]llo", "hallo")).To(BeTrue())
+		Expect(MatchPattern("h[ae]llo", "hillo")).To(BeFalse())
+		Expect(MatchPattern("h[^e]llo", "hallo")).To(BeTrue())
+		Expect(MatchPattern("h[^e]llo", "hello")).To(BeFalse())
+		Expect(MatchPattern("h[a-c]llo", "hbllo")).To(BeTrue())
+		Expect(MatchPattern("h[a-c]llo", "hdllo")).To(BeFalse())
+	})
+
+	It("should match escaped characters literally", func() {
+		Expect(MatchPattern("foo\\*", "foo*")).To(BeTrue())
+		Expect(MatchPattern("foo\\*", "foobar")).To(BeFalse())
+		Expect(MatchPattern("h[\\]]llo", "h]llo")).To(BeTrue())
+	})
+
+	It("should quote strings to match literally", func() {
+		Expect(QuotePattern("foo")).To(Equal("foo"))
+		Expect(QuotePattern("a*b?[c]\\")).To(Equal("a\\*b\\?\\[c\\]\\\\"))
+		Expect(MatchPattern(QuotePattern("a*b?[c]\\")+"*", "a*b?[c]\\/foo")).To(BeTrue())
+		Expect(MatchPattern(QuotePattern("a*")+"*", "abc")).To(BeFalse())
+	})
+})
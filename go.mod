@@ -11,6 +11,7 @@ require (
 	github.com/dustin/go-humanize v1.0.0
 	github.com/gizak/termui/v3 v3.1.0
 	github.com/google/uuid v1.2.0
+	github.com/gookit/config/v2 v2.1.2
 	github.com/hidez8891/shm v0.0.0-20200313135933-0ec4df5f28c7
 	github.com/jordwest/mock-conn v0.0.0-20180617021051-4896c6bd1641
 	github.com/kelindar/binary v1.0.9
@@ -28,7 +29,6 @@ require (
 	github.com/bsm/pool v0.8.1 // indirect
 	github.com/dchest/siphash v1.1.0 // indirect
 	github.com/fsnotify/fsnotify v1.4.9 // indirect
-	github.com/gookit/config/v2 v2.1.2 // indirect
 	github.com/gookit/goutil v0.5.2 // indirect
 	github.com/imdario/mergo v0.3.13 // indirect
 	github.com/jmespath/go-jmespath v0.4.0 // indirect
@@ -161,6 +161,7 @@ func HandleRequest(ctx context.Context, input protocol.InputEvent) (protocol.Sta
 	var payload []byte
 	if store.Lineage == nil {
 		// PONG represents the node is ready to serve, no fast recovery required.
+		flags, payload = handlers.AttachInventory(&input, flags, payload)
 		handlers.Pong.SendWithFlags(flags, payload)
 	} else {
 		log.Debug("Input meta: %v", input.Status)
@@ -204,6 +205,9 @@ func HandleRequest(ctx context.Context, input protocol.InputEvent) (protocol.Sta
 			}
 		}
 
+		// Chunks not yet recovered are reported by later pongs.
+		flags, payload = handlers.AttachInventory(&input, flags, payload)
+
 		// Recover if inconsistent
 		if inconsistency == 0 {
 			// PONG represents the node is ready to serve, no fast recovery required.
@@ -472,6 +476,7 @@ func pingHandler(w resp.ResponseWriter, c *resp.Command) {
 			payload, _ = binary.Marshal(status.ShortStatus())
 		}
 	}
+	flags, payload = handlers.AttachInventory(session.Input, flags, payload)
 	handlers.Pong.SendWithFlags(flags, payload)
 	if cancelPong {
 		handlers.Pong.Cancel() // Not really cancel the sending of a pong, notify no request is expected.
@@ -35,6 +35,30 @@ func BuildPiggyback(response *worker.ObjectResponse) {
 	}
 }
 
+// AttachInventory attaches chunks stored to the pong if requested by the proxy. The reconcile meta in the payload, if any,
+// is kept.
+func AttachInventory(input *protocol.InputEvent, flags int64, payload []byte) (int64, []byte) {
+	if input == nil || !input.IsInventoryRequested() {
+		return flags, payload
+	}
+	reporter, ok := Store.(types.InventoryReporter)
+	if !ok {
+		return flags, payload
+	}
+
+	inventory := &protocol.InventoryPayload{Chunks: reporter.Inventory()}
+	if flags&protocol.PONG_RECONCILE > 0 {
+		binary.Unmarshal(payload, &inventory.Meta)
+	}
+	attached, err := binary.Marshal(inventory)
+	if err != nil {
+		log.Warn("Failed to attach inventory: %v", err)
+		return flags, payload
+	}
+	log.Debug("Attaching inventory: %d chunks", len(inventory.Chunks))
+	return flags | protocol.PONG_WITH_PAYLOAD | protocol.PONG_INVENTORY, attached
+}
+
 func GetDefaultExtension(session *lambdaLife.Session) time.Duration {
 	extension := Server.GetStats().RTT() * 2 // Expecting new requests to arrive within RTT.
 	if extension < lambdaLife.TICK_EXTENSION {
@@ -46,6 +70,35 @@ func GetDefaultExtension(session *lambdaLife.Session) time.Duration {
 	return extension
 }
 
+// parseChecksum parses the optional checksum argument, 0 if not specified.
+func parseChecksum(arg resp.CommandArgument) uint64 {
+	if arg == nil {
+		return 0
+	}
+	checksum, _ := strconv.ParseUint(arg.String(), 10, 64)
+	return checksum
+}
+
+// parseAttrs parses the optional argument of object attributes, empty if not specified.
+func parseAttrs(arg resp.CommandArgument) string {
+	if arg == nil {
+		return ""
+	}
+	return arg.String()
+}
+
+// isWaitForCOS returns true if SET should be acknowledged after the chunk is persisted to COS.
+func isWaitForCOS(session *lambdaLife.Session, persistence protocol.PersistencePolicy) bool {
+	switch persistence {
+	case protocol.PERSIST_WAIT_COS:
+		return true
+	case protocol.PERSIST_DEFAULT:
+		return !session.Input.IsWaitForCOSDisabled()
+	default:
+		return false
+	}
+}
+
 func TestHandler(w resp.ResponseWriter, c *resp.Command) {
 	client := redeo.GetClient(c.Context())
 
@@ -133,7 +186,8 @@ func GetHandler(w resp.ResponseWriter, c *resp.Command) {
 			}
 			return
 		}
-		ret = Persist.SetRecovery(key, chunkId, uint64(size), int(option))
+		checksum := parseChecksum(c.Arg(5))
+		ret = Persist.SetRecovery(key, chunkId, uint64(size), checksum, parseAttrs(c.Arg(6)), int(option))
 		if ret.Error() != nil {
 			errRsp.Error = ret.Error()
 			Server.AddResponses(errRsp, client)
@@ -214,6 +268,8 @@ func SetHandler(w resp.ResponseWriter, c *resp.CommandStream) {
 	log.Debug("In SET handler(link:%v, extension:%v)", link, extension)
 
 	var reqId, chunkId, key string
+	persistence := protocol.PERSIST_DEFAULT
+	waitForCOS := isWaitForCOS(session, persistence)
 	cmd := c.Name
 	committed := false
 	finalize := func(ret *types.OpRet, ds ...time.Duration) {
@@ -224,8 +280,9 @@ func SetHandler(w resp.ResponseWriter, c *resp.CommandStream) {
 			}
 			d2 := time.Since(t2)
 
-			// Confirm the object is persisted.
-			if committed && session.Input.IsWaitForCOSDisabled() {
+			// Confirm the object is persisted. Chunks of storage classes are confirmed even if waited, since the proxy
+			// may cache them until confirmed.
+			if committed && (!waitForCOS || persistence != protocol.PERSIST_DEFAULT) {
 				var rsp worker.Response
 				if err := ret.Error(); err == nil {
 					log.Debug("Sending persisted notification: %s", key)
@@ -253,7 +310,7 @@ func SetHandler(w resp.ResponseWriter, c *resp.CommandStream) {
 			// Output experiment data.
 			if err := ret.Error(); err == nil {
 				collector.AddRequest(t, types.OP_SET, "200", reqId, chunkId, ds[0], d2, ds[2], time.Since(t), session.Id)
-				if session.Input.IsWaitForCOSDisabled() {
+				if !waitForCOS {
 					log.Info("Set(link:%v) key:%s, chunk: %s, duration:%v, transmission:%v, persistence:%v", link, key, chunkId, ds[2], ds[0], d2)
 				}
 			} else {
@@ -271,6 +328,23 @@ func SetHandler(w resp.ResponseWriter, c *resp.CommandStream) {
 	reqId, _ = c.NextArg().String()
 	chunkId, _ = c.NextArg().String()
 	key, _ = c.NextArg().String()
+	var checksum uint64
+	if c.ArgN() > 4 {
+		// Optional: the checksum of the chunk.
+		checksumArg, _ := c.NextArg().String()
+		checksum, _ = strconv.ParseUint(checksumArg, 10, 64)
+	}
+	if c.ArgN() > 5 {
+		// Optional: the persistence policy of the storage class.
+		policy, _ := c.NextArg().Int()
+		persistence = protocol.PersistencePolicy(policy)
+		waitForCOS = isWaitForCOS(session, persistence)
+	}
+	attrs := ""
+	if c.ArgN() > 6 {
+		// Optional: attributes of the object, reported in the inventory.
+		attrs, _ = c.NextArg().String()
+	}
 	valReader, err := c.Next()
 	if err != nil {
 		errRsp.Error = NewResponseError(500, "Error on get value reader: %v", err)
@@ -285,7 +359,7 @@ func SetHandler(w resp.ResponseWriter, c *resp.CommandStream) {
 
 	// Streaming set.
 	client.Conn().SetReadDeadline(protocol.GetBodyDeadline(valReader.Len()))
-	ret := Store.SetStream(key, chunkId, valReader)
+	ret := Store.SetStream(key, chunkId, valReader, checksum, persistence == protocol.PERSIST_NO_COS, attrs)
 	client.Conn().SetReadDeadline(time.Time{})
 	t2 = time.Now()
 	d1 := t2.Sub(t)
@@ -310,7 +384,7 @@ func SetHandler(w resp.ResponseWriter, c *resp.CommandStream) {
 	}
 	BuildPiggyback(response)
 
-	if !session.Input.IsWaitForCOSDisabled() {
+	if waitForCOS {
 		err := ret.Wait()
 		if err != nil {
 			errRsp.Error = err
@@ -333,7 +407,7 @@ func SetHandler(w resp.ResponseWriter, c *resp.CommandStream) {
 	dt := time.Since(t)
 	committed = true
 
-	if !session.Input.IsWaitForCOSDisabled() {
+	if waitForCOS {
 		log.Info("Set(link:%v) key:%s, chunk: %s, duration:%v, transmission:%v, persistence:%v", link, key, chunkId, dt, d1, d2)
 	}
 	finalize(ret, d1, d2, dt)
@@ -401,7 +475,7 @@ func RecoverHandler(w resp.ResponseWriter, c *resp.Command) {
 	}
 
 	// Recover.
-	ret = Persist.SetRecovery(key, chunkId, uint64(size), 0)
+	ret = Persist.SetRecovery(key, chunkId, uint64(size), parseChecksum(c.Arg(5)), parseAttrs(c.Arg(6)), 0)
 	if ret.Error() != nil {
 		errRsp.Error = ret.Error()
 		Server.AddResponses(errRsp, client)
@@ -28,6 +28,9 @@ type storageAdapterCommand struct {
 	chunk      string
 	body       []byte
 	bodyStream resp.AllReadCloser
+	checksum   uint64
+	volatile   bool
+	attrs      string
 	handler    func(*storageAdapterCommand)
 	ret        chan *types.OpRet
 	note       string
@@ -38,6 +41,9 @@ func (cmd *storageAdapterCommand) reset() *storageAdapterCommand {
 	cmd.chunk = ""
 	cmd.body = nil
 	cmd.bodyStream = nil
+	cmd.checksum = 0
+	cmd.volatile = false
+	cmd.attrs = ""
 	cmd.handler = nil
 	// Drain err
 	for {
@@ -116,16 +122,19 @@ func (a *StorageAdapter) GetStream(key string) (string, resp.AllReadCloser, *typ
 }
 
 func (a *StorageAdapter) Set(key string, chunk string, val []byte) *types.OpRet {
-	return a.SetStream(key, chunk, resp.NewInlineReader(val))
+	return a.SetStream(key, chunk, resp.NewInlineReader(val), 0, false, "")
 }
 
-func (a *StorageAdapter) SetStream(key string, chunk string, valReader resp.AllReadCloser) *types.OpRet {
+func (a *StorageAdapter) SetStream(key string, chunk string, valReader resp.AllReadCloser, checksum uint64, volatile bool, attrs string) *types.OpRet {
 	cmd := cmds.Get().(*storageAdapterCommand).reset()
 	defer cmds.Put(cmd)
 
 	cmd.key = key
 	cmd.chunk = chunk
 	cmd.bodyStream = valReader
+	cmd.checksum = checksum
+	cmd.volatile = volatile
+	cmd.attrs = attrs
 	cmd.handler = a.setHandler
 	a.serializer <- cmd
 
@@ -244,7 +253,7 @@ func (a *StorageAdapter) setHandler(cmd *storageAdapterCommand) {
 	}
 
 	log.Debug("Forwarding key %s(chunk %s): success", cmd.key, cmd.chunk)
-	cmd.ret <- a.store.Set(cmd.key, cmd.chunk, interceptor.Intercepted())
+	cmd.ret <- a.store.SetStream(cmd.key, cmd.chunk, resp.NewInlineReader(interceptor.Intercepted()), cmd.checksum, cmd.volatile, cmd.attrs)
 }
 
 func (a *StorageAdapter) migrateHandler(cmd *storageAdapterCommand) {
@@ -722,7 +722,7 @@ func (s *LineageStorage) doSnapshot(lineage *types.LineageTerm, uploader *s3mana
 		if buffered {
 			lenBuffer++
 		}
-		if !chunk.Backup && (!chunk.IsBuffered(true) || buffered) && chunk.Term <= lineage.Term {
+		if !chunk.Backup && !chunk.Volatile && (!chunk.IsBuffered(true) || buffered) && chunk.Term <= lineage.Term {
 			allOps = append(allOps, types.LineageOp{
 				Op:       chunk.Op(),
 				Key:      chunk.Key,
@@ -730,6 +730,7 @@ func (s *LineageStorage) doSnapshot(lineage *types.LineageTerm, uploader *s3mana
 				Size:     chunk.Size,
 				Accessed: chunk.Accessed,
 				BIdx:     chunk.BuffIdx,
+				Attrs:    chunk.Attrs,
 			})
 		}
 	}
@@ -1088,6 +1089,7 @@ func (s *LineageStorage) doReplayLineage(meta *types.LineageMeta, terms []*types
 					chunk.Term = term.Term
 					chunk.Accessed = op.Accessed
 					chunk.Bucket = op.Bucket
+					chunk.Attrs = op.Attrs
 				} else {
 					// overlap
 					chunk.Accessed = op.Accessed
@@ -1110,6 +1112,7 @@ func (s *LineageStorage) doReplayLineage(meta *types.LineageMeta, terms []*types
 						Accessed:  op.Accessed,
 						Bucket:    op.Bucket,
 						Backup:    meta.Type == types.LineageMetaTypeBackup,
+						Attrs:     op.Attrs,
 					}
 					if op.Op == types.OP_DEL {
 						chunk.Status = types.CHUNK_DELETED
@@ -1258,6 +1261,7 @@ func (s *LineageStorage) doDelegateLineage(meta *types.LineageMeta, terms []*typ
 					Bucket:    op.Bucket,
 					Backup:    false,
 					BuffIdx:   types.CHUNK_TOBEBUFFERED, // Temporary, original op.BIdx is discarded.
+					Attrs:     op.Attrs,
 				}
 
 				tbds = append(tbds, chunk)
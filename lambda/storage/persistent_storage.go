@@ -123,7 +123,8 @@ func (s *PersistentStorage) getWithOption(key string, opt *types.OpWrapper) (*ty
 
 func (s *PersistentStorage) setWithOption(key string, chunk *types.Chunk, opt *types.OpWrapper) *types.OpRet {
 	s.Storage.setWithOption(key, chunk, opt)
-	if s.chanOps != nil {
+	// Volatile chunks are not tracked.
+	if s.chanOps != nil && !chunk.Volatile {
 		op := &types.OpWrapper{
 			LineageOp: types.LineageOp{
 				Op:       types.OP_SET,
@@ -131,6 +132,7 @@ func (s *PersistentStorage) setWithOption(key string, chunk *types.Chunk, opt *t
 				Id:       chunk.Id,
 				Size:     chunk.Size,
 				Accessed: chunk.Accessed,
+				Attrs:    chunk.Attrs,
 			},
 			OpRet: types.OpDelayedSuccess(),
 			Chunk: chunk,
@@ -159,13 +161,17 @@ func (s *PersistentStorage) newChunk(key string, chunkId string, size uint64, va
 	return chunk
 }
 
-func (s *PersistentStorage) SetRecovery(key string, chunkId string, size uint64, opts int) *types.OpRet {
+// SetRecovery recovers the chunk from the persistent layer. The recovered chunk will be verified against the checksum if it is not 0.
+// Attributes of the object are kept along with the chunk as SetStream.
+func (s *PersistentStorage) SetRecovery(key string, chunkId string, size uint64, checksum uint64, attrs string, opts int) *types.OpRet {
 	_, err := s.helper.getWithOption(key, nil)
 	if err.Error() == nil {
 		return err
 	}
 
 	emptyChunk := s.helper.newChunk(key, chunkId, size, nil)
+	emptyChunk.Checksum = checksum
+	emptyChunk.Attrs = attrs
 	emptyChunk.Delete("prepare recovery") // Delete to ensure call PrepareRecover() succssfully
 	emptyChunk.PrepareRecover()
 	inserted, loaded := s.repo.GetOrInsert(key, emptyChunk)
@@ -219,6 +225,14 @@ func (s *PersistentStorage) SetRecovery(key string, chunkId string, size uint64,
 		return types.OpError(err)
 	}
 
+	// Verify before the chunk is available to concurrent requests.
+	if !chunk.Verify() {
+		s.log.Warn("Checksum mismatched on recovering %s(%s), discarded.", key, chunkId)
+		chunk.Discard("checksum mismatched")
+		chunk.NotifyRecovered()
+		return types.OpError(types.ErrCorrupted)
+	}
+
 	// This is to reuse persistent implementation.
 	// Chunk inserted previously will be loaded, and no new chunk will be created.
 	if opt == nil {
@@ -233,7 +247,7 @@ func (s *PersistentStorage) SetRecovery(key string, chunkId string, size uint64,
 func (s *PersistentStorage) delWithOption(chunk *types.Chunk, reason string, opt *types.OpWrapper) *types.OpRet {
 	s.Storage.delWithOption(chunk, reason, opt)
 
-	if s.chanOps != nil {
+	if s.chanOps != nil && !chunk.Volatile {
 		op := &types.OpWrapper{
 			LineageOp: types.LineageOp{
 				Op:       types.OP_DEL,
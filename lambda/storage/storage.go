@@ -11,6 +11,7 @@ import (
 	"github.com/aws/aws-lambda-go/lambdacontext"
 	"github.com/mason-leap-lab/redeo/resp"
 	"github.com/sionreview/sion/common/logger"
+	protocol "github.com/sionreview/sion/common/types"
 	"github.com/zhangjyr/hashmap"
 
 	"github.com/sionreview/sion/lambda/types"
@@ -164,14 +165,19 @@ func (s *Storage) Set(key string, chunkId string, val []byte) *types.OpRet {
 	return s.helper.setWithOption(key, chunk, nil)
 }
 
-// Set chunk using stream
-func (s *Storage) SetStream(key string, chunkId string, valReader resp.AllReadCloser) *types.OpRet {
+// Set chunk using stream, the checksum is optional and can be 0. A volatile chunk will not be persisted. Attributes of
+// the object are optional and reported in the inventory as they are.
+func (s *Storage) SetStream(key string, chunkId string, valReader resp.AllReadCloser, checksum uint64, volatile bool, attrs string) *types.OpRet {
 	val, err := valReader.ReadAll()
 	if err != nil {
 		return types.OpError(fmt.Errorf("error on read stream: %v", err))
 	}
 
-	return s.Set(key, chunkId, val)
+	chunk := s.helper.newChunk(key, chunkId, uint64(len(val)), val)
+	chunk.Checksum = checksum
+	chunk.Volatile = volatile
+	chunk.Attrs = attrs
+	return s.helper.setWithOption(key, chunk, nil)
 }
 
 func (s *Storage) del(chunk *types.Chunk, reason string) {
@@ -202,6 +208,27 @@ func (s *Storage) Len() int {
 	return s.repo.Len()
 }
 
+// Inventory returns chunks stored, including chunks being recovered. Deleted chunks and backups of other nodes are
+// excluded.
+func (s *Storage) Inventory() []protocol.ChunkInventory {
+	inventory := make([]protocol.ChunkInventory, 0, s.Len())
+	for keyChunk := range s.repo.Iter() {
+		chunk := keyChunk.Value.(*types.Chunk)
+		if chunk.IsDeleted() || chunk.Backup {
+			continue
+		}
+		inventory = append(inventory, protocol.ChunkInventory{
+			Key:      chunk.Key,
+			Id:       chunk.Id,
+			Size:     chunk.Size,
+			Term:     chunk.Term,
+			Checksum: chunk.Checksum,
+			Attrs:    chunk.Attrs,
+		})
+	}
+	return inventory
+}
+
 func (s *Storage) Keys() <-chan string {
 	// Gather and send key list. We expected num of keys to be small
 	all := make([]*types.Chunk, 0, s.Len())
@@ -3,9 +3,12 @@ package storage_test
 import (
 	"testing"
 
+	"github.com/cespare/xxhash"
+	"github.com/mason-leap-lab/redeo/resp"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/sionreview/sion/lambda/storage"
+	"github.com/sionreview/sion/lambda/types"
 )
 
 func TestStorage(t *testing.T) {
@@ -31,4 +34,49 @@ var _ = Describe("Storage", func() {
 		Expect(<-keys).To(Equal("key1"))
 	})
 
+	It("should Inventory() report chunks stored except deleted ones.", func() {
+		setup()
+		store.Del("key1", "test")
+
+		inventory := store.Inventory()
+		Expect(inventory).To(HaveLen(1))
+		Expect(inventory[0].Key).To(Equal("key2"))
+		Expect(inventory[0].Id).To(Equal("1"))
+	})
+
+	It("should Inventory() report attributes of objects set along with chunks.", func() {
+		setup()
+		ret := store.SetStream("key3", "1", resp.NewInlineReader([]byte("Test me.")), 0, false, "attrs")
+		Expect(ret.Error()).To(BeNil())
+
+		attrs := make(map[string]string)
+		for _, chunk := range store.Inventory() {
+			attrs[chunk.Key] = chunk.Attrs
+		}
+		Expect(attrs).To(Equal(map[string]string{"key1": "", "key2": "", "key3": "attrs"}))
+	})
+
+	It("should SetStream() keep the body verifiable by the checksum.", func() {
+		setup()
+
+		body := []byte("Test me.")
+		ret := store.SetStream("key3", "1", resp.NewInlineReader(body), xxhash.Sum64(body), false, "")
+		Expect(ret.Error()).To(BeNil())
+
+		_, stored, ret := store.Get("key3")
+		Expect(ret.Error()).To(BeNil())
+		Expect(stored).To(Equal(body))
+	})
+
+	It("should Verify() detect mismatched checksum.", func() {
+		chunk := types.NewChunk("key", "1", []byte("Test me."))
+		Expect(chunk.Verify()).To(BeTrue()) // Unknown checksum.
+
+		chunk.Checksum = xxhash.Sum64(chunk.Body)
+		Expect(chunk.Verify()).To(BeTrue())
+
+		chunk.Body[0] = 't'
+		Expect(chunk.Verify()).To(BeFalse())
+	})
+
 })
@@ -139,7 +139,8 @@ type LineageOp struct {
 	Size     uint64 // Size of the object
 	Accessed time.Time
 	Bucket   string
-	BIdx     int // Index in bufferQueue
+	BIdx     int    // Index in bufferQueue
+	Attrs    string // Attributes of the object, see Chunk.Attrs.
 }
 
 type OpWrapper struct {
@@ -6,7 +6,9 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/cespare/xxhash"
 	"github.com/mason-leap-lab/redeo/resp"
+	protocol "github.com/sionreview/sion/common/types"
 )
 
 const (
@@ -32,6 +34,7 @@ var (
 	ErrNotFound     = errors.New("key not found")
 	ErrDeleted      = errors.New("key deleted")
 	ErrIncomplete   = errors.New("key incomplete")
+	ErrCorrupted    = errors.New("key corrupted")
 )
 
 const ()
@@ -40,6 +43,11 @@ type Loggable interface {
 	ConfigLogger(int, bool)
 }
 
+// InventoryReporter Storage that can report chunks stored, see protocol.FLAG_REPORT_INVENTORY.
+type InventoryReporter interface {
+	Inventory() []protocol.ChunkInventory
+}
+
 type CalibratePriority int
 
 type StorageMeta interface {
@@ -74,7 +82,7 @@ type Storage interface {
 	Get(string) (string, []byte, *OpRet)
 	GetStream(string) (string, resp.AllReadCloser, *OpRet)
 	Set(string, string, []byte) *OpRet
-	SetStream(string, string, resp.AllReadCloser) *OpRet
+	SetStream(string, string, resp.AllReadCloser, uint64, bool, string) *OpRet
 	Del(string, string) *OpRet
 	Len() int
 	Keys() <-chan string
@@ -85,7 +93,7 @@ type PersistentStorage interface {
 	Storage
 
 	ConfigS3(string, string)
-	SetRecovery(string, string, uint64, int) *OpRet
+	SetRecovery(string, string, uint64, uint64, string, int) *OpRet
 	StartTracker()
 	StopTracker() error
 }
@@ -107,6 +115,9 @@ type Chunk struct {
 	Backup    bool
 	BuffIdx   int    // Index in buffer queue
 	Note      string // Reason for the status.
+	Checksum  uint64 // Checksum of the body, 0 if unknown.
+	Volatile  bool   // Volatile chunk is kept in memory only, and will not be persisted or recovered.
+	Attrs     string // Attributes of the object the chunk belongs to, opaque to the node.
 }
 
 func NewChunk(key string, id string, body []byte) *Chunk {
@@ -133,6 +144,11 @@ func (c *Chunk) Op() uint32 {
 	}
 }
 
+// Verify returns false if the checksum is known and mismatches the body.
+func (c *Chunk) Verify() bool {
+	return c.Checksum == 0 || xxhash.Sum64(c.Body) == c.Checksum
+}
+
 func (c *Chunk) IsAvailable() bool {
 	return atomic.LoadUint32(&c.Status) == CHUNK_AVAILABLE && atomic.LoadUint64(&c.Available) == c.Size
 }
@@ -159,6 +175,12 @@ func (c *Chunk) Delete(reason string) {
 	c.Note = reason
 }
 
+// Discard marks the chunk incomplete, so it will be recovered again on requesting.
+func (c *Chunk) Discard(reason string) {
+	atomic.StoreUint32(&c.Status, CHUNK_INCOMPLETE)
+	c.Note = reason
+}
+
 // PrepareRecover initiate chunk for recovery.
 // Return true if chunk is ready for wait.
 func (c *Chunk) PrepareRecover() bool {
@@ -15,6 +15,7 @@ import (
 type persistCache struct {
 	hashmap hashmap.HashMap // Should be fine if total key is under 1000.
 	pool    sync.Pool       // For storing uninitialized chunks.
+	store   *persistStore   // Optional, chunks are kept in memory only if nil.
 	log     logger.ILogger
 }
 
@@ -24,6 +25,19 @@ func NewPersistCache() types.PersistCache {
 	return cache
 }
 
+// NewPersistCacheWithStorage creates a PersistCache that also stores chunks being persisted in the directory,
+// using up to budget bytes. Chunks exceeding the budget are kept in memory only.
+func NewPersistCacheWithStorage(dir string, budget int64) (types.PersistCache, error) {
+	store, err := openPersistStore(dir, budget)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := NewPersistCache().(*persistCache)
+	cache.store = store
+	return cache, nil
+}
+
 func (c *persistCache) Len() int {
 	return c.hashmap.Len()
 }
@@ -78,8 +92,33 @@ func (c *persistCache) Get(key string) (chunk types.PersistChunk) {
 	}
 }
 
-func (c *persistCache) Restore() error {
-	return types.ErrUnimplemented
+func (c *persistCache) Restore(restored func(types.PersistChunk)) (int, error) {
+	if c.store == nil {
+		return 0, types.ErrUnimplemented
+	}
+
+	return c.store.Replay(func(record *persistRecord, data []byte) {
+		chunk := newPersistChunk(c, record.Key, record.Size)
+		chunk.key = record.Key // Keep the chunk key parsable in debug mode.
+		chunk.data = data
+		chunk.interceptor = &restoredInterceptor{size: int64(len(data))}
+		chunk.dumped = true
+		chunk.refs.Add(1) // Hold the chunk during restoring.
+		c.hashmap.Store(record.Key, chunk)
+		c.log.Debug("%s: Restored", chunk.Key())
+
+		restored(chunk)
+
+		// Discard the chunk if persisting is not started.
+		chunk.mu.Lock()
+		persisting := chunk.cancel != nil
+		chunk.mu.Unlock()
+		if !persisting {
+			c.log.Warn("%s: Discarded on restoring, persisting not started.", chunk.Key())
+			c.store.Done(record.Key)
+		}
+		chunk.doneRefs()
+	})
 }
 
 func (c *persistCache) Report() {
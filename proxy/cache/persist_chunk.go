@@ -31,6 +31,13 @@ type dummyPersistInterceptor struct {
 
 func (d *dummyPersistInterceptor) BytesIntercepted() int64 { return 0 }
 
+// restoredInterceptor is used by chunks restored from local storage, which are fully stored.
+type restoredInterceptor struct {
+	size int64
+}
+
+func (r *restoredInterceptor) BytesIntercepted() int64 { return r.size }
+
 type persistChunk struct {
 	protocol.Contextable
 	cache *persistCache
@@ -42,6 +49,7 @@ type persistChunk struct {
 	cancel      context.CancelFunc
 	interceptor persistChunkInterceptor
 	closed      bool
+	dumped      bool // Whether the chunk is stored in local storage.
 
 	// We use sync.Cond for readers' synchronization. See lab/blocker for a overhead benchmark.
 	mu       sync.Mutex
@@ -127,10 +135,10 @@ func (pc *persistChunk) Store(reader resp.AllReadCloser) (resp.AllReadCloser, er
 
 // GetInterceptor returns the interceptor of the chunk.
 func (pc *persistChunk) GetInterceptor() resp.AllReadCloser {
-	if pc.interceptor == noneIntercepted {
-		return nil
+	if interceptor, ok := pc.interceptor.(resp.AllReadCloser); ok {
+		return interceptor
 	}
-	return pc.interceptor.(resp.AllReadCloser)
+	return nil
 }
 
 // WaitStored will wait until the chunk is stored or error occurs.
@@ -183,6 +191,9 @@ func (pc *persistChunk) StartPersist(req interface{}, timeout time.Duration, ret
 		// It is the first time calling StartPersist, add reference.
 		pc.refs.Add(1)
 		pc.cache.log.Debug("%s: Persisting started.", pc.Key())
+		if pc.IsStored() {
+			pc.dumpLocked()
+		}
 	}
 
 	ctx, pc.cancel = context.WithTimeout(context.WithValue(context.Background(), types.CtxKeyRequest, req), timeout)
@@ -209,6 +220,10 @@ func (pc *persistChunk) DonePersist() {
 
 	pc.cancel()
 	pc.cancel = nil
+	if pc.dumped {
+		pc.cache.store.Done(pc.storeKey())
+		pc.dumped = false
+	}
 	left := pc.doneRefs()
 	pc.cache.log.Debug("%s: Done persisting, ref counter: %d", pc.Key(), left)
 }
@@ -260,15 +275,35 @@ func (pc *persistChunk) doneRefs() int32 {
 }
 
 func (pc *persistChunk) close() {
-	key := pc.Key()
-	if global.Options.Debug {
-		key = debugIDRemover.ReplaceAllString(key, "")
-	}
-	pc.cache.remove(key, pc)
+	pc.cache.remove(pc.storeKey(), pc)
 	pc.closed = true
 	pc.cache.log.Debug("%s Removed, remaining %d keys", pc.Key(), pc.cache.Len())
 }
 
+// storeKey returns the key the chunk is stored with.
+func (pc *persistChunk) storeKey() string {
+	if global.Options.Debug {
+		return debugIDRemover.ReplaceAllString(pc.Key(), "")
+	}
+	return pc.Key()
+}
+
+// dumpLocked stores the chunk in local storage if available, so the chunk can be restored
+// and persisted again on proxy failure. The chunk must be fully stored.
+func (pc *persistChunk) dumpLocked() {
+	if pc.cache.store == nil || pc.dumped {
+		return
+	}
+
+	err := pc.cache.store.Put(&persistRecord{Key: pc.storeKey(), Size: pc.size}, pc.data[:pc.size])
+	if err != nil {
+		pc.cache.log.Warn("%s: Failed to dump, chunk will not be restored on failure: %v", pc.Key(), err)
+		return
+	}
+	pc.dumped = true
+	pc.cache.log.Debug("%s: Dumped", pc.Key())
+}
+
 func (pc *persistChunk) notifyError(err error) {
 	pc.mu.Lock()
 	pc.err = types.ErrChunkStoreFailed
@@ -315,6 +350,14 @@ func (pc *persistChunk) waitDataWithContext(ctx context.Context, nRead int64, do
 }
 
 func (pc *persistChunk) waitInterceptor(interceptor *server.InterceptReader) {
+	if pc.IsStored() {
+		pc.mu.Lock()
+		// Dump if persisting has been started.
+		if pc.cancel != nil {
+			pc.dumpLocked()
+		}
+		pc.mu.Unlock()
+	}
 	left := pc.doneRefs()
 	pc.cache.log.Debug("%s: Stored(%d/%d), ref counter: %d", pc.Key(), pc.BytesStored(), pc.Size(), left)
 }
@@ -0,0 +1,432 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	kbinary "github.com/kelindar/binary"
+	"github.com/sionreview/sion/common/logger"
+	"github.com/sionreview/sion/proxy/global"
+)
+
+const (
+	PersistSegmentPrefix = "persist-"
+	PersistSegmentSuffix = ".seg"
+
+	// DefaultSegmentSize Size of a segment file before a new one is created.
+	DefaultSegmentSize = 64 * 1000000 // 64MB
+)
+
+var (
+	ErrStoreClosed         = errors.New("persist store closed")
+	ErrStoreBudgetExceeded = errors.New("persist store budget exceeded")
+)
+
+// persistRecord is the persisted form of a chunk waiting to be persisted to COS.
+// A record with Done set marks earlier record of the same key obsolete.
+type persistRecord struct {
+	Key  string
+	Size int64
+	Done bool
+}
+
+type persistSegment struct {
+	id   int
+	size int64
+	live int // Number of records not yet done.
+}
+
+// persistLocation is where the chunk not yet done is stored.
+type persistLocation struct {
+	segment *persistSegment
+	size    int64
+}
+
+func (s *persistSegment) name(dir string) string {
+	return path.Join(dir, fmt.Sprintf("%s%08d%s", PersistSegmentPrefix, s.id, PersistSegmentSuffix))
+}
+
+// persistStore stores chunks in append-only segment files under specified directory.
+// Segments are removed once all chunks stored in them and earlier segments are done. Chunks not yet done are relocated
+// from the earliest segment if chunks done in segments can not be removed otherwise take up the budget.
+// The segment is flushed to the OS on every change, so chunks will survive a proxy crash.
+type persistStore struct {
+	dir         string
+	budget      int64
+	segmentSize int64
+	segments    []*persistSegment // In the order of creation, the last one is for appending.
+	locations   map[string]*persistLocation
+	used        int64 // Bytes of all segments.
+	pending     int64 // Bytes of chunks not yet done.
+	file        *os.File
+	writer      *bufio.Writer
+	buf         [binary.MaxVarintLen64]byte
+	log         logger.ILogger
+	mu          sync.Mutex
+}
+
+// openPersistStore opens the store under specified directory with the budget in bytes. The directory will be created if not exists.
+func openPersistStore(dir string, budget int64) (*persistStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &persistStore{
+		dir:         dir,
+		budget:      budget,
+		segmentSize: DefaultSegmentSize,
+		locations:   make(map[string]*persistLocation),
+		log:         global.GetLogger("PersistStore: "),
+	}, nil
+}
+
+// Replay loads chunks not yet done from existing segments. Chunks are passed to the callback in the order of storing.
+// New chunks will be stored in a new segment after replaying.
+func (s *persistStore) Replay(restore func(*persistRecord, []byte)) (int, error) {
+	s.mu.Lock()
+
+	ids, err := s.listSegmentsLocked()
+	if err != nil {
+		s.mu.Unlock()
+		return 0, err
+	}
+
+	type replayed struct {
+		record  *persistRecord
+		data    []byte
+		segment *persistSegment
+		order   int
+	}
+	records := make(map[string]*replayed)
+	order := 0
+	for _, id := range ids {
+		segment := &persistSegment{id: id}
+		s.segments = append(s.segments, segment)
+		err := s.readSegmentLocked(segment, func(record *persistRecord, data []byte) {
+			if record.Done {
+				delete(records, record.Key)
+				return
+			}
+			records[record.Key] = &replayed{record: record, data: data, segment: segment, order: order}
+			order++
+		})
+		if err != nil {
+			s.mu.Unlock()
+			return 0, err
+		}
+		s.used += segment.size
+	}
+
+	restoring := make([]*replayed, 0, len(records))
+	for _, r := range records {
+		r.segment.live++
+		s.locations[r.record.Key] = &persistLocation{segment: r.segment, size: r.record.Size}
+		s.pending += r.record.Size
+		restoring = append(restoring, r)
+	}
+	sort.Slice(restoring, func(i, j int) bool {
+		return restoring[i].order < restoring[j].order
+	})
+	s.log.Info("Loaded %d chunks from %d segments.", len(restoring), len(ids))
+
+	// Never append to replayed segments, the last record can be truncated.
+	err = s.rotateLocked()
+	s.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	// Callback without lock, the store may be updated in the callback.
+	for _, r := range restoring {
+		restore(r.record, r.data)
+	}
+	return len(restoring), nil
+}
+
+// Put stores the chunk. ErrStoreBudgetExceeded will be returned if there is no enough space.
+func (s *persistStore) Put(record *persistRecord, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.writer == nil {
+		return ErrStoreClosed
+	} else if _, ok := s.locations[record.Key]; ok {
+		// Stored already.
+		return nil
+	} else if s.pending+record.Size > s.budget {
+		return ErrStoreBudgetExceeded
+	}
+
+	// Chunks done take up the budget until their segments are removed, which can be held by a chunk not yet done.
+	for n := len(s.segments); s.used+record.Size > s.budget && n > 0; n-- {
+		if err := s.relocateLocked(); err != nil {
+			s.log.Warn("Failed to relocate segment %d: %v", s.segments[0].id, err)
+			return err
+		}
+	}
+	if s.used+record.Size > s.budget {
+		return ErrStoreBudgetExceeded
+	}
+
+	if err := s.appendLocked(record, data); err != nil {
+		s.log.Warn("Failed to store %s: %v", record.Key, err)
+		return err
+	}
+	segment := s.segments[len(s.segments)-1]
+	segment.live++
+	s.locations[record.Key] = &persistLocation{segment: segment, size: record.Size}
+	s.pending += record.Size
+	return nil
+}
+
+// Done marks the chunk of specified key done, so that it will not be restored.
+func (s *persistStore) Done(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	location, ok := s.locations[key]
+	if !ok {
+		return nil
+	}
+	delete(s.locations, key)
+	location.segment.live--
+	s.pending -= location.size
+
+	if s.writer == nil {
+		return ErrStoreClosed
+	}
+	if err := s.appendLocked(&persistRecord{Key: key, Done: true}, nil); err != nil {
+		s.log.Warn("Failed to mark %s done: %v", key, err)
+		return err
+	}
+	s.compactLocked()
+	return nil
+}
+
+// Len returns the number of chunks not yet done.
+func (s *persistStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.locations)
+}
+
+// Close flushes and closes the segment for appending.
+func (s *persistStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.closeSegmentLocked()
+}
+
+func (s *persistStore) listSegmentsLocked() ([]int, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, PersistSegmentPrefix) || !strings.HasSuffix(name, PersistSegmentSuffix) {
+			continue
+		}
+		var id int
+		if _, err := fmt.Sscanf(strings.TrimSuffix(strings.TrimPrefix(name, PersistSegmentPrefix), PersistSegmentSuffix), "%d", &id); err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+func (s *persistStore) readSegmentLocked(segment *persistSegment, apply func(*persistRecord, []byte)) error {
+	name := segment.name(s.dir)
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if info, err := file.Stat(); err == nil {
+		segment.size = info.Size()
+	}
+
+	reader := bufio.NewReader(file)
+	for {
+		size, err := binary.ReadUvarint(reader)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			s.log.Warn("Stop reading %s on truncated record: %v", name, err)
+			return nil
+		}
+
+		header := make([]byte, size)
+		if _, err := io.ReadFull(reader, header); err != nil {
+			// The last record was not fully written on crash.
+			s.log.Warn("Stop reading %s on truncated record: %v", name, err)
+			return nil
+		}
+		var record persistRecord
+		if err := kbinary.Unmarshal(header, &record); err != nil {
+			return err
+		}
+
+		var data []byte
+		if !record.Done {
+			data = make([]byte, record.Size)
+			if _, err := io.ReadFull(reader, data); err != nil {
+				s.log.Warn("Stop reading %s on truncated chunk %s: %v", name, record.Key, err)
+				return nil
+			}
+		}
+		apply(&record, data)
+	}
+}
+
+func (s *persistStore) appendLocked(record *persistRecord, data []byte) error {
+	segment := s.segments[len(s.segments)-1]
+	if segment.size >= s.segmentSize {
+		if err := s.rotateLocked(); err != nil {
+			return err
+		}
+		segment = s.segments[len(s.segments)-1]
+	}
+
+	header, err := kbinary.Marshal(record)
+	if err != nil {
+		return err
+	}
+	n := binary.PutUvarint(s.buf[:], uint64(len(header)))
+	if _, err := s.writer.Write(s.buf[:n]); err != nil {
+		return err
+	}
+	if _, err := s.writer.Write(header); err != nil {
+		return err
+	}
+	if _, err := s.writer.Write(data); err != nil {
+		return err
+	}
+	if err := s.writer.Flush(); err != nil {
+		return err
+	}
+
+	written := int64(n + len(header) + len(data))
+	segment.size += written
+	s.used += written
+	return nil
+}
+
+// rotateLocked closes the segment for appending and creates a new one.
+func (s *persistStore) rotateLocked() error {
+	s.closeSegmentLocked()
+
+	id := 0
+	if len(s.segments) > 0 {
+		id = s.segments[len(s.segments)-1].id + 1
+	}
+	segment := &persistSegment{id: id}
+	file, err := os.OpenFile(segment.name(s.dir), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	s.segments = append(s.segments, segment)
+	s.file = file
+	s.writer = bufio.NewWriter(file)
+	s.compactLocked()
+	return nil
+}
+
+// relocateLocked appends chunks not yet done in the earliest segment to the segment for appending, so that the earliest
+// segment can be removed.
+func (s *persistStore) relocateLocked() error {
+	if len(s.segments) == 1 {
+		if err := s.rotateLocked(); err != nil {
+			return err
+		}
+	}
+	head := s.segments[0]
+	if head.live == 0 {
+		s.compactLocked()
+		return nil
+	}
+
+	type relocating struct {
+		record *persistRecord
+		data   []byte
+	}
+	records := make(map[string]*relocating)
+	keys := make([]string, 0, head.live)
+	err := s.readSegmentLocked(head, func(record *persistRecord, data []byte) {
+		if location, ok := s.locations[record.Key]; !ok || location.segment != head {
+			return
+		} else if _, ok := records[record.Key]; !ok {
+			keys = append(keys, record.Key)
+		}
+		// Only the last record of the key is not done.
+		records[record.Key] = &relocating{record: record, data: data}
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		r := records[key]
+		if err := s.appendLocked(r.record, r.data); err != nil {
+			return err
+		}
+		location := s.locations[key]
+		location.segment.live--
+		location.segment = s.segments[len(s.segments)-1]
+		location.segment.live++
+	}
+	s.compactLocked()
+	return nil
+}
+
+// compactLocked removes segments from the earliest one as long as all chunks in the segment are done.
+// Segments are removed in order, so that the Done record of a chunk is never removed before the chunk.
+func (s *persistStore) compactLocked() {
+	for len(s.segments) > 1 && s.segments[0].live == 0 {
+		segment := s.segments[0]
+		if err := os.Remove(segment.name(s.dir)); err != nil && !os.IsNotExist(err) {
+			s.log.Warn("Failed to remove segment %d: %v", segment.id, err)
+			return
+		}
+		s.used -= segment.size
+		s.segments = s.segments[1:]
+	}
+
+	// All done, reuse the segment for appending.
+	if len(s.segments) == 1 && s.segments[0].live == 0 && s.segments[0].size > 0 && s.file != nil {
+		if err := s.file.Truncate(0); err != nil {
+			s.log.Warn("Failed to truncate segment %d: %v", s.segments[0].id, err)
+			return
+		}
+		s.file.Seek(0, io.SeekStart)
+		s.used -= s.segments[0].size
+		s.segments[0].size = 0
+	}
+}
+
+func (s *persistStore) closeSegmentLocked() error {
+	if s.file == nil {
+		return nil
+	}
+
+	s.writer.Flush()
+	err := s.file.Close()
+	s.file = nil
+	s.writer = nil
+	return err
+}
@@ -0,0 +1,204 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mason-leap-lab/redeo/resp"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sionreview/sion/proxy/types"
+)
+
+func newStoredCache(dir string) *persistCache {
+	c, err := NewPersistCacheWithStorage(dir, 1000000)
+	Expect(err).To(BeNil())
+	return c.(*persistCache)
+}
+
+func storeAndPersist(c *persistCache, key string, data string) types.PersistChunk {
+	chunk, _ := c.GetOrCreate(key, int64(len(data)))
+	reader, _ := chunk.Store(resp.NewInlineReader([]byte(data)))
+	chunk.StartPersist(nil, time.Minute, nil)
+	reader.Close()
+	return chunk
+}
+
+var _ = Describe("PersistStore", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "persist")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("should replay chunks not yet done", func() {
+		store, err := openPersistStore(dir, 1000000)
+		Expect(err).To(BeNil())
+		_, err = store.Replay(func(*persistRecord, []byte) {})
+		Expect(err).To(BeNil())
+
+		store.segmentSize = 1 // One record per segment.
+		Expect(store.Put(&persistRecord{Key: "a", Size: 3}, []byte("aaa"))).To(BeNil())
+		Expect(store.Put(&persistRecord{Key: "b", Size: 3}, []byte("bbb"))).To(BeNil())
+		Expect(store.Put(&persistRecord{Key: "c", Size: 3}, []byte("ccc"))).To(BeNil())
+		Expect(store.Done("b")).To(BeNil())
+		Expect(store.Len()).To(Equal(2))
+		store.Close()
+
+		store, _ = openPersistStore(dir, 1000000)
+		replayed := make(map[string]string)
+		restored, err := store.Replay(func(record *persistRecord, data []byte) {
+			replayed[record.Key] = string(data)
+		})
+		Expect(err).To(BeNil())
+		Expect(restored).To(Equal(2))
+		Expect(replayed).To(Equal(map[string]string{"a": "aaa", "c": "ccc"}))
+		store.Close()
+	})
+
+	It("should remove segments once all chunks are done", func() {
+		store, _ := openPersistStore(dir, 1000000)
+		store.Replay(func(*persistRecord, []byte) {})
+
+		store.segmentSize = 1 // One record per segment.
+		store.Put(&persistRecord{Key: "a", Size: 3}, []byte("aaa"))
+		store.Put(&persistRecord{Key: "b", Size: 3}, []byte("bbb"))
+		Expect(len(store.segments)).To(Equal(2))
+
+		// Segments are removed in order.
+		store.Done("b")
+		Expect(len(store.segments)).To(Equal(3))
+		store.Done("a")
+		Expect(len(store.segments)).To(Equal(1))
+		Expect(store.used).To(Equal(store.segments[0].size))
+
+		entries, _ := os.ReadDir(dir)
+		Expect(len(entries)).To(Equal(1))
+		store.Close()
+	})
+
+	It("should reject chunks exceeding the budget", func() {
+		store, _ := openPersistStore(dir, 10)
+		store.Replay(func(*persistRecord, []byte) {})
+
+		Expect(store.Put(&persistRecord{Key: "a", Size: 20}, make([]byte, 20))).To(Equal(ErrStoreBudgetExceeded))
+		Expect(store.Len()).To(Equal(0))
+		store.Close()
+	})
+
+	It("should relocate chunks not yet done to reclaim chunks done", func() {
+		store, _ := openPersistStore(dir, 250)
+		store.Replay(func(*persistRecord, []byte) {})
+
+		store.segmentSize = 1 // One record per segment.
+		Expect(store.Put(&persistRecord{Key: "a", Size: 100}, []byte(strings.Repeat("a", 100)))).To(BeNil())
+		Expect(store.Put(&persistRecord{Key: "b", Size: 100}, []byte(strings.Repeat("b", 100)))).To(BeNil())
+		Expect(store.Done("b")).To(BeNil())
+		// The segment of "a" holds the segment of "b".
+		Expect(store.used + 100).To(BeNumerically(">", 250))
+
+		Expect(store.Put(&persistRecord{Key: "c", Size: 100}, []byte(strings.Repeat("c", 100)))).To(BeNil())
+		Expect(store.used).To(BeNumerically("<=", 250))
+		Expect(store.Put(&persistRecord{Key: "d", Size: 100}, make([]byte, 100))).To(Equal(ErrStoreBudgetExceeded))
+		store.Close()
+
+		store, _ = openPersistStore(dir, 250)
+		replayed := make(map[string]string)
+		_, err := store.Replay(func(record *persistRecord, data []byte) {
+			replayed[record.Key] = string(data)
+		})
+		Expect(err).To(BeNil())
+		Expect(replayed).To(Equal(map[string]string{"a": strings.Repeat("a", 100), "c": strings.Repeat("c", 100)}))
+		store.Close()
+	})
+})
+
+var _ = Describe("PersistCache with storage", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "persist")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("should evict chunks from storage after persisted", func() {
+		testStream := "Test me."
+
+		c := newStoredCache(dir)
+		restored, err := c.Restore(func(types.PersistChunk) {})
+		Expect(err).To(BeNil())
+		Expect(restored).To(Equal(0))
+
+		chunk := storeAndPersist(c, "test", testStream)
+		Expect(c.store.Len()).To(Equal(1))
+
+		chunk.DonePersist()
+		Expect(c.store.Len()).To(Equal(0))
+		Expect(c.Len()).To(Equal(0))
+		c.store.Close()
+	})
+
+	It("should restore chunks not yet persisted", func() {
+		testStream := "Test me."
+
+		c := newStoredCache(dir)
+		c.Restore(func(types.PersistChunk) {})
+		storeAndPersist(c, "test", testStream)
+		c.store.Close() // Crash before persisted.
+
+		c = newStoredCache(dir)
+		var restoredChunk types.PersistChunk
+		restored, err := c.Restore(func(chunk types.PersistChunk) {
+			restoredChunk = chunk
+			chunk.StartPersist(nil, time.Minute, nil)
+		})
+		Expect(err).To(BeNil())
+		Expect(restored).To(Equal(1))
+		Expect(restoredChunk.Key()).To(Equal("test"))
+		Expect(restoredChunk.IsStored()).To(BeTrue())
+		Expect(c.Get("test")).To(Equal(restoredChunk))
+
+		data, err := restoredChunk.LoadAll(context.Background())
+		Expect(err).To(BeNil())
+		Expect(string(data)).To(Equal(testStream))
+
+		restoredChunk.DonePersist()
+		Expect(c.store.Len()).To(Equal(0))
+		Expect(c.Len()).To(Equal(0))
+		c.store.Close()
+	})
+
+	It("should discard restored chunks if persisting not started", func() {
+		testStream := "Test me."
+
+		c := newStoredCache(dir)
+		c.Restore(func(types.PersistChunk) {})
+		storeAndPersist(c, "test", testStream)
+		c.store.Close()
+
+		c = newStoredCache(dir)
+		restored, _ := c.Restore(func(types.PersistChunk) {})
+		Expect(restored).To(Equal(1))
+		Expect(c.store.Len()).To(Equal(0))
+		Expect(c.Len()).To(Equal(0))
+		c.store.Close()
+
+		c = newStoredCache(dir)
+		restored, _ = c.Restore(func(types.PersistChunk) {})
+		Expect(restored).To(Equal(0))
+		c.store.Close()
+	})
+})
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"sync/atomic"
 	"time"
 
 	"github.com/sionreview/sion/common/logger"
@@ -22,10 +23,10 @@ const ProxyFeatures = FLAG_CLIENTSIDE_FIRSTD_OPTIMIZATION | FLAG_ENABLE_LOCAL_CA
 const LambdaLogLevel = logger.LOG_LEVEL_ALL // Set to logger.LOG_LEVEL_ALL to keep Lambda log level aligned with proxy log level.
 
 // LambdaPrefix Prefix of Lambda function, overridable with command line parameter -lambda-prefix.
-const LambdaPrefix = "Your Lambda Function Prefix"
+var LambdaPrefix = "Your Lambda Function Prefix"
 
 // AWSRegion Region of AWS services.
-const AWSRegion = "us-east-1"
+var AWSRegion = "us-east-1"
 
 // LambdaMaxDeployments Number of Lambda function deployments available.
 const LambdaMaxDeployments = 400
@@ -40,7 +41,7 @@ const SliceSize = 100
 
 // NumLambdaClusters Number of Lambda function deployments initiated on launching.
 // For window cluster, this must be at least D+P
-const NumLambdaClusters = 12
+var NumLambdaClusters = 12
 
 // LambdaStoreName Obsoleted. Name of Lambda function for replica version.
 const LambdaStoreName = "LambdaStore"
@@ -65,20 +66,21 @@ const Threshold = 0.9 // Don't set beyond 0.9
 const ChunkThreshold = 125000 // Fraction, ChunkThreshold = InstanceCapacity / 100K * Threshold
 
 // ServerPublicIp Public IP of proxy, leave empty if running Lambda functions in VPC.
-const ServerPublicIp = "" // Leave it empty if Lambda VPC is enabled.
+var ServerPublicIp = "" // Leave it empty if Lambda VPC is enabled.
 
 // RecoverRate Empirical S3 download rate for specified InstanceCapacity.
 // 40MB for 512, 1024, 1536MB instance, 70MB for 3008MB instance.
 const RecoverRate = 40 * 1000000 // Not actually used.
 
 // BackupsPerInstance  Number of backup instances used for parallel recovery.
-const BackupsPerInstance = 20 // (InstanceCapacity - InstanceOverhead) / RecoverRate
+var BackupsPerInstance = 20 // (InstanceCapacity - InstanceOverhead) / RecoverRate
 
-// Each bucket's active duration
-const BucketDuration = 10 // min
+// Each bucket's active duration, reloadable on the fly. Use BucketDuration and SetBucketDuration to access.
+var bucketDuration int32 = 10 // min
 
-// Number of buckets that warmup every InstanceWarmTimeout
-const NumActiveBuckets = 6
+// Number of buckets that warmup every InstanceWarmTimeout, reloadable on the fly. Use NumActiveBuckets and
+// SetNumActiveBuckets to access.
+var numActiveBuckets int32 = 6
 
 // Number of buckets before expiring
 // Buckets beyond NumActiveBuckets but within ExpireBucketsNum will get degraded warmup: InstanceDegradeWarmTimeout
@@ -87,7 +89,44 @@ const NumAvailableBuckets = 18
 // Async migrate control
 const ActiveReplica = 2 //min
 
+// MetaStoreSnapshotInterval Interval to snapshot the persistent metastore and truncate the log.
+const MetaStoreSnapshotInterval = 10 * time.Minute
+
+// MetaStoreHeartbeatInterval Interval to send heartbeats to standby proxies replicating the metastore.
+const MetaStoreHeartbeatInterval = 1 * time.Second
+
+// MetaStoreFailoverTimeout A standby proxy takes over if the primary has been silent for the timeout.
+const MetaStoreFailoverTimeout = 5 * time.Second
+
+// ReconcileWindow Time to collect chunks reported by functions before rebuilding metas on reconciling.
+const ReconcileWindow = 30 * time.Second
+
+// ExpirationSweepInterval Interval to remove expired objects.
+const ExpirationSweepInterval = 10 * time.Second
+
 // ProxyList Ip addresses and ports in the format "ip:port" of proxies.
 // If running on one proxy, then can be left empty. For multi-proxies deployment, build static proxy list here.
 // Private ip should be used if Lambda VPC is enabled.
 var ProxyList []string
+
+// StorageClasses Storage classes selectable per object in the format "name: d=4,p=1,no-cos". The persistence policy
+// can be one of "no-cos", "async-cos", and "wait-cos", and follows LambdaFeatures if not specified.
+var StorageClasses []string
+
+// BucketDuration returns each bucket's active duration in minutes.
+func BucketDuration() int {
+	return int(atomic.LoadInt32(&bucketDuration))
+}
+
+func SetBucketDuration(min int) {
+	atomic.StoreInt32(&bucketDuration, int32(min))
+}
+
+// NumActiveBuckets returns the number of buckets that warmup every InstanceWarmTimeout.
+func NumActiveBuckets() int {
+	return int(atomic.LoadInt32(&numActiveBuckets))
+}
+
+func SetNumActiveBuckets(num int) {
+	atomic.StoreInt32(&numActiveBuckets, int32(num))
+}
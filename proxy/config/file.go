@@ -0,0 +1,120 @@
+package config
+
+import (
+	"fmt"
+
+	protocol "github.com/sionreview/sion/common/types"
+
+	configKit "github.com/gookit/config/v2"
+	"github.com/gookit/config/v2/yaml"
+)
+
+// Settings Values overridable with the configuration file. Values not specified in the file keep current settings.
+type Settings struct {
+	LambdaPrefix       string   `mapstructure:"lambda_prefix"`
+	AWSRegion          string   `mapstructure:"aws_region"`
+	NumLambdaClusters  int      `mapstructure:"num_lambda_clusters"`
+	BucketDuration     int      `mapstructure:"bucket_duration"`
+	NumActiveBuckets   int      `mapstructure:"num_active_buckets"`
+	ProxyList          []string `mapstructure:"proxy_list"`
+	ServerPublicIp     string   `mapstructure:"server_public_ip"`
+	BackupsPerInstance int      `mapstructure:"backups_per_instance"`
+	StorageClasses     []string `mapstructure:"storage_classes"`
+}
+
+// Current returns a copy of current settings.
+func Current() *Settings {
+	return &Settings{
+		LambdaPrefix:       LambdaPrefix,
+		AWSRegion:          AWSRegion,
+		NumLambdaClusters:  NumLambdaClusters,
+		BucketDuration:     BucketDuration(),
+		NumActiveBuckets:   NumActiveBuckets(),
+		ProxyList:          ProxyList,
+		ServerPublicIp:     ServerPublicIp,
+		BackupsPerInstance: BackupsPerInstance,
+		StorageClasses:     StorageClasses,
+	}
+}
+
+// LoadFile loads settings from the configuration file in YAML or JSON format, starting from current settings.
+func LoadFile(path string) (*Settings, error) {
+	kit := configKit.New("proxy")
+	kit.AddDriver(yaml.Driver)
+	if err := kit.LoadFiles(path); err != nil {
+		return nil, err
+	}
+
+	settings := Current()
+	// Slice is decoded in place, leave it empty to avoid mixing with current settings.
+	settings.ProxyList = nil
+	settings.StorageClasses = nil
+	if err := kit.BindStruct("", settings); err != nil {
+		return nil, err
+	}
+	if settings.ProxyList == nil {
+		settings.ProxyList = ProxyList
+	}
+	if settings.StorageClasses == nil {
+		settings.StorageClasses = StorageClasses
+	}
+	return settings, nil
+}
+
+// Validate checks invariants of the settings with specified number of data chunks and parity chunks.
+func (s *Settings) Validate(d int, p int) error {
+	if s.NumLambdaClusters < d+p {
+		return fmt.Errorf("num_lambda_clusters(%d) must be at least d+p(%d)", s.NumLambdaClusters, d+p)
+	} else if s.NumLambdaClusters > LambdaMaxDeployments {
+		return fmt.Errorf("num_lambda_clusters(%d) must be at most %d", s.NumLambdaClusters, LambdaMaxDeployments)
+	} else if s.BucketDuration < 1 {
+		return fmt.Errorf("bucket_duration(%d) must be positive", s.BucketDuration)
+	} else if s.NumActiveBuckets < 1 || s.NumActiveBuckets > NumAvailableBuckets {
+		return fmt.Errorf("num_active_buckets(%d) must be between 1 and %d", s.NumActiveBuckets, NumAvailableBuckets)
+	} else if s.BackupsPerInstance < 0 {
+		return fmt.Errorf("backups_per_instance(%d) must not be negative", s.BackupsPerInstance)
+	}
+
+	classes, err := protocol.ParseStorageClasses(s.StorageClasses)
+	if err != nil {
+		return err
+	}
+	for _, class := range classes {
+		if s.NumLambdaClusters < class.Shards() {
+			return fmt.Errorf("num_lambda_clusters(%d) must be at least d+p(%d) of storage class %s", s.NumLambdaClusters, class.Shards(), class.Name)
+		}
+	}
+	return nil
+}
+
+// Apply makes the settings take effect. It should be called before the proxy starts.
+func (s *Settings) Apply() {
+	LambdaPrefix = s.LambdaPrefix
+	AWSRegion = s.AWSRegion
+	NumLambdaClusters = s.NumLambdaClusters
+	ProxyList = s.ProxyList
+	ServerPublicIp = s.ServerPublicIp
+	BackupsPerInstance = s.BackupsPerInstance
+	StorageClasses = s.StorageClasses
+	s.ApplyReloadable()
+}
+
+// ApplyReloadable makes settings that are safe to change on the fly take effect. Other settings are ignored.
+// Reloadable settings are stored atomically, for they are read concurrently by the cluster.
+func (s *Settings) ApplyReloadable() {
+	SetBucketDuration(s.BucketDuration)
+	SetNumActiveBuckets(s.NumActiveBuckets)
+}
+
+// ReloadFile reloads the configuration file and applies settings that are safe to change on the fly.
+func ReloadFile(path string, d int, p int) (*Settings, error) {
+	settings, err := LoadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := settings.Validate(d, p); err != nil {
+		return nil, err
+	}
+	settings.ApplyReloadable()
+	return settings, nil
+}
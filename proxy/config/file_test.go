@@ -0,0 +1,112 @@
+package config
+
+import (
+	"os"
+	"path"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Config file", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "config")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	writeConfig := func(content string) string {
+		file := path.Join(dir, "proxy.yml")
+		Expect(os.WriteFile(file, []byte(content), 0644)).To(BeNil())
+		return file
+	}
+
+	It("should override current settings with values in the file", func() {
+		settings, err := LoadFile(writeConfig(`
+lambda_prefix: Test
+num_lambda_clusters: 24
+proxy_list:
+  - 10.0.0.1:6378
+  - 10.0.0.2:6378
+`))
+		Expect(err).To(BeNil())
+		Expect(settings.LambdaPrefix).To(Equal("Test"))
+		Expect(settings.NumLambdaClusters).To(Equal(24))
+		Expect(settings.ProxyList).To(Equal([]string{"10.0.0.1:6378", "10.0.0.2:6378"}))
+
+		// Unspecified values keep current settings.
+		Expect(settings.AWSRegion).To(Equal(AWSRegion))
+		Expect(settings.NumActiveBuckets).To(Equal(NumActiveBuckets()))
+		Expect(settings.BackupsPerInstance).To(Equal(BackupsPerInstance))
+	})
+
+	It("should load storage classes", func() {
+		settings, err := LoadFile(writeConfig(`
+storage_classes:
+  - "hot: d=4,p=1,no-cos"
+  - "durable: d=10,p=2,wait-cos"
+`))
+		Expect(err).To(BeNil())
+		Expect(settings.StorageClasses).To(Equal([]string{"hot: d=4,p=1,no-cos", "durable: d=10,p=2,wait-cos"}))
+		Expect(settings.Validate(10, 2)).To(BeNil())
+
+		settings.NumLambdaClusters = 11
+		Expect(settings.Validate(4, 1)).NotTo(BeNil())
+
+		settings = Current()
+		settings.StorageClasses = []string{"hot: d=4"}
+		Expect(settings.Validate(10, 2)).To(BeNil())
+		settings.StorageClasses = []string{"hot"}
+		Expect(settings.Validate(10, 2)).NotTo(BeNil())
+	})
+
+	It("should fail on nonexistent file", func() {
+		_, err := LoadFile(path.Join(dir, "nonexistent.yml"))
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("should validate invariants", func() {
+		settings := Current()
+		Expect(settings.Validate(10, 2)).To(BeNil())
+
+		settings.NumLambdaClusters = 11
+		Expect(settings.Validate(10, 2)).NotTo(BeNil())
+
+		settings = Current()
+		settings.NumActiveBuckets = NumAvailableBuckets + 1
+		Expect(settings.Validate(10, 2)).NotTo(BeNil())
+
+		settings = Current()
+		settings.BucketDuration = 0
+		Expect(settings.Validate(10, 2)).NotTo(BeNil())
+	})
+
+	It("should reload only reloadable settings", func() {
+		bucketDuration, numActiveBuckets, prefix := BucketDuration(), NumActiveBuckets(), LambdaPrefix
+		defer func() {
+			SetBucketDuration(bucketDuration)
+			SetNumActiveBuckets(numActiveBuckets)
+		}()
+
+		_, err := ReloadFile(writeConfig(`
+lambda_prefix: Reloaded
+bucket_duration: 5
+num_active_buckets: 3
+`), 10, 2)
+		Expect(err).To(BeNil())
+		Expect(BucketDuration()).To(Equal(5))
+		Expect(NumActiveBuckets()).To(Equal(3))
+		Expect(LambdaPrefix).To(Equal(prefix))
+
+		// Invalid settings are not applied.
+		_, err = ReloadFile(writeConfig("num_active_buckets: 0\n"), 10, 2)
+		Expect(err).NotTo(BeNil())
+		Expect(NumActiveBuckets()).To(Equal(3))
+	})
+})
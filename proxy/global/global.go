@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/sionreview/sion/common/logger"
+	protocol "github.com/sionreview/sion/common/types"
 
 	"github.com/mason-leap-lab/go-utils/promise"
 	"github.com/sionreview/sion/proxy/config"
@@ -24,6 +25,7 @@ var (
 	BaseMigratorPort = 6400
 	ServerIp         string
 	LambdaFlags      uint64
+	StorageClasses   = make(protocol.StorageClasses) // Storage classes parsed from config.StorageClasses.
 )
 
 func init() {
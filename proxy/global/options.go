@@ -16,19 +16,33 @@ const (
 )
 
 type CommandlineOptions struct {
-	Pid         string
-	Debug       bool
-	Prefix      string
-	PublicIP    string
-	D           int
-	P           int
-	NoDashboard bool
-	NoColor     bool
-	LogPath     string
-	LogFile     string
-	Evaluation  bool
-	NumBackups  int
-	NoFirstD    bool
+	Pid          string
+	Debug        bool
+	Prefix       string
+	PublicIP     string
+	D            int
+	P            int
+	NoDashboard  bool
+	NoColor      bool
+	LogPath      string
+	LogFile      string
+	Evaluation   bool
+	NumBackups   int
+	NoFirstD     bool
+	MetaStore    string
+	Metrics      string
+	Admin        string
+	AdminToken   string
+	S3           string
+	S3Bucket     string
+	Memcached    string
+	MemcachedMax int
+	RedisCluster bool
+	Replication  string
+	StandbyOf    string
+	Reconcile    bool
+	Config       string
+	PersistCache uint64
 
 	lambdaPrefix       string
 	funcCapacity       uint64
@@ -91,6 +105,7 @@ func CheckUsage(options *CommandlineOptions) {
 	flag.BoolVar(&printInfo, "h", false, "help info?")
 
 	flag.BoolVar(&options.Debug, "debug", false, "Enable debug and print debug logs.")
+	flag.StringVar(&options.Config, "config", "", "Path to the config file in YAML or JSON format. Options specified in command line override the config file.")
 	flag.StringVar(&options.Prefix, "prefix", "", "Prefix for data files.")
 	flag.StringVar(&options.lambdaPrefix, "lambda-prefix", "", "Prefix of the Lambda deployments.")
 	flag.StringVar(&options.PublicIP, "ip", "", "Public IP for non-VPC Lambda deployments.")
@@ -105,6 +120,19 @@ func CheckUsage(options *CommandlineOptions) {
 	flag.BoolVar(&options.disableRecovery, "disable-recovery", false, "Disable data recovery on function reclaimation.")
 	flag.StringVar(&options.cluster, "cluster", config.Cluster, "Cluster type. support \"static\" and \"window\"")
 	flag.IntVar(&options.numFunctions, "functions", config.NumLambdaClusters, "Number of functions initialized at launch.")
+	flag.StringVar(&options.MetaStore, "metastore", "", "Directory to persist the metastore. Metas will be restored on restarting. Leave empty to disable.")
+	flag.StringVar(&options.Replication, "replication", "", "Address to stream the metastore to standby proxies, e.g. \":6380\". Requires -metastore. Leave empty to disable.")
+	flag.StringVar(&options.StandbyOf, "standby-of", "", "Replication address of the primary proxy to stand by. The proxy takes over once the primary is lost. Requires -metastore.")
+	flag.BoolVar(&options.Reconcile, "reconcile", false, "Rebuild metas from chunks reported by functions on starting. Objects with too few chunks or no attributes reported are regarded as lost. Writes are rejected until rebuilt.")
+	flag.Uint64Var(&options.PersistCache, "persist-cache", 0, "Budget(MB) of the disk-backed persist cache stored under the base path. Chunks not yet persisted will be restored on restarting. 0 to disable.")
+	flag.StringVar(&options.Metrics, "metrics", "", "Address to expose metrics for Prometheus at /metrics, e.g. \":9090\". Leave empty to disable.")
+	flag.StringVar(&options.Admin, "admin", "", "Address to serve the admin API in HTTP/JSON, e.g. \"127.0.0.1:8080\". Addresses other than loopback require -admin-token. Leave empty to disable.")
+	flag.StringVar(&options.AdminToken, "admin-token", "", "Bearer token required by requests to the admin API. Leave empty to serve the API on loopback addresses without authentication.")
+	flag.StringVar(&options.S3, "s3", "", "Address to serve the S3-compatible gateway, e.g. \":9000\". Leave empty to disable.")
+	flag.StringVar(&options.S3Bucket, "s3-bucket", "sion", "Name of the virtual bucket served by the S3-compatible gateway.")
+	flag.StringVar(&options.Memcached, "memcached", "", "Address to serve memcached clients, e.g. \":11211\". Leave empty to disable.")
+	flag.IntVar(&options.MemcachedMax, "memcached-max-value", 1<<20, "Max size(bytes) of values accepted by the memcached frontend.")
+	flag.BoolVar(&options.RedisCluster, "redis-cluster", false, "Speak the Redis Cluster protocol. Hash slots are assigned to proxies in the order of the proxy list, which must include the local proxy.")
 
 	flag.BoolVar(&options.Evaluation, "enable-evaluation", false, "Enable evaluation settings.")
 	flag.IntVar(&options.NumBackups, "numbak", 0, "EVALUATION ONLY: The number of backups used per node.")
@@ -125,6 +153,34 @@ func CheckUsage(options *CommandlineOptions) {
 		os.Exit(0)
 	}
 
+	if (options.Replication != "" || options.StandbyOf != "") && options.MetaStore == "" {
+		fmt.Fprintf(os.Stderr, "Replication of the metastore requires -metastore.\n")
+		os.Exit(1)
+	}
+
+	// Load config file, options specified in command line will override the config file.
+	settings := config.Current()
+	if options.Config != "" {
+		var err error
+		settings, err = config.LoadFile(options.Config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load config file %s: %v\n", options.Config, err)
+			os.Exit(1)
+		}
+	}
+	if err := settings.Validate(options.D, options.P); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid config: %v\n", err)
+		os.Exit(1)
+	}
+	settings.Apply()
+	StorageClasses, _ = protocol.ParseStorageClasses(config.StorageClasses) // Validated already.
+	if !isFlagSet("functions") {
+		options.numFunctions = config.NumLambdaClusters
+	}
+	if options.PublicIP == "" {
+		options.PublicIP = config.ServerPublicIp
+	}
+
 	if options.lambdaPrefix == "" {
 		options.lambdaPrefix = config.LambdaPrefix
 	} else {
@@ -136,6 +192,12 @@ func CheckUsage(options *CommandlineOptions) {
 	}
 	Log.Info("Lambdas will connect to IP %s, make sure Lambdas are not deployed in the VPC if it is a public IP", ServerIp)
 
+	// Hash slots are assigned in the order of the proxy list, so the local proxy must be listed to own slots.
+	if options.RedisCluster && !isProxyListed(fmt.Sprintf("%s:%d", ServerIp, BasePort)) {
+		fmt.Fprintf(os.Stderr, "Redis Cluster requires the local proxy %s:%d in the proxy list.\n", ServerIp, BasePort)
+		os.Exit(1)
+	}
+
 	if !options.NoDashboard {
 		if options.LogFile == "" {
 			options.LogFile = "log"
@@ -158,3 +220,21 @@ func CheckUsage(options *CommandlineOptions) {
 		options.numFunctions = 1
 	}
 }
+
+func isFlagSet(name string) (set bool) {
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return
+}
+
+func isProxyListed(addr string) bool {
+	for _, proxy := range config.ProxyList {
+		if proxy == addr {
+			return true
+		}
+	}
+	return false
+}
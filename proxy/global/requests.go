@@ -44,6 +44,12 @@ func (c *RequestCoordinator) Len() int {
 }
 
 func (c *RequestCoordinator) Register(reqId string, cmd string, d int, p int, meta interface{}) *RequestCounter {
+	return c.RegisterRequests(reqId, cmd, d, p, d+p, meta)
+}
+
+// RegisterRequests registers the counter of n chunk requests out of d+p chunks, e.g. range reads that request only the data
+// chunks covering the range. All n requests must succeed to fulfill the counter if n < d+p.
+func (c *RequestCoordinator) RegisterRequests(reqId string, cmd string, d int, p int, n int, meta interface{}) *RequestCounter {
 	prepared := c.pool.Get().(*RequestCounter)
 	prepared.initialized.Add(1) // Block in case initalization is need.
 
@@ -55,7 +61,7 @@ func (c *RequestCoordinator) Register(reqId string, cmd string, d int, p int, me
 	counter := ret.(*RequestCounter)
 	if !ok {
 		// New counter registered, initialize values.
-		counter.reset(c, reqId, cmd, d, p, meta)
+		counter.reset(c, reqId, cmd, d, p, n, meta)
 		// Release initalization lock
 		counter.initialized.Done()
 	} else {
@@ -101,6 +107,7 @@ type RequestCounter struct {
 	reqId         string
 	status        uint64 // int32(succeed) + int32(returned)
 	numToFulfill  uint64
+	numRequests   uint64
 	initialized   sync.WaitGroup
 	refs          int32
 	waitForClient bool
@@ -110,7 +117,7 @@ func newRequestCounter() interface{} {
 	return &RequestCounter{}
 }
 
-func (counter *RequestCounter) reset(c *RequestCoordinator, reqId string, cmd string, d int, p int, meta interface{}) {
+func (counter *RequestCounter) reset(c *RequestCoordinator, reqId string, cmd string, d int, p int, n int, meta interface{}) {
 	counter.Cmd = cmd
 	counter.DataShards = d
 	counter.ParityShards = p
@@ -123,13 +130,22 @@ func (counter *RequestCounter) reset(c *RequestCoordinator, reqId string, cmd st
 		(Options.Evaluation && Options.NoFirstD) {
 		counter.numToFulfill = uint64(d + p)
 	}
+	counter.numRequests = uint64(n)
+	if n < d+p {
+		// Chunks requested are all required.
+		counter.numToFulfill = counter.numRequests
+	}
 	l := int(d + p)
 	if cap(counter.Requests) < l {
 		counter.Requests = make([]*types.Request, l)
 	} else if len(counter.Requests) != l {
 		counter.Requests = counter.Requests[:l]
 	}
-	counter.waitForClient = IsClientsideFirstDOptimization() && counter.numToFulfill < uint64(l)
+	// Clear requests of the last use, chunks may not be requested all.
+	for i := range counter.Requests {
+		counter.Requests[i] = nil
+	}
+	counter.waitForClient = IsClientsideFirstDOptimization() && counter.numToFulfill < counter.numRequests
 }
 
 func (c *RequestCounter) String() string {
@@ -211,14 +227,14 @@ func (c *RequestCounter) IsAllReturned(status ...uint64) bool {
 	if len(status) == 0 {
 		return c.IsAllReturned(c.Status())
 	}
-	return status[0]&REQCNT_MASK_RETURNED >= uint64(c.DataShards+c.ParityShards)
+	return status[0]&REQCNT_MASK_RETURNED >= c.numRequests
 }
 
 func (c *RequestCounter) IsAllFlushed(status ...uint64) bool {
 	if len(status) == 0 {
 		return c.IsAllFlushed(c.Status())
 	}
-	return status[0]&REQCNT_MASK_FLUSHED>>REQCNT_BITS_FLUSHED >= uint64(c.DataShards+c.ParityShards)
+	return status[0]&REQCNT_MASK_FLUSHED>>REQCNT_BITS_FLUSHED >= c.numRequests
 }
 
 func (c *RequestCounter) Release() {
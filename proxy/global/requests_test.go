@@ -44,7 +44,7 @@ var _ = Describe("RequestCoordinator", func() {
 
 	It("should single chunk request be recycled", func() {
 		counter := &TestRequestCounter{}
-		counter.reset(coordinator, "test", "get", 1, 0, nil)
+		counter.reset(coordinator, "test", "get", 1, 0, 1, nil)
 		req := newRequest(counter, "0")
 		err := req.SetErrorResponse(errDummyResponse)
 
@@ -54,7 +54,7 @@ var _ = Describe("RequestCoordinator", func() {
 
 	It("should timeout in request lock free", func() {
 		counter := &TestRequestCounter{}
-		counter.reset(coordinator, "test", "get", 1, 0, nil)
+		counter.reset(coordinator, "test", "get", 1, 0, 1, nil)
 		req := newRequest(counter, "0")
 
 		go func() {
@@ -69,4 +69,19 @@ var _ = Describe("RequestCoordinator", func() {
 		<-time.After(100 * time.Millisecond)
 		Expect(counter.recycled).To(Equal(int32(1)))
 	})
+
+	It("should partial requests be fulfilled and recycled after all requested chunks returned", func() {
+		counter := &TestRequestCounter{}
+		counter.reset(coordinator, "test", "get", 4, 2, 2, nil)
+		newRequest(counter, "1")
+		newRequest(counter, "2")
+
+		counter.AddSucceeded(1, false)
+		Expect(counter.IsFulfilled()).To(BeFalse())
+		Expect(counter.IsAllReturned()).To(BeFalse())
+
+		counter.AddSucceeded(2, false)
+		Expect(counter.IsFulfilled()).To(BeTrue())
+		Expect(counter.IsAllReturned()).To(BeTrue())
+	})
 })
@@ -1069,7 +1069,12 @@ func (conn *Connection) persistedHandler(success bool) {
 
 	// Exhaust all values to keep protocol aligned.
 	key, _ := conn.r.ReadBulkString()
-	persistChunk := CM.GetPersistCache().Get(key)
+	cache := CM.GetPersistCache()
+	if cache == nil {
+		// Chunks of storage classes are confirmed even if the persist cache is disabled.
+		return
+	}
+	persistChunk := cache.Get(key)
 	if persistChunk == nil {
 		conn.log.Warn("Persisted chunk not found: %s.", key)
 		return
@@ -1160,7 +1165,19 @@ func (conn *Connection) piggybackHandler(flags int64, payload []byte) error {
 	}
 
 	instance := conn.instance
-	if flags&protocol.PONG_RECONCILE > 0 {
+	if flags&protocol.PONG_INVENTORY > 0 {
+		var inventory protocol.InventoryPayload
+		if err := binary.Unmarshal(payload, &inventory); err != nil {
+			conn.log.Warn("Invalid inventory: %v", err)
+			return nil
+		}
+		if instance != nil && Inventories != nil {
+			Inventories.Collect(instance, inventory.Chunks)
+		}
+		if flags&protocol.PONG_RECONCILE > 0 && instance != nil {
+			instance.reconcileStatus(conn, &inventory.Meta)
+		}
+	} else if flags&protocol.PONG_RECONCILE > 0 {
 		var shortMeta protocol.ShortMeta
 		if err := binary.Unmarshal(payload, &shortMeta); err != nil {
 			conn.log.Warn("Invalid meta on reconciling: %v", err)
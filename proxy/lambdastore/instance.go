@@ -100,6 +100,7 @@ const (
 
 var (
 	CM             ClusterManager
+	Inventories    InventoryCollector // Set to collect inventories of instances on reconciling.
 	WarmTimeout    = config.InstanceWarmTimeout
 	TriggerTimeout = 1 * time.Second // Triggering cost is about 20ms, set large enough to avoid exceeded timeout
 	// TODO: Make RTT dynamic, global or per instance.
@@ -158,6 +159,15 @@ type ClusterManager interface {
 	Relocator
 }
 
+// InventoryCollector Collects chunks reported by instances, see protocol.FLAG_REPORT_INVENTORY.
+type InventoryCollector interface {
+	// IsCollecting returns true if instances should report chunks stored.
+	IsCollecting() bool
+
+	// Collect collects chunks reported by the instance.
+	Collect(*Instance, []protocol.ChunkInventory)
+}
+
 type ValidateOption struct {
 	Notifier  chan struct{}
 	Validated *Connection
@@ -313,6 +323,11 @@ func (ins *Instance) StatusDescription() string {
 	}
 }
 
+// NumBackups returns the number of backups required and available.
+func (ins *Instance) NumBackups() (int, int) {
+	return ins.backups.Len(), ins.backups.Availables()
+}
+
 func (ins *Instance) AssignBackups(numBak int, candidates []*Instance) {
 	ins.backups.ResetCandidates(numBak, candidates)
 }
@@ -1050,6 +1065,9 @@ func (ins *Instance) doTriggerLambda(opt *ValidateOption) error {
 	if atomic.LoadUint32(&ins.phase) != PHASE_ACTIVE {
 		localFlags |= protocol.FLAG_BACKING_ONLY
 	}
+	if Inventories != nil && Inventories.IsCollecting() {
+		localFlags |= protocol.FLAG_REPORT_INVENTORY
+	}
 	event := &protocol.InputEvent{
 		Sid:     ins.initSession(),
 		Cmd:     protocol.CMD_PING,
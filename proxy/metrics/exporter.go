@@ -0,0 +1,143 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/sionreview/sion/proxy/types"
+)
+
+const (
+	// ContentType is the content type of the Prometheus text exposition format.
+	ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+	// Path is the path metrics are exposed at.
+	Path = "/metrics"
+)
+
+// Exporter exposes metrics of the proxy in the Prometheus text exposition format.
+type Exporter struct {
+	// Server provides stats of the proxy, optional.
+	Server types.ServerStats
+	// Cluster provides stats of the cluster, either types.ClusterStats or types.GroupedClusterStats, optional.
+	Cluster interface{}
+	// Serving returns the number of requests in flight, optional.
+	Serving func() int
+}
+
+// Serve starts serving metrics on the address in background. The server is returned for closing.
+func Serve(addr string, exporter *Exporter) (*http.Server, error) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(Path, exporter)
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(lis)
+	return srv, nil
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	e.Write(w)
+}
+
+// Write writes all metrics to the writer.
+func (e *Exporter) Write(writer io.Writer) error {
+	w := bufio.NewWriter(writer)
+
+	header(w, "sion_request_duration_seconds", "histogram", "End-to-end latency of requests served by the proxy.")
+	rangeRequests(func(l requestLabels, h *Histogram) {
+		bounds, counts := h.Buckets()
+		for i, bound := range bounds {
+			fmt.Fprintf(w, "sion_request_duration_seconds_bucket{cmd=%q,status=%q,le=%q} %d\n", l.cmd, l.status, formatFloat(bound), counts[i])
+		}
+		total := counts[len(counts)-1]
+		fmt.Fprintf(w, "sion_request_duration_seconds_bucket{cmd=%q,status=%q,le=\"+Inf\"} %d\n", l.cmd, l.status, total)
+		fmt.Fprintf(w, "sion_request_duration_seconds_sum{cmd=%q,status=%q} %s\n", l.cmd, l.status, formatFloat(h.Sum().Seconds()))
+		fmt.Fprintf(w, "sion_request_duration_seconds_count{cmd=%q,status=%q} %d\n", l.cmd, l.status, total)
+	})
+
+	if e.Serving != nil {
+		header(w, "sion_requests_in_flight", "gauge", "Requests being served by the proxy.")
+		fmt.Fprintf(w, "sion_requests_in_flight %d\n", e.Serving())
+	}
+
+	header(w, "sion_relocations_total", "counter", "Chunks relocated to other instances.")
+	fmt.Fprintf(w, "sion_relocations_total %d\n", Relocations.Value())
+	header(w, "sion_recoveries_total", "counter", "Chunks recovered from reclaimed instances.")
+	fmt.Fprintf(w, "sion_recoveries_total %d\n", Recoveries.Value())
+
+	if e.Server != nil {
+		header(w, "sion_persist_cache_chunks", "gauge", "Chunks held in the persist cache.")
+		fmt.Fprintf(w, "sion_persist_cache_chunks %d\n", e.Server.PersistCacheLen())
+	}
+
+	e.writeCluster(w)
+
+	return w.Flush()
+}
+
+func (e *Exporter) writeCluster(w *bufio.Writer) {
+	var meta types.MetaStoreStats
+	var clusters []types.ClusterStats
+	switch stats := e.Cluster.(type) {
+	case types.ClusterStats:
+		meta = stats.MetaStats()
+		clusters = append(clusters, stats)
+	case types.GroupedClusterStats:
+		meta = stats.MetaStats()
+		iter := stats.AllClustersStats()
+		for iter.Next() {
+			_, cluster := stats.ClusterStatsFromIterator(iter)
+			clusters = append(clusters, cluster)
+		}
+	default:
+		return
+	}
+
+	if meta != nil {
+		header(w, "sion_metastore_objects", "gauge", "Entries in the metastore.")
+		fmt.Fprintf(w, "sion_metastore_objects %d\n", meta.Len())
+	}
+
+	header(w, "sion_cluster_buckets", "gauge", "Buckets of instances in the cluster.")
+	fmt.Fprintf(w, "sion_cluster_buckets %d\n", len(clusters))
+
+	header(w, "sion_cluster_instances", "gauge", "Instances in the bucket.")
+	for i, cluster := range clusters {
+		fmt.Fprintf(w, "sion_cluster_instances{bucket=\"%d\"} %d\n", i, cluster.InstanceLen())
+	}
+
+	header(w, "sion_instance_occupancy", "gauge", "Occupancy of the instance.")
+	for i, cluster := range clusters {
+		iter := cluster.AllInstancesStats()
+		for iter.Next() {
+			j, ins := cluster.InstanceStatsFromIterator(iter)
+			if ins == nil {
+				continue
+			}
+			id := strconv.Itoa(j)
+			if identified, ok := ins.(interface{ Id() uint64 }); ok {
+				id = strconv.FormatUint(identified.Id(), 10)
+			}
+			fmt.Fprintf(w, "sion_instance_occupancy{bucket=\"%d\",instance=%q} %s\n", i, id,
+				formatFloat(ins.Occupancy(types.InstanceOccupancyMain)))
+		}
+	}
+}
+
+func header(w io.Writer, name string, typ string, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
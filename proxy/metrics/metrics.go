@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// LatencyBuckets are upper bounds (in seconds) of buckets of request latency histograms.
+	LatencyBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+	// Relocations counts chunks relocated to other instances.
+	Relocations Counter
+	// Recoveries counts chunks recovered from reclaimed instances.
+	Recoveries Counter
+
+	requests sync.Map // requestLabels -> *Histogram
+)
+
+type requestLabels struct {
+	cmd    string
+	status string
+}
+
+// Counter is a monotonically increasing counter that is safe for concurrent use.
+type Counter struct {
+	value uint64
+}
+
+func (c *Counter) Inc() {
+	atomic.AddUint64(&c.value, 1)
+}
+
+func (c *Counter) Value() uint64 {
+	return atomic.LoadUint64(&c.value)
+}
+
+// Histogram counts observations in cumulative buckets. It is safe for concurrent use.
+type Histogram struct {
+	bounds []float64
+	counts []uint64 // Non-cumulative counts, the last one is for +Inf.
+	sum    int64    // In nanoseconds.
+}
+
+func NewHistogram(bounds []float64) *Histogram {
+	return &Histogram{
+		bounds: bounds,
+		counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+func (h *Histogram) Observe(d time.Duration) {
+	i := sort.SearchFloat64s(h.bounds, d.Seconds())
+	atomic.AddUint64(&h.counts[i], 1)
+	atomic.AddInt64(&h.sum, int64(d))
+}
+
+// Buckets returns the cumulative counts of buckets with the bounds, the last one is the total count.
+func (h *Histogram) Buckets() ([]float64, []uint64) {
+	cumulative := make([]uint64, len(h.counts))
+	var total uint64
+	for i := range h.counts {
+		total += atomic.LoadUint64(&h.counts[i])
+		cumulative[i] = total
+	}
+	return h.bounds, cumulative
+}
+
+// Sum returns the sum of all observations.
+func (h *Histogram) Sum() time.Duration {
+	return time.Duration(atomic.LoadInt64(&h.sum))
+}
+
+// ObserveRequest records the end-to-end latency of a request served by the proxy.
+func ObserveRequest(cmd string, status string, d time.Duration) {
+	labels := requestLabels{cmd: cmd, status: status}
+	h, ok := requests.Load(labels)
+	if !ok {
+		h, _ = requests.LoadOrStore(labels, NewHistogram(LatencyBuckets))
+	}
+	h.(*Histogram).Observe(d)
+}
+
+// rangeRequests iterates request histograms in the order of labels.
+func rangeRequests(cb func(requestLabels, *Histogram)) {
+	labels := make([]requestLabels, 0, 10)
+	requests.Range(func(key, _ interface{}) bool {
+		labels = append(labels, key.(requestLabels))
+		return true
+	})
+	sort.Slice(labels, func(i, j int) bool {
+		if labels[i].cmd != labels[j].cmd {
+			return labels[i].cmd < labels[j].cmd
+		}
+		return labels[i].status < labels[j].status
+	})
+	for _, l := range labels {
+		h, _ := requests.Load(l)
+		cb(l, h.(*Histogram))
+	}
+}
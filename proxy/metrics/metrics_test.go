@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sionreview/sion/proxy/types"
+)
+
+type testInstance struct {
+	id        uint64
+	occupancy float64
+}
+
+func (ins *testInstance) Id() uint64 {
+	return ins.id
+}
+
+func (ins *testInstance) Status() uint64 {
+	return 0
+}
+
+func (ins *testInstance) Occupancy(_ types.InstanceOccupancyMode) float64 {
+	return ins.occupancy
+}
+
+type testMetaStats int
+
+func (s testMetaStats) Len() int {
+	return int(s)
+}
+
+type testCluster []*testInstance
+
+func (c testCluster) InstanceLen() int {
+	return len(c)
+}
+
+func (c testCluster) InstanceStats(i int) types.InstanceStats {
+	return c[i]
+}
+
+func (c testCluster) AllInstancesStats() types.Iterator {
+	return types.NewStatsIterator(c, len(c))
+}
+
+func (c testCluster) InstanceStatsFromIterator(iter types.Iterator) (int, types.InstanceStats) {
+	i, _ := iter.Value()
+	return i, c[i]
+}
+
+func (c testCluster) MetaStats() types.MetaStoreStats {
+	return testMetaStats(5)
+}
+
+type testServer int
+
+func (s testServer) PersistCacheLen() int {
+	return int(s)
+}
+
+var _ = Describe("Metrics", func() {
+	It("should histogram count observations in cumulative buckets", func() {
+		h := NewHistogram([]float64{0.01, 0.1, 1})
+		h.Observe(5 * time.Millisecond)
+		h.Observe(10 * time.Millisecond)
+		h.Observe(50 * time.Millisecond)
+		h.Observe(2 * time.Second)
+
+		bounds, counts := h.Buckets()
+		Expect(bounds).To(Equal([]float64{0.01, 0.1, 1}))
+		Expect(counts).To(Equal([]uint64{2, 3, 3, 4}))
+		Expect(h.Sum()).To(Equal(2065 * time.Millisecond))
+	})
+
+	It("should export metrics in the text format", func() {
+		ObserveRequest("get", "200", 3*time.Millisecond)
+		ObserveRequest("get", "200", 30*time.Millisecond)
+		ObserveRequest("get", "404", time.Millisecond)
+		Relocations.Inc()
+		Recoveries.Inc()
+
+		exporter := &Exporter{
+			Server:  testServer(2),
+			Cluster: testCluster{{id: 1, occupancy: 0.5}, {id: 2, occupancy: 0.25}},
+			Serving: func() int { return 3 },
+		}
+		var out strings.Builder
+		Expect(exporter.Write(&out)).To(BeNil())
+
+		lines := strings.Split(out.String(), "\n")
+		Expect(lines).To(ContainElements(
+			"# TYPE sion_request_duration_seconds histogram",
+			`sion_request_duration_seconds_bucket{cmd="get",status="200",le="0.005"} 1`,
+			`sion_request_duration_seconds_bucket{cmd="get",status="200",le="+Inf"} 2`,
+			`sion_request_duration_seconds_count{cmd="get",status="200"} 2`,
+			`sion_request_duration_seconds_count{cmd="get",status="404"} 1`,
+			"sion_requests_in_flight 3",
+			"sion_relocations_total 1",
+			"sion_recoveries_total 1",
+			"sion_persist_cache_chunks 2",
+			"sion_metastore_objects 5",
+			"sion_cluster_buckets 1",
+			`sion_cluster_instances{bucket="0"} 2`,
+			`sion_instance_occupancy{bucket="0",instance="1"} 0.5`,
+			`sion_instance_occupancy{bucket="0",instance="2"} 0.25`,
+		))
+	})
+})
@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	syslog "log"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"path"
@@ -21,7 +22,9 @@ import (
 	"github.com/sionreview/sion/proxy/config"
 	"github.com/sionreview/sion/proxy/dashboard"
 	"github.com/sionreview/sion/proxy/global"
+	"github.com/sionreview/sion/proxy/metrics"
 	"github.com/sionreview/sion/proxy/server"
+	"github.com/sionreview/sion/proxy/server/metastore"
 )
 
 var (
@@ -84,6 +87,27 @@ func main() {
 	// Initialize collector
 	collector.Create(path.Join(options.LogPath, options.Prefix))
 
+	// Stand by until the primary is lost, then take over by recovering the metastore replicated.
+	if options.StandbyOf != "" {
+		standby := metastore.NewStandby(options.StandbyOf, options.MetaStore)
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT, syscall.SIGABRT)
+		go func() {
+			if _, ok := <-stop; ok {
+				standby.Close()
+			}
+		}()
+		log.Info("Standing by primary %s", options.StandbyOf)
+		replicated, err := standby.Wait()
+		signal.Stop(stop)
+		close(stop)
+		if err != nil {
+			log.Error("Stop standing by: %v", err)
+			return
+		}
+		log.Info("Taking over primary %s: %d metas replicated.", options.StandbyOf, replicated)
+	}
+
 	clientLis, err := net.Listen("tcp", fmt.Sprintf(":%d", global.BasePort))
 	if err != nil {
 		log.Error("Failed to listen clients: %v", err)
@@ -116,8 +140,62 @@ func main() {
 	// config server
 	srv.HandleStreamFunc(protocol.CMD_SET_CHUNK, prxy.HandleSetChunk)
 	srv.HandleFunc(protocol.CMD_GET_CHUNK, prxy.HandleGetChunk)
+	srv.HandleFunc(protocol.CMD_DEL_CHUNK, prxy.HandleDelChunk)
+	srv.HandleFunc(protocol.CMD_SCAN_KEYS, prxy.HandleScanKeys)
 	srv.HandleCallbackFunc(prxy.HandleCallback)
 
+	// Start metrics exporter
+	var metricsSrv *http.Server
+	if options.Metrics != "" {
+		metricsSrv, err = metrics.Serve(options.Metrics, &metrics.Exporter{
+			Server:  prxy,
+			Cluster: prxy.GetStatsProvider(),
+			Serving: global.ReqCoordinator.Len,
+		})
+		if err != nil {
+			log.Error("Failed to listen metrics: %v", err)
+			return
+		}
+		log.Info("Start exposing metrics(%s%s)", options.Metrics, metrics.Path)
+	}
+
+	// Start admin API
+	var admin *server.AdminServer
+	if options.Admin != "" {
+		admin = server.NewAdminServer(prxy, options.AdminToken)
+		if err := admin.Serve(options.Admin); err != nil {
+			log.Error("Failed to listen admin API: %v", err)
+			return
+		}
+		log.Info("Start serving admin API(%s)", options.Admin)
+	}
+
+	// S3 gateway and memcached are served after the proxy is ready
+	var gateway *server.S3Gateway
+	if options.S3 != "" {
+		gateway = server.NewS3Gateway(redis, options.S3Bucket)
+	}
+	var memcached *server.MemcachedAdapter
+	if options.Memcached != "" {
+		server.MemcachedMaxValueSize = options.MemcachedMax
+		memcached = server.NewMemcachedAdapter(redis)
+	}
+
+	// Reload config on SIGHUP
+	if options.Config != "" {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				if _, err := config.ReloadFile(options.Config, options.D, options.P); err != nil {
+					log.Warn("Failed to reload config file %s: %v", options.Config, err)
+				} else {
+					log.Info("Config reloaded: %s", options.Config)
+				}
+			}
+		}()
+	}
+
 	// Log goroutine
 	done.Add(1)
 	go func() {
@@ -138,6 +216,18 @@ func main() {
 
 		prxy.Close()
 		redis.Close()
+		if metricsSrv != nil {
+			metricsSrv.Close()
+		}
+		if admin != nil {
+			admin.Close()
+		}
+		if gateway != nil {
+			gateway.Close()
+		}
+		if memcached != nil {
+			memcached.Close()
+		}
 		done.Done()
 	}()
 
@@ -150,6 +240,27 @@ func main() {
 	if dash != nil {
 		dash.Update()
 	}
+	if options.Replication != "" {
+		if err := prxy.ServeReplication(options.Replication); err != nil {
+			log.Error("Failed to serve replication: %v", err)
+			return
+		}
+		log.Info("Start replicating metastore to standby proxies(%s)", options.Replication)
+	}
+	if gateway != nil {
+		if err := gateway.Serve(options.S3); err != nil {
+			log.Error("Failed to listen S3 gateway: %v", err)
+			return
+		}
+		log.Info("Start serving S3 gateway(%s/%s)", options.S3, options.S3Bucket)
+	}
+	if memcached != nil {
+		if err := memcached.Serve(options.Memcached); err != nil {
+			log.Error("Failed to listen memcached clients: %v", err)
+			return
+		}
+		log.Info("Start listening to memcached clients(%s)", options.Memcached)
+	}
 
 	// Pid is only written after ready
 	err = ioutil.WriteFile(options.Pid, []byte(fmt.Sprintf("%d", os.Getpid())), 0640)
@@ -0,0 +1,384 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"strconv"
+	"strings"
+
+	"github.com/sionreview/sion/common/logger"
+	"github.com/sionreview/sion/proxy/global"
+	"github.com/sionreview/sion/proxy/lambdastore"
+	"github.com/sionreview/sion/proxy/server/metastore"
+	"github.com/sionreview/sion/proxy/types"
+)
+
+const (
+	// AdminPathPprof is the path profiles are served at.
+	AdminPathPprof = "/debug/pprof/"
+)
+
+var (
+	// LogLevels Names of log levels accepted by the admin API.
+	LogLevels = map[string]int{
+		"debug": logger.LOG_LEVEL_ALL,
+		"info":  logger.LOG_LEVEL_INFO,
+		"warn":  logger.LOG_LEVEL_WARN,
+		"none":  logger.LOG_LEVEL_NONE,
+	}
+
+	errAdminUnsupported = errors.New("not supported by the cluster")
+
+	// ErrAdminUnauthenticated Error of serving the admin API on addresses other than loopback without a token.
+	ErrAdminUnauthenticated = errors.New("admin API must be served on loopback addresses unless a token is set")
+)
+
+// Rotator Clusters that can be rotated on request.
+type Rotator interface {
+	RequestRotation() error
+}
+
+// AdminServer serves the HTTP/JSON API to operate the proxy:
+//
+//	GET  /instances                    List instances.
+//	GET  /instances/{id}               Show the instance.
+//	POST /instances/{id}/warmup        Warm up the instance in background.
+//	POST /instances/{id}/expire        Expire the instance. Active instances are degraded first.
+//	POST /cluster/rotate               Rotate the moving window.
+//	GET  /objects/{key}[?version=N]    Show the meta of the object.
+//	GET  /log/level                    Show the log level.
+//	PUT  /log/level?level=info         Change the log level, one of debug, info, warn, and none.
+//	GET  /debug/pprof/                 Profiles served by net/http/pprof.
+//
+// If a token is set, requests must be authenticated by the header "Authorization: Bearer <token>". Otherwise, the API
+// is served on loopback addresses only.
+type AdminServer struct {
+	proxy  *Proxy
+	token  string
+	mux    *http.ServeMux
+	server *http.Server
+	log    logger.ILogger
+}
+
+type adminInstance struct {
+	Id               uint64  `json:"id"`
+	Name             string  `json:"name"`
+	Bucket           int     `json:"bucket"`
+	Status           uint64  `json:"status"`
+	Description      string  `json:"description"`
+	Phase            uint32  `json:"phase"`
+	Occupancy        float64 `json:"occupancy"`
+	Backups          int     `json:"backups"`
+	AvailableBackups int     `json:"available_backups"`
+}
+
+type adminObject struct {
+	Key             string   `json:"key"`
+	Version         int      `json:"version"`
+	PreviousVersion int      `json:"previous_version"`
+	Size            int64    `json:"size"`
+	DChunks         int      `json:"d"`
+	PChunks         int      `json:"p"`
+	ChunkSize       int64    `json:"chunk_size"`
+	Placement       []uint64 `json:"placement"`
+	Checksums       []uint64 `json:"checksums"`
+	Class           string   `json:"class,omitempty"`
+	Replicated      bool     `json:"replicated"`
+	NumFrags        int      `json:"fragments"`
+	Codec           string   `json:"codec,omitempty"`
+	ClientFlags     uint32   `json:"client_flags"`
+	TTL             int64    `json:"ttl"` // In seconds, 0 if the object never expires.
+	Created         bool     `json:"created"`
+	Deleted         bool     `json:"deleted"`
+	Removed         bool     `json:"removed"`
+}
+
+// NewAdminServer creates the admin API of the proxy. Requests are authenticated by the token if not empty.
+func NewAdminServer(proxy *Proxy, token string) *AdminServer {
+	admin := &AdminServer{
+		proxy: proxy,
+		token: token,
+		mux:   http.NewServeMux(),
+		log:   global.GetLogger("Admin: "),
+	}
+	admin.mux.HandleFunc("/instances", admin.handleInstances)
+	admin.mux.HandleFunc("/instances/", admin.handleInstance)
+	admin.mux.HandleFunc("/cluster/rotate", admin.handleRotate)
+	admin.mux.HandleFunc("/objects/", admin.handleObject)
+	admin.mux.HandleFunc("/log/level", admin.handleLogLevel)
+	admin.mux.HandleFunc(AdminPathPprof, pprof.Index)
+	admin.mux.HandleFunc(AdminPathPprof+"cmdline", pprof.Cmdline)
+	admin.mux.HandleFunc(AdminPathPprof+"profile", pprof.Profile)
+	admin.mux.HandleFunc(AdminPathPprof+"symbol", pprof.Symbol)
+	admin.mux.HandleFunc(AdminPathPprof+"trace", pprof.Trace)
+	return admin
+}
+
+// Serve starts serving the API on the address in background. ErrAdminUnauthenticated will be returned if the address is
+// not a loopback address and no token is set.
+func (a *AdminServer) Serve(addr string) error {
+	if a.token == "" && !isLoopback(addr) {
+		return ErrAdminUnauthenticated
+	}
+
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	a.server = &http.Server{Handler: a}
+	go a.server.Serve(lis)
+	return nil
+}
+
+func (a *AdminServer) Close() {
+	if a.server != nil {
+		a.server.Close()
+	}
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (a *AdminServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if a.token != "" {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") || subtle.ConstantTimeCompare([]byte(auth[len("Bearer "):]), []byte(a.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			a.writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+	}
+	a.mux.ServeHTTP(w, r)
+}
+
+// isLoopback returns true if the address listens on loopback interfaces only.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	} else if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (a *AdminServer) handleInstances(w http.ResponseWriter, r *http.Request) {
+	if !a.allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	instances := make([]*adminInstance, 0)
+	a.rangeInstances(func(bucket int, ins *lambdastore.Instance) {
+		instances = append(instances, newAdminInstance(bucket, ins))
+	})
+	a.writeJSON(w, http.StatusOK, instances)
+}
+
+func (a *AdminServer) handleInstance(w http.ResponseWriter, r *http.Request) {
+	path := strings.Split(strings.TrimPrefix(r.URL.Path, "/instances/"), "/")
+	id, err := strconv.ParseUint(path[0], 10, 64)
+	if err != nil || len(path) > 2 {
+		a.writeError(w, http.StatusNotFound, "unknown path")
+		return
+	}
+	bucket := -1
+	var instance *lambdastore.Instance
+	a.rangeInstances(func(b int, ins *lambdastore.Instance) {
+		if ins.Id() == id {
+			bucket, instance = b, ins
+		}
+	})
+	if instance == nil {
+		a.writeError(w, http.StatusNotFound, "instance not found")
+		return
+	}
+
+	op := ""
+	if len(path) == 2 {
+		op = path[1]
+	}
+	switch op {
+	case "":
+		if !a.allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		a.writeJSON(w, http.StatusOK, newAdminInstance(bucket, instance))
+	case "warmup":
+		if !a.allowMethod(w, r, http.MethodPost) {
+			return
+		}
+		a.log.Info("Warming up %v on request", instance)
+		go instance.WarmUp()
+		a.writeJSON(w, http.StatusAccepted, newAdminInstance(bucket, instance))
+	case "expire":
+		if !a.allowMethod(w, r, http.MethodPost) {
+			return
+		}
+		a.log.Info("Expiring %v on request", instance)
+		instance.Degrade()
+		instance.Expire()
+		a.writeJSON(w, http.StatusOK, newAdminInstance(bucket, instance))
+	default:
+		a.writeError(w, http.StatusNotFound, "unknown operation")
+	}
+}
+
+func (a *AdminServer) handleRotate(w http.ResponseWriter, r *http.Request) {
+	if !a.allowMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	rotator, ok := a.proxy.cluster.(Rotator)
+	if !ok {
+		a.writeError(w, http.StatusNotImplemented, errAdminUnsupported.Error())
+		return
+	}
+	a.log.Info("Rotating the cluster on request")
+	if err := rotator.RequestRotation(); err != nil {
+		a.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	a.writeJSON(w, http.StatusOK, map[string]string{"result": "rotated"})
+}
+
+func (a *AdminServer) handleObject(w http.ResponseWriter, r *http.Request) {
+	if !a.allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/objects/")
+	var meta *metastore.Meta
+	var ok bool
+	if raw := r.URL.Query().Get("version"); raw != "" {
+		version, err := strconv.Atoi(raw)
+		if err != nil {
+			a.writeError(w, http.StatusBadRequest, "invalid version")
+			return
+		}
+		meta, ok = a.proxy.store.GetByVersion(key, version)
+	} else {
+		meta, ok = a.proxy.store.Get(key)
+	}
+	if !ok || meta == nil {
+		a.writeError(w, http.StatusNotFound, "object not found")
+		return
+	}
+	a.writeJSON(w, http.StatusOK, newAdminObject(meta))
+}
+
+func (a *AdminServer) handleLogLevel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		name := r.URL.Query().Get("level")
+		level, ok := LogLevels[strings.ToLower(name)]
+		if !ok {
+			a.writeError(w, http.StatusBadRequest, "invalid level, one of debug, info, warn, and none expected")
+			return
+		}
+		global.SetLoggerLevel(level)
+		a.log.Info("Log level changed to %s on request", name)
+	default:
+		a.allowMethod(w, r, http.MethodGet, http.MethodPut)
+		return
+	}
+
+	level := global.Log.GetLevel()
+	for name, l := range LogLevels {
+		if l == level {
+			a.writeJSON(w, http.StatusOK, map[string]string{"level": name})
+			return
+		}
+	}
+	a.writeJSON(w, http.StatusOK, map[string]int{"level": level})
+}
+
+// rangeInstances iterates instances of all buckets. Buckets are numbered in the order of iteration.
+func (a *AdminServer) rangeInstances(cb func(int, *lambdastore.Instance)) {
+	var clusters []types.ClusterStats
+	switch stats := a.proxy.GetStatsProvider().(type) {
+	case types.ClusterStats:
+		clusters = append(clusters, stats)
+	case types.GroupedClusterStats:
+		iter := stats.AllClustersStats()
+		for iter.Next() {
+			_, cluster := stats.ClusterStatsFromIterator(iter)
+			clusters = append(clusters, cluster)
+		}
+	}
+
+	for i, cluster := range clusters {
+		iter := cluster.AllInstancesStats()
+		for iter.Next() {
+			_, stats := cluster.InstanceStatsFromIterator(iter)
+			if ins, ok := stats.(*lambdastore.Instance); ok && ins != nil {
+				cb(i, ins)
+			}
+		}
+	}
+}
+
+func (a *AdminServer) allowMethod(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	a.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	return false
+}
+
+func (a *AdminServer) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		a.log.Warn("Failed to write response: %v", err)
+	}
+}
+
+func (a *AdminServer) writeError(w http.ResponseWriter, status int, msg string) {
+	a.writeJSON(w, status, map[string]string{"error": msg})
+}
+
+func newAdminInstance(bucket int, ins *lambdastore.Instance) *adminInstance {
+	backups, availables := ins.NumBackups()
+	return &adminInstance{
+		Id:               ins.Id(),
+		Name:             ins.Name(),
+		Bucket:           bucket,
+		Status:           ins.Status(),
+		Description:      ins.Description(),
+		Phase:            ins.Phase(),
+		Occupancy:        ins.Occupancy(types.InstanceOccupancyMain),
+		Backups:          backups,
+		AvailableBackups: availables,
+	}
+}
+
+func newAdminObject(meta *metastore.Meta) *adminObject {
+	return &adminObject{
+		Key:             meta.RawKey(),
+		Version:         meta.Version(),
+		PreviousVersion: meta.PreviousVersion(),
+		Size:            meta.Size,
+		DChunks:         meta.DChunks,
+		PChunks:         meta.PChunks,
+		ChunkSize:       meta.ChunkSize,
+		Placement:       meta.Placement,
+		Checksums:       meta.Checksums,
+		Class:           meta.Class,
+		Replicated:      meta.Replicated,
+		NumFrags:        meta.NumFrags,
+		Codec:           meta.Codec,
+		ClientFlags:     meta.ClientFlags,
+		TTL:             int64(meta.TTL().Seconds()),
+		Created:         meta.IsCreated(),
+		Deleted:         meta.IsDeleted(),
+		Removed:         meta.IsRemoved(),
+	}
+}
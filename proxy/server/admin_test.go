@@ -0,0 +1,102 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/sionreview/sion/common/logger"
+	"github.com/sionreview/sion/proxy/global"
+	"github.com/sionreview/sion/proxy/server/metastore"
+)
+
+var _ = Describe("AdminServer", func() {
+	var store *metastore.MetaStore
+	var admin *AdminServer
+
+	BeforeEach(func() {
+		store = metastore.New()
+		admin = NewAdminServer(&Proxy{store: store}, "")
+	})
+
+	request := func(method string, target string, v interface{}) int {
+		w := httptest.NewRecorder()
+		admin.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		if v != nil {
+			Expect(json.Unmarshal(w.Body.Bytes(), v)).To(BeNil())
+		}
+		return w.Code
+	}
+
+	It("should show the meta of objects", func() {
+		meta, _, _ := store.GetOrInsert("key", metastore.NewMeta("req", "key", 100, 2, 1, 50))
+		meta.SetPlace(0, 1)
+		meta.SetPlace(1, 2)
+		meta.SetPlace(2, 3)
+		meta.ConfirmCreated()
+
+		var object adminObject
+		Expect(request(http.MethodGet, "/objects/key", &object)).To(Equal(http.StatusOK))
+		Expect(object.Key).To(Equal("key"))
+		Expect(object.Version).To(Equal(1))
+		Expect(object.Placement).To(Equal([]uint64{1, 2, 3}))
+		Expect(object.Created).To(BeTrue())
+
+		Expect(request(http.MethodGet, "/objects/key?version=1", &object)).To(Equal(http.StatusOK))
+		Expect(request(http.MethodGet, "/objects/key?version=2", nil)).To(Equal(http.StatusNotFound))
+		Expect(request(http.MethodGet, "/objects/unknown", nil)).To(Equal(http.StatusNotFound))
+		Expect(request(http.MethodDelete, "/objects/key", nil)).To(Equal(http.StatusMethodNotAllowed))
+	})
+
+	It("should change the log level", func() {
+		log := global.Log
+		global.Log = &logger.ColorLogger{Level: logger.LOG_LEVEL_INFO}
+		defer func() { global.Log = log }()
+
+		var level map[string]string
+		Expect(request(http.MethodPut, "/log/level?level=warn", &level)).To(Equal(http.StatusOK))
+		Expect(level["level"]).To(Equal("warn"))
+		Expect(request(http.MethodGet, "/log/level", &level)).To(Equal(http.StatusOK))
+		Expect(level["level"]).To(Equal("warn"))
+		Expect(request(http.MethodPut, "/log/level?level=verbose", nil)).To(Equal(http.StatusBadRequest))
+	})
+
+	It("should authenticate requests if a token is set", func() {
+		admin = NewAdminServer(&Proxy{store: store}, "secret")
+		authorized := func(auth string) int {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, AdminPathPprof+"cmdline", nil)
+			if auth != "" {
+				r.Header.Set("Authorization", auth)
+			}
+			admin.ServeHTTP(w, r)
+			return w.Code
+		}
+		Expect(authorized("")).To(Equal(http.StatusUnauthorized))
+		Expect(authorized("Bearer wrong")).To(Equal(http.StatusUnauthorized))
+		Expect(authorized("secret")).To(Equal(http.StatusUnauthorized))
+		Expect(authorized("Bearer secret")).To(Equal(http.StatusOK))
+	})
+
+	It("should serve on loopback addresses only without a token", func() {
+		Expect(admin.Serve(":0")).To(Equal(ErrAdminUnauthenticated))
+		Expect(admin.Serve("0.0.0.0:0")).To(Equal(ErrAdminUnauthenticated))
+		Expect(admin.Serve("127.0.0.1:0")).To(BeNil())
+		admin.Close()
+
+		admin = NewAdminServer(&Proxy{store: store}, "secret")
+		Expect(admin.Serve(":0")).To(BeNil())
+		admin.Close()
+	})
+
+	It("should reject operations not supported by the cluster", func() {
+		var instances []adminInstance
+		Expect(request(http.MethodGet, "/instances", &instances)).To(Equal(http.StatusOK))
+		Expect(instances).To(BeEmpty())
+		Expect(request(http.MethodPost, "/instances/1/warmup", nil)).To(Equal(http.StatusNotFound))
+		Expect(request(http.MethodPost, "/cluster/rotate", nil)).To(Equal(http.StatusNotImplemented))
+	})
+})
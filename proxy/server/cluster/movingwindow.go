@@ -43,6 +43,7 @@ type MovingWindow struct {
 	startTime time.Time
 
 	scaler         chan *types.ScaleEvent
+	rotator        chan promise.Promise
 	backupQueue    *lambdastore.CandidateQueue
 	backupIterator mapreduce.Iterator
 	// scaleCounter int32
@@ -75,6 +76,7 @@ func NewMovingWindowWithOptions(server ServerProvider, numFuncSteps int) *Moving
 		// for scaling out
 		scaler: make(chan *types.ScaleEvent, numFuncSteps*100), // Reserve enough space for event queue to pervent blocking.
 		// scaleCounter: 0,
+		rotator: make(chan promise.Promise, 1),
 
 		done: make(chan struct{}),
 	}
@@ -221,7 +223,7 @@ func (mw *MovingWindow) Relocate(meta interface{}, chunkId int, cmd types.Comman
 	ins, _, err := mw.placer.Place(meta.(*metastore.Meta), chunkId, cmd)
 	// update placement
 	if ins != nil {
-		meta.(*metastore.Meta).Placement[chunkId] = ins.Id()
+		meta.(*metastore.Meta).SetPlace(chunkId, ins.Id())
 	}
 	return ins, err
 }
@@ -233,8 +235,9 @@ func (mw *MovingWindow) TryRelocate(meta interface{}, chunkId int, cmd types.Com
 		diffBuckets := mw.GetCurrentBucket().id - bucketId // Call "GetCurrentBucket" once only for better concurrency.
 		// Relocate if the chunk has not been touched within active window,
 		// or opportunisitcally has not been touched for a while.
-		if diffBuckets < config.NumActiveBuckets &&
-			(diffBuckets < config.NumActiveBuckets/config.ActiveReplica || mw.rand() != 1) {
+		numActiveBuckets := config.NumActiveBuckets()
+		if diffBuckets < numActiveBuckets &&
+			(diffBuckets < numActiveBuckets/config.ActiveReplica || mw.rand() != 1) {
 			return nil, false, nil
 		}
 	} // In case !ok, instance can be expired, force relocate.
@@ -250,7 +253,7 @@ func (mw *MovingWindow) TryRelocate(meta interface{}, chunkId int, cmd types.Com
 
 // lambdastore.CandidateProvider implementation
 func (mw *MovingWindow) LoadCandidates(queue *lambdastore.CandidateQueue, buf []*lambdastore.Instance) int {
-	bucketRange := config.NumActiveBuckets
+	bucketRange := config.NumActiveBuckets()
 	if bucketRange > len(mw.buckets) {
 		bucketRange = len(mw.buckets)
 	}
@@ -309,7 +312,7 @@ func (mw *MovingWindow) Trigger(event int, args ...interface{}) {
 }
 
 func (mw *MovingWindow) Daemon() {
-	timer := time.NewTimer(time.Duration(config.BucketDuration) * time.Minute)
+	timer := time.NewTimer(time.Duration(config.BucketDuration()) * time.Minute)
 	statTimer := time.NewTimer(1 * time.Minute) // I tried 1 second and it failed to respond to scaling. 1 minute is ok.
 	for {
 		select {
@@ -330,27 +333,24 @@ func (mw *MovingWindow) Daemon() {
 			mw.doScale(evt)
 		// for bucket rolling
 		case ts := <-timer.C:
-			// Rotate. No degradation or expiration if no new bucket is allocated.
-			old, inherited, err := mw.Rotate()
-			if err != nil {
-				mw.log.Error("Failed to initiate new bucket on rotating: %v", err)
+			if err := mw.rotate(ts); err != nil {
 				continue
-			} else {
-				mw.log.Info("Succeeded to rotate the cluster. The latest bucket is %d", mw.getCurrentBucketLocked().id)
 			}
 
-			// Degrade instances beyond active window.
-			degraded := mw.DegradeCheck()
-
-			// Expire old buckets first to free functions
-			expired := mw.ExpireCheck()
-
-			collector.Collect(collector.LogBucketRotate,
-				collector.LogTypeBucketRotate, ts.UnixNano(),
-				inherited, old.InstanceLen()-inherited, degraded, expired)
-
 			// reset ticker
-			timer.Reset(time.Duration(config.BucketDuration) * time.Minute)
+			timer.Reset(time.Duration(config.BucketDuration()) * time.Minute)
+		// for bucket rolling on request
+		case prm := <-mw.rotator:
+			prm.Resolve(nil, mw.rotate(time.Now()))
+
+			// reset ticker, the timer may have been stopped on failing to rotate.
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(time.Duration(config.BucketDuration()) * time.Minute)
 		case ts := <-statTimer.C:
 			total := pool.NumActives()
 			// Log: type, time, total, actives, degraded, expired
@@ -364,6 +364,40 @@ func (mw *MovingWindow) Daemon() {
 	}
 }
 
+// RequestRotation rotates the cluster as the bucket duration ends, and waits for the rotation to finish.
+// The next rotation is scheduled a bucket duration later.
+func (mw *MovingWindow) RequestRotation() error {
+	prm := promise.NewPromise()
+	select {
+	case mw.rotator <- prm:
+	case <-mw.done:
+		return ErrClusterClosed
+	}
+	return prm.Error()
+}
+
+// rotate starts a new bucket, degrades and expires old buckets. No degradation or expiration if no new bucket is allocated.
+func (mw *MovingWindow) rotate(ts time.Time) error {
+	old, inherited, err := mw.Rotate()
+	if err != nil {
+		mw.log.Error("Failed to initiate new bucket on rotating: %v", err)
+		return err
+	} else {
+		mw.log.Info("Succeeded to rotate the cluster. The latest bucket is %d", mw.getCurrentBucketLocked().id)
+	}
+
+	// Degrade instances beyond active window.
+	degraded := mw.DegradeCheck()
+
+	// Expire old buckets first to free functions
+	expired := mw.ExpireCheck()
+
+	collector.Collect(collector.LogBucketRotate,
+		collector.LogTypeBucketRotate, ts.UnixNano(),
+		inherited, old.InstanceLen()-inherited, degraded, expired)
+	return nil
+}
+
 func (mw *MovingWindow) GetCurrentBucket() *Bucket {
 	mw.mu.RLock()
 	defer mw.mu.RUnlock()
@@ -377,10 +411,11 @@ func (mw *MovingWindow) getCurrentBucketLocked() *Bucket {
 
 // Bucket degrading
 func (mw *MovingWindow) getDegradingInstance() *Bucket {
-	if len(mw.buckets) <= config.NumActiveBuckets {
+	numActiveBuckets := config.NumActiveBuckets()
+	if len(mw.buckets) <= numActiveBuckets {
 		return nil
 	} else {
-		return mw.buckets[len(mw.buckets)-config.NumActiveBuckets-1]
+		return mw.buckets[len(mw.buckets)-numActiveBuckets-1]
 	}
 }
 
@@ -479,7 +514,7 @@ func (mw *MovingWindow) rand() int {
 // only assign backup for new node in bucket
 func (mw *MovingWindow) assignBackupLocked(gall []*GroupInstance) {
 	// When current bucket leaves active window, backups of node in the bucket should not have been expired.
-	bucketRange := config.NumActiveBuckets
+	bucketRange := config.NumActiveBuckets()
 	if bucketRange > len(mw.buckets) {
 		bucketRange = len(mw.buckets)
 	}
@@ -0,0 +1,544 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	sion "github.com/sionreview/sion/client"
+	"github.com/sionreview/sion/common/logger"
+	protocol "github.com/sionreview/sion/common/types"
+	"github.com/sionreview/sion/common/util"
+	"github.com/sionreview/sion/proxy/global"
+)
+
+const (
+	// MemcachedMaxKeyLen is the max length of keys accepted by memcached.
+	MemcachedMaxKeyLen = 250
+
+	// memcachedMaxRelativeExptime Exptime up to 30 days is relative to now, or a unix timestamp otherwise.
+	memcachedMaxRelativeExptime = 60 * 60 * 24 * 30
+
+	// memcachedClientIdBase Shortcut ids of memcached connections start from here to avoid ids of redis clients.
+	memcachedClientIdBase = 1 << 40
+
+	// memcachedTouchAttempts Attempts of touching an object that is set concurrently.
+	memcachedTouchAttempts = 3
+)
+
+var (
+	// MemcachedMaxValueSize is the max size of values accepted by the memcached frontend, 1MB by default as memcached.
+	MemcachedMaxValueSize = 1 << 20
+
+	errMemcachedFormat    = errors.New("bad command line format")
+	errMemcachedDataChunk = errors.New("bad data chunk")
+)
+
+// MemcachedAdapter serves the memcached text protocol (get, gets, set, delete, touch) and the meta commands mg, ms, and mn.
+// Like the RedisAdapter, each connection is served by a client of its own. Flags of memcached are stored as flags of the
+// object, exptime as the time to live of the object, and the version of the object serves as the cas value.
+type MemcachedAdapter struct {
+	adapter  *RedisAdapter
+	listener net.Listener
+	conns    sync.Map
+	ids      uint64
+	log      logger.ILogger
+}
+
+type memcachedConn struct {
+	net.Conn
+	r      *bufio.Reader
+	w      *bufio.Writer
+	id     int
+	closed chan struct{}
+}
+
+func NewMemcachedAdapter(adapter *RedisAdapter) *MemcachedAdapter {
+	return &MemcachedAdapter{
+		adapter: adapter,
+		ids:     memcachedClientIdBase,
+		log: &logger.ColorLogger{
+			Prefix: "MemcachedAdapter ",
+			Level:  global.Log.GetLevel(),
+			Color:  !global.Options.NoColor,
+		},
+	}
+}
+
+// Serve starts serving memcached clients on the address in background. The proxy should be ready before serving.
+func (m *MemcachedAdapter) Serve(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	m.listener = lis
+	go func() {
+		for {
+			cn, err := lis.Accept()
+			if err != nil {
+				m.log.Debug("Stop accepting memcached clients: %v", err)
+				return
+			}
+			go m.serveConn(cn)
+		}
+	}()
+	return nil
+}
+
+func (m *MemcachedAdapter) serveConn(cn net.Conn) {
+	conn := &memcachedConn{
+		Conn:   cn,
+		r:      bufio.NewReader(cn),
+		w:      bufio.NewWriter(cn),
+		id:     int(atomic.AddUint64(&m.ids, 1)),
+		closed: make(chan struct{}),
+	}
+	m.conns.Store(conn.id, conn)
+	defer func() {
+		m.conns.Delete(conn.id)
+		conn.Close()
+		close(conn.closed)
+	}()
+
+	for {
+		line, err := conn.r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			conn.w.WriteString("CLIENT_ERROR line too long\r\n")
+			conn.w.Flush()
+			return
+		} else if err != nil {
+			return
+		}
+
+		quit := m.handle(conn, strings.Fields(string(line)))
+		if err := conn.w.Flush(); err != nil {
+			m.log.Warn("Error on flushing memcached response: %v", err)
+			return
+		} else if quit {
+			return
+		}
+	}
+}
+
+// handle serves the command and returns true if the connection should be closed.
+func (m *MemcachedAdapter) handle(conn *memcachedConn, fields []string) bool {
+	if len(fields) == 0 {
+		conn.w.WriteString("ERROR\r\n")
+		return false
+	}
+
+	var err error
+	switch fields[0] {
+	case "get":
+		err = m.handleGet(conn, fields[1:], false)
+	case "gets":
+		err = m.handleGet(conn, fields[1:], true)
+	case "set":
+		err = m.handleSet(conn, fields[1:])
+	case "delete":
+		err = m.handleDelete(conn, fields[1:])
+	case "touch":
+		err = m.handleTouch(conn, fields[1:])
+	case "mg":
+		err = m.handleMetaGet(conn, fields[1:])
+	case "ms":
+		err = m.handleMetaSet(conn, fields[1:])
+	case "mn":
+		conn.w.WriteString("MN\r\n")
+	case "version":
+		conn.w.WriteString("VERSION sion\r\n")
+	case "quit":
+		return true
+	default:
+		conn.w.WriteString("ERROR\r\n")
+	}
+
+	if err == errMemcachedFormat || err == errMemcachedDataChunk {
+		fmt.Fprintf(conn.w, "CLIENT_ERROR %v\r\n", err)
+	} else if err != nil {
+		fmt.Fprintf(conn.w, "SERVER_ERROR %v\r\n", err)
+	}
+	return false
+}
+
+// handleGet serves "get <key>*" and "gets <key>*". Objects are read concurrently and replied in order.
+func (m *MemcachedAdapter) handleGet(conn *memcachedConn, keys []string, withCas bool) error {
+	if len(keys) == 0 {
+		return errMemcachedFormat
+	}
+	client := m.getClient(conn)
+
+	metas := make([]*sion.ObjectMeta, len(keys))
+	readers := make([]sion.ReadAllCloser, len(keys))
+	errs := make([]error, len(keys))
+	var wg sync.WaitGroup
+	for i, key := range keys {
+		wg.Add(1)
+		go func(i int, key string) {
+			defer wg.Done()
+			metas[i], readers[i], errs[i] = m.get(client, key)
+		}(i, key)
+	}
+	wg.Wait()
+
+	// Reply error if any, nonexistent keys are skipped.
+	for _, err := range errs {
+		if err != nil && err != sion.ErrNotFound {
+			for _, reader := range readers {
+				if reader != nil {
+					reader.Close()
+				}
+			}
+			return err
+		}
+	}
+
+	for i, reader := range readers {
+		if reader == nil {
+			continue
+		}
+		fmt.Fprintf(conn.w, "VALUE %s %d %d", keys[i], metas[i].Flags, reader.Len())
+		if withCas {
+			fmt.Fprintf(conn.w, " %d", metas[i].Version)
+		}
+		conn.w.WriteString("\r\n")
+		m.copyValue(conn, keys[i], reader)
+	}
+	conn.w.WriteString("END\r\n")
+	return nil
+}
+
+// handleSet serves "set <key> <flags> <exptime> <bytes> [noreply]".
+func (m *MemcachedAdapter) handleSet(conn *memcachedConn, args []string) error {
+	if len(args) < 4 {
+		return errMemcachedFormat
+	}
+	// The value is read first, so it is skipped on invalid arguments.
+	val, err := m.readValue(conn, args[3])
+	if err != nil {
+		return err
+	} else if !validMemcachedKey(args[0]) {
+		return errMemcachedFormat
+	}
+	flags, err := strconv.ParseUint(args[1], 10, 32)
+	if err != nil {
+		return errMemcachedFormat
+	}
+	exptime, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return errMemcachedFormat
+	}
+
+	if err := m.set(conn, args[0], val, uint32(flags), exptime, nil); err != nil {
+		return err
+	}
+	if !isNoReply(args[4:]) {
+		conn.w.WriteString("STORED\r\n")
+	}
+	return nil
+}
+
+// handleDelete serves "delete <key> [noreply]".
+func (m *MemcachedAdapter) handleDelete(conn *memcachedConn, args []string) error {
+	if len(args) < 1 || !validMemcachedKey(args[0]) {
+		return errMemcachedFormat
+	}
+
+	err := m.del(m.getClient(conn), args[0])
+	if err != nil && err != sion.ErrNotFound {
+		return err
+	} else if isNoReply(args[1:]) {
+		return nil
+	} else if err == sion.ErrNotFound {
+		conn.w.WriteString("NOT_FOUND\r\n")
+	} else {
+		conn.w.WriteString("DELETED\r\n")
+	}
+	return nil
+}
+
+// handleTouch serves "touch <key> <exptime> [noreply]". The object is set again with the new time to live, so the
+// version of the object changes. The object is set only if the version read is still the latest, and touching is
+// retried if the object is set concurrently.
+func (m *MemcachedAdapter) handleTouch(conn *memcachedConn, args []string) error {
+	if len(args) < 2 || !validMemcachedKey(args[0]) {
+		return errMemcachedFormat
+	}
+	exptime, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return errMemcachedFormat
+	}
+
+	for attempt := 1; ; attempt++ {
+		meta, reader, err := m.get(m.getClient(conn), args[0])
+		if err == sion.ErrNotFound {
+			if !isNoReply(args[2:]) {
+				conn.w.WriteString("NOT_FOUND\r\n")
+			}
+			return nil
+		} else if err != nil {
+			return err
+		}
+		val, err := reader.ReadAll()
+		reader.Close()
+		if err != nil {
+			return err
+		}
+
+		err = m.set(conn, args[0], val, meta.Flags, exptime, &meta.Version)
+		if err == nil {
+			break
+		} else if err != sion.ErrVersionConflict || attempt >= memcachedTouchAttempts {
+			return err
+		}
+		m.log.Debug("Retry touching %s: %v", args[0], err)
+	}
+	if !isNoReply(args[2:]) {
+		conn.w.WriteString("TOUCHED\r\n")
+	}
+	return nil
+}
+
+// handleMetaGet serves "mg <key> <flag>*". Supported flags are v, f, s, c, k, O, and q.
+func (m *MemcachedAdapter) handleMetaGet(conn *memcachedConn, args []string) error {
+	if len(args) < 1 || !validMemcachedKey(args[0]) {
+		return errMemcachedFormat
+	}
+	key, flags := args[0], args[1:]
+	withValue, quiet := false, false
+	for _, flag := range flags {
+		switch flag[0] {
+		case 'v':
+			withValue = true
+		case 'q':
+			quiet = true
+		case 'f', 's', 'c', 'k', 'O':
+		default:
+			return errMemcachedFormat
+		}
+	}
+
+	// The value is read only if requested, otherwise only the meta is fetched.
+	var meta *sion.ObjectMeta
+	var reader sion.ReadAllCloser
+	var err error
+	if withValue {
+		meta, reader, err = m.get(m.getClient(conn), key)
+	} else {
+		_, meta, err = m.getClient(conn).EcStat(key)
+	}
+	if err == sion.ErrNotFound {
+		if !quiet {
+			conn.w.WriteString("EN\r\n")
+		}
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var ret strings.Builder
+	for _, flag := range flags {
+		switch flag[0] {
+		case 'f':
+			fmt.Fprintf(&ret, " f%d", meta.Flags)
+		case 's':
+			fmt.Fprintf(&ret, " s%d", meta.Size)
+		case 'c':
+			fmt.Fprintf(&ret, " c%d", meta.Version)
+		case 'k':
+			fmt.Fprintf(&ret, " k%s", key)
+		case 'O':
+			fmt.Fprintf(&ret, " %s", flag)
+		}
+	}
+	if !withValue {
+		fmt.Fprintf(conn.w, "HD%s\r\n", ret.String())
+		return nil
+	}
+	fmt.Fprintf(conn.w, "VA %d%s\r\n", reader.Len(), ret.String())
+	m.copyValue(conn, key, reader)
+	return nil
+}
+
+// handleMetaSet serves "ms <key> <datalen> <flag>*". Supported flags are F, T, MS, k, O, and q.
+func (m *MemcachedAdapter) handleMetaSet(conn *memcachedConn, args []string) error {
+	if len(args) < 2 {
+		return errMemcachedFormat
+	}
+	// The value is read first, so it is skipped on invalid arguments.
+	val, err := m.readValue(conn, args[1])
+	if err != nil {
+		return err
+	} else if !validMemcachedKey(args[0]) {
+		return errMemcachedFormat
+	}
+	key, flags := args[0], args[2:]
+	clientFlags, exptime, quiet := uint64(0), int64(0), false
+	for _, flag := range flags {
+		switch flag[0] {
+		case 'F':
+			clientFlags, err = strconv.ParseUint(flag[1:], 10, 32)
+		case 'T':
+			exptime, err = strconv.ParseInt(flag[1:], 10, 64)
+		case 'M':
+			// Only the set mode is supported.
+			if flag[1:] != "S" && flag[1:] != "s" {
+				err = errMemcachedFormat
+			}
+		case 'q':
+			quiet = true
+		case 'k', 'O':
+		default:
+			err = errMemcachedFormat
+		}
+		if err != nil {
+			return errMemcachedFormat
+		}
+	}
+
+	if err := m.set(conn, key, val, uint32(clientFlags), exptime, nil); err != nil {
+		return err
+	} else if quiet {
+		return nil
+	}
+	conn.w.WriteString("HD")
+	for _, flag := range flags {
+		switch flag[0] {
+		case 'k':
+			fmt.Fprintf(conn.w, " k%s", key)
+		case 'O':
+			fmt.Fprintf(conn.w, " %s", flag)
+		}
+	}
+	conn.w.WriteString("\r\n")
+	return nil
+}
+
+func (m *MemcachedAdapter) get(client *sion.Client, key string) (*sion.ObjectMeta, sion.ReadAllCloser, error) {
+	t := time.Now()
+	_, meta, reader, err := client.EcGetMeta(key)
+	dt := time.Since(t)
+	code, size := "200", 0
+	if err == sion.ErrNotFound {
+		code = "404"
+	} else if err != nil {
+		code = "500"
+	} else {
+		size = reader.Len()
+	}
+	collectEndToEnd(protocol.CMD_GET, code, int64(size), t, dt)
+	return meta, reader, err
+}
+
+// set sets the object with flags and exptime of memcached. Objects already expired are deleted.
+// set Sets the object, or deletes it if exptime has passed. If ifVersion is specified, the object is set only if the
+// latest version matches.
+func (m *MemcachedAdapter) set(conn *memcachedConn, key string, val []byte, flags uint32, exptime int64, ifVersion *int) error {
+	client := m.getClient(conn)
+	ttl, expired := memcachedTTL(exptime, time.Now())
+	if expired {
+		if err := m.del(client, key); err != nil && err != sion.ErrNotFound {
+			return err
+		}
+		return nil
+	}
+
+	t := time.Now()
+	_, _, err := client.EcSetContext(context.Background(), key, val, &sion.SetOptions{TTL: ttl, Flags: flags, IfVersion: ifVersion})
+	dt := time.Since(t)
+	collectEndToEnd(protocol.CMD_SET, util.Ifelse(err == nil, "200", "500").(string), int64(len(val)), t, dt)
+	return err
+}
+
+func (m *MemcachedAdapter) del(client *sion.Client, key string) error {
+	t := time.Now()
+	_, err := client.EcDel(key)
+	dt := time.Since(t)
+	code := "200"
+	if err == sion.ErrNotFound {
+		code = "404"
+	} else if err != nil {
+		code = "500"
+	}
+	collectEndToEnd(protocol.CMD_DEL, code, int64(0), t, dt)
+	return err
+}
+
+// readValue reads the value of specified size followed by "\r\n".
+func (m *MemcachedAdapter) readValue(conn *memcachedConn, rawSize string) ([]byte, error) {
+	size, err := strconv.Atoi(rawSize)
+	if err != nil || size < 0 {
+		return nil, errMemcachedFormat
+	} else if size > MemcachedMaxValueSize {
+		// Skip the value.
+		if _, err := io.CopyN(io.Discard, conn.r, int64(size)+2); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("object too large for cache")
+	}
+
+	val := make([]byte, size+2)
+	if _, err := io.ReadFull(conn.r, val); err != nil {
+		return nil, err
+	} else if !bytes.HasSuffix(val, []byte("\r\n")) {
+		return nil, errMemcachedDataChunk
+	}
+	return val[:size], nil
+}
+
+func (m *MemcachedAdapter) copyValue(conn *memcachedConn, key string, reader sion.ReadAllCloser) {
+	defer reader.Close()
+
+	if _, err := io.Copy(conn.w, reader); err != nil {
+		m.log.Warn("Error on sending %s: %v", key, err)
+	}
+	conn.w.WriteString("\r\n")
+}
+
+func (m *MemcachedAdapter) getClient(conn *memcachedConn) *sion.Client {
+	return m.adapter.getClientOf(conn.id, func() { <-conn.closed })
+}
+
+// Close stops serving and closes all connections.
+func (m *MemcachedAdapter) Close() {
+	if m.listener != nil {
+		m.listener.Close()
+	}
+	m.conns.Range(func(_, conn interface{}) bool {
+		conn.(*memcachedConn).Close()
+		return true
+	})
+}
+
+// memcachedTTL converts the exptime of memcached to the time to live. Returns true if the object expires already.
+func memcachedTTL(exptime int64, now time.Time) (time.Duration, bool) {
+	switch {
+	case exptime == 0:
+		return 0, false
+	case exptime < 0:
+		return 0, true
+	case exptime <= memcachedMaxRelativeExptime:
+		return time.Duration(exptime) * time.Second, false
+	}
+
+	ttl := time.Unix(exptime, 0).Sub(now)
+	return ttl, ttl <= 0
+}
+
+func validMemcachedKey(key string) bool {
+	return len(key) > 0 && len(key) <= MemcachedMaxKeyLen
+}
+
+func isNoReply(args []string) bool {
+	return len(args) > 0 && args[len(args)-1] == "noreply"
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func handleMemcached(line string, body string) (string, string) {
+	var out bytes.Buffer
+	conn := &memcachedConn{
+		r: bufio.NewReader(strings.NewReader(body)),
+		w: bufio.NewWriter(&out),
+	}
+	(&MemcachedAdapter{}).handle(conn, strings.Fields(line))
+	conn.w.Flush()
+	left, _ := conn.r.ReadString(0)
+	return out.String(), left
+}
+
+var _ = Describe("MemcachedAdapter", func() {
+	It("should convert exptime to ttl", func() {
+		now := time.Unix(1700000000, 0)
+
+		ttl, expired := memcachedTTL(0, now)
+		Expect(ttl).To(Equal(time.Duration(0)))
+		Expect(expired).To(BeFalse())
+
+		ttl, expired = memcachedTTL(60, now)
+		Expect(ttl).To(Equal(time.Minute))
+		Expect(expired).To(BeFalse())
+
+		ttl, expired = memcachedTTL(1700000060, now)
+		Expect(ttl).To(Equal(time.Minute))
+		Expect(expired).To(BeFalse())
+
+		_, expired = memcachedTTL(-1, now)
+		Expect(expired).To(BeTrue())
+		_, expired = memcachedTTL(1600000000, now)
+		Expect(expired).To(BeTrue())
+	})
+
+	It("should reply commands without objects", func() {
+		out, _ := handleMemcached("mn", "")
+		Expect(out).To(Equal("MN\r\n"))
+		out, _ = handleMemcached("foo", "")
+		Expect(out).To(Equal("ERROR\r\n"))
+		out, _ = handleMemcached("get", "")
+		Expect(out).To(Equal("CLIENT_ERROR bad command line format\r\n"))
+	})
+
+	It("should skip values on invalid arguments", func() {
+		out, left := handleMemcached("set foo x 0 3", "bar\r\nmn\r\n")
+		Expect(out).To(Equal("CLIENT_ERROR bad command line format\r\n"))
+		Expect(left).To(Equal("mn\r\n"))
+
+		out, left = handleMemcached("ms foo 3 MA", "bar\r\nmn\r\n")
+		Expect(out).To(Equal("CLIENT_ERROR bad command line format\r\n"))
+		Expect(left).To(Equal("mn\r\n"))
+
+		out, _ = handleMemcached("set foo 0 0 3", "barbaz")
+		Expect(out).To(Equal("CLIENT_ERROR bad data chunk\r\n"))
+	})
+
+	It("should skip values larger than 1MB by default", func() {
+		val := strings.Repeat("a", 1<<20+1)
+		out, left := handleMemcached("set foo 0 0 "+strconv.Itoa(len(val)), val+"\r\nmn\r\n")
+		Expect(out).To(Equal("SERVER_ERROR object too large for cache\r\n"))
+		Expect(left).To(Equal("mn\r\n"))
+	})
+})
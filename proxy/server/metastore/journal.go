@@ -0,0 +1,437 @@
+package metastore
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"sync"
+
+	kbinary "github.com/kelindar/binary"
+	"github.com/sionreview/sion/common/logger"
+	"github.com/sionreview/sion/proxy/global"
+)
+
+const (
+	JournalSnapshotFile = "metastore.snapshot"
+	JournalLogFile      = "metastore.wal"
+
+	journalTempSuffix = ".tmp"
+)
+
+var (
+	ErrJournalClosed = errors.New("journal closed")
+)
+
+// MetaRange iterates metas in the order expected on restoring. Iteration stops if the callback returns false.
+type MetaRange func(func(*Meta) bool)
+
+// metaRecord is the persisted form of a created Meta.
+type metaRecord struct {
+	Key         string
+	RawKey      string
+	Size        int64
+	DChunks     int
+	PChunks     int
+	Placement   []uint64
+	ChunkSize   int64
+	Version     int
+	VersionTs   int64
+	LastVersion int
+	Initiator   string
+	ExpireAt    int64
+	Flags       int32
+	Checksums   []uint64
+	Class       string
+	Replicated  bool
+	NumFrags    int
+	Codec       string
+	ClientFlags uint32
+}
+
+func (r *metaRecord) versioningKey() string {
+	return metaKeyByVersion(r.Key, r.Version)
+}
+
+// Journal persists the changes of created metas to local disk as a write-ahead log. A snapshot is taken
+// periodically to truncate the log. On restarting, metas are restored by loading the snapshot and replaying the log.
+// The log is flushed to the OS on every change, so changes will survive a proxy crash.
+type Journal struct {
+	dir        string
+	file       *os.File
+	writer     *bufio.Writer
+	replicas   []*journalReplica // Standby proxies changes are streamed to, see Replicate.
+	pending    [][]byte          // Changes logged during snapshotting, nil if not snapshotting.
+	log        logger.ILogger
+	mu         sync.Mutex
+	snapshotMu sync.Mutex // Serializes snapshots.
+}
+
+// OpenJournal opens the journal under specified directory. The directory will be created if not exists.
+func OpenJournal(dir string) (*Journal, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	j := &Journal{
+		dir: dir,
+		log: global.GetLogger("Journal: "),
+	}
+	return j, nil
+}
+
+// Replay loads the snapshot and replays the log. Restored records are passed to the callback in the
+// order of the snapshot, followed by new records in the log. Only the latest state of a record is passed.
+func (j *Journal) Replay(restore func(*metaRecord)) (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	records := newRecordSet()
+	if _, err := j.readFile(path.Join(j.dir, JournalSnapshotFile), records.add); err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	replayed, err := j.readFile(path.Join(j.dir, JournalLogFile), records.add)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	j.log.Info("Loaded %d metas, %d changes replayed.", records.Len(), replayed)
+
+	records.each(func(record *metaRecord) bool {
+		restore(record)
+		return true
+	})
+
+	// Open log for appending.
+	return records.Len(), j.openLogLocked(os.O_APPEND)
+}
+
+// Append logs the latest state of a meta. The change is also queued to be streamed to standby proxies.
+func (j *Journal) Append(meta *Meta) error {
+	record := newMetaRecord(meta)
+	payload, err := kbinary.Marshal(record)
+	if err != nil {
+		j.log.Warn("Failed to log %s: %v", record.versioningKey(), err)
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.writer == nil {
+		return ErrJournalClosed
+	}
+	j.replicateLocked(payload)
+	if j.pending != nil {
+		j.pending = append(j.pending, payload)
+	}
+	if err := writeFrame(j.writer, payload); err != nil {
+		j.log.Warn("Failed to log %s: %v", record.versioningKey(), err)
+		return err
+	}
+	return j.writer.Flush()
+}
+
+// Snapshot writes all metas provided by the range to the snapshot file and truncates the log.
+// The range is iterated without locking the journal, so owners of metas, e.g. placers, can log changes while holding
+// their locks. Changes logged during snapshotting are kept in the log, for the snapshot may or may not include them.
+func (j *Journal) Snapshot(metas MetaRange) (int, error) {
+	j.snapshotMu.Lock()
+	defer j.snapshotMu.Unlock()
+
+	j.mu.Lock()
+	if j.writer == nil {
+		j.mu.Unlock()
+		return 0, ErrJournalClosed
+	}
+	j.pending = make([][]byte, 0, 64)
+	j.mu.Unlock()
+
+	// The log is kept until the snapshot has been written, so the log is still valid on the snapshot if the proxy crashes.
+	written, err := j.writeSnapshot(func(w io.Writer) (int, error) {
+		return writeMetas(w, metas)
+	})
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	pending := j.pending
+	j.pending = nil
+	if err != nil {
+		return 0, err
+	} else if j.writer == nil {
+		return written, ErrJournalClosed
+	}
+
+	// Changes before snapshotting have been included in the snapshot, truncate the log.
+	return written, j.rewriteLogLocked(pending)
+}
+
+// Close flushes and closes the log. Standby proxies are disconnected after changes queued are streamed.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for _, replica := range j.replicas {
+		close(replica.queue)
+	}
+	j.replicas = nil
+	return j.closeLogLocked()
+}
+
+// reset replaces the snapshot with specified records and removes the log.
+func (j *Journal) reset(records *recordSet) (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	written, err := j.writeSnapshot(func(w io.Writer) (int, error) {
+		var err error
+		records.each(func(record *metaRecord) bool {
+			err = writeRecord(w, record)
+			return err == nil
+		})
+		return records.Len(), err
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := os.Remove(path.Join(j.dir, JournalLogFile)); err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	return written, nil
+}
+
+func (j *Journal) openLogLocked(flag int) error {
+	file, err := os.OpenFile(path.Join(j.dir, JournalLogFile), os.O_CREATE|os.O_WRONLY|flag, 0644)
+	if err != nil {
+		return err
+	}
+	j.file = file
+	j.writer = bufio.NewWriter(file)
+	return nil
+}
+
+func (j *Journal) closeLogLocked() error {
+	if j.file == nil {
+		return nil
+	}
+
+	j.writer.Flush()
+	err := j.file.Close()
+	j.file = nil
+	j.writer = nil
+	return err
+}
+
+// rewriteLogLocked replaces the log with specified changes. The new log is written to a temporary file first, so the old
+// log remains on failure.
+func (j *Journal) rewriteLogLocked(payloads [][]byte) error {
+	log := path.Join(j.dir, JournalLogFile)
+	file, err := os.OpenFile(log+journalTempSuffix, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	for _, payload := range payloads {
+		if err = writeFrame(writer, payload); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	file.Close()
+	if err != nil {
+		os.Remove(log + journalTempSuffix)
+		return err
+	}
+
+	j.closeLogLocked()
+	if err := os.Rename(log+journalTempSuffix, log); err != nil {
+		os.Remove(log + journalTempSuffix)
+		j.openLogLocked(os.O_APPEND)
+		return err
+	}
+	return j.openLogLocked(os.O_APPEND)
+}
+
+// writeSnapshot writes the snapshot to a temporary file first, which replaces the snapshot on success.
+func (j *Journal) writeSnapshot(write func(io.Writer) (int, error)) (int, error) {
+	snapshot := path.Join(j.dir, JournalSnapshotFile)
+	file, err := os.OpenFile(snapshot+journalTempSuffix, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+
+	writer := bufio.NewWriter(file)
+	written, err := write(writer)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	file.Close()
+	if err == nil {
+		err = os.Rename(snapshot+journalTempSuffix, snapshot)
+	}
+	if err != nil {
+		os.Remove(snapshot + journalTempSuffix)
+		return 0, err
+	}
+	return written, nil
+}
+
+// writeMetas writes created metas provided by the range, duplicated metas are written once.
+func writeMetas(w io.Writer, metas MetaRange) (int, error) {
+	var err error
+	written := make(map[*Meta]struct{})
+	metas(func(meta *Meta) bool {
+		if _, ok := written[meta]; ok || !meta.IsCreated() {
+			return true
+		}
+		err = writeRecord(w, newMetaRecord(meta))
+		written[meta] = struct{}{}
+		return err == nil
+	})
+	return len(written), err
+}
+
+func writeRecord(w io.Writer, record *metaRecord) error {
+	payload, err := kbinary.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return writeFrame(w, payload)
+}
+
+// writeFrame writes the payload prefixed by its length.
+func writeFrame(w io.Writer, payload []byte) error {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], uint64(len(payload)))
+	if _, err := w.Write(buf[:n]); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+func (j *Journal) readFile(name string, apply func(*metaRecord)) (int, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	read := 0
+	for {
+		size, err := binary.ReadUvarint(reader)
+		if err == io.EOF {
+			return read, nil
+		} else if err != nil {
+			j.log.Warn("Stop reading %s on truncated record: %v", name, err)
+			return read, nil
+		}
+
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			// The last change was not fully written on crash.
+			j.log.Warn("Stop reading %s on truncated record: %v", name, err)
+			return read, nil
+		}
+
+		var record metaRecord
+		if err := kbinary.Unmarshal(payload, &record); err != nil {
+			return read, err
+		}
+		apply(&record)
+		read++
+	}
+}
+
+// recordSet keeps the latest state of records in the order first seen.
+type recordSet struct {
+	records map[string]*metaRecord
+	order   []string
+}
+
+func newRecordSet() *recordSet {
+	return &recordSet{
+		records: make(map[string]*metaRecord),
+		order:   make([]string, 0, 1024),
+	}
+}
+
+func (s *recordSet) add(record *metaRecord) {
+	key := record.versioningKey()
+	if _, ok := s.records[key]; !ok {
+		s.order = append(s.order, key)
+	}
+	s.records[key] = record
+}
+
+func (s *recordSet) Len() int {
+	return len(s.order)
+}
+
+func (s *recordSet) each(cb func(*metaRecord) bool) {
+	for _, key := range s.order {
+		if !cb(s.records[key]) {
+			return
+		}
+	}
+}
+
+func newMetaRecord(meta *Meta) *metaRecord {
+	return &metaRecord{
+		Key:         meta.key,
+		RawKey:      meta.rawKey,
+		Size:        meta.Size,
+		DChunks:     meta.DChunks,
+		PChunks:     meta.PChunks,
+		Placement:   copyPlacement(nil, meta.Placement),
+		ChunkSize:   meta.ChunkSize,
+		Version:     meta.version,
+		VersionTs:   meta.versionTs,
+		LastVersion: meta.lastVersion,
+		Initiator:   meta.initiator,
+		ExpireAt:    meta.expireAt,
+		Flags:       meta.flags,
+		Checksums:   copyPlacement(nil, meta.Checksums),
+		Class:       meta.Class,
+		Replicated:  meta.Replicated,
+		NumFrags:    meta.NumFrags,
+		Codec:       meta.Codec,
+		ClientFlags: meta.ClientFlags,
+	}
+}
+
+func newMetaFromRecord(record *metaRecord) *Meta {
+	meta := newEmptyMeta()
+	meta.key = record.Key
+	meta.rawKey = record.RawKey
+	meta.Size = record.Size
+	meta.DChunks = record.DChunks
+	meta.PChunks = record.PChunks
+	meta.Placement = copyPlacement(meta.Placement, record.Placement)
+	meta.ChunkSize = record.ChunkSize
+	meta.version = record.Version
+	meta.versionTs = record.VersionTs
+	meta.lastVersion = record.LastVersion
+	meta.initiator = record.Initiator
+	meta.expireAt = record.ExpireAt
+	meta.flags = record.Flags
+	meta.Checksums = copyPlacement(meta.Checksums, record.Checksums)
+	meta.Class = record.Class
+	meta.Replicated = record.Replicated
+	meta.NumFrags = record.NumFrags
+	meta.Codec = record.Codec
+	meta.ClientFlags = record.ClientFlags
+	return meta
+}
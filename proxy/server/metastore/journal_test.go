@@ -0,0 +1,128 @@
+package metastore
+
+import (
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Journal", func() {
+	It("should restore metas from snapshot and log", func() {
+		dir, err := os.MkdirTemp("", "metastore")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(dir)
+
+		journal, err := OpenJournal(dir)
+		Expect(err).To(BeNil())
+		store := New()
+		_, err = store.Recover(journal, nil)
+		Expect(err).To(BeNil())
+
+		prepared := NewMeta("req1", "snapshotted", 10, 1, 0, 10)
+		prepared.Class = "hot"
+		prepared.Replicated = true
+		prepared.Codec = "flate:20,aes-gcm:12"
+		prepared.ClientFlags = 7
+		snapshotted, _, _ := store.GetOrInsert("snapshotted", prepared)
+		snapshotted.ConfirmCreated()
+		written, err := store.Snapshot(store.Range)
+		Expect(err).To(BeNil())
+		Expect(written).To(Equal(1))
+
+		fragmented := NewMeta("req2", "logged", 10, 1, 0, 10)
+		fragmented.NumFrags = 2
+		logged, _, _ := store.GetOrInsert("logged", fragmented)
+		logged.ConfirmCreated()
+		logged.SetPlace(0, 5)
+		removed, _, _ := store.GetOrInsert("removed", NewMeta("req3", "removed", 10, 1, 0, 10))
+		removed.ConfirmCreated()
+		store.Delete("removed")
+		// Uncreated meta will not be restored.
+		store.GetOrInsert("creating", NewMeta("req4", "creating", 10, 1, 0, 10))
+		Expect(journal.Close()).To(BeNil())
+
+		journal, err = OpenJournal(dir)
+		Expect(err).To(BeNil())
+		defer journal.Close()
+		recovered := New()
+		restored, err := recovered.Recover(journal, nil)
+		Expect(err).To(BeNil())
+		Expect(restored).To(Equal(3))
+
+		meta, ok := recovered.Get("snapshotted")
+		Expect(ok).To(Equal(true))
+		Expect(meta.Version()).To(Equal(snapshotted.Version()))
+		Expect(meta.Class).To(Equal("hot"))
+		Expect(meta.Replicated).To(BeTrue())
+		Expect(meta.Layout()).To(Equal("r1"))
+		Expect(meta.OriginalSize()).To(Equal(int64(20)))
+		Expect(meta.ClientFlags).To(Equal(uint32(7)))
+
+		meta, ok = recovered.Get("logged")
+		Expect(ok).To(Equal(true))
+		Expect(meta.GetPlace(0)).To(Equal(uint64(5)))
+		Expect(meta.RawSize()).To(Equal("10-2"))
+
+		_, ok = recovered.Get("removed")
+		Expect(ok).To(Equal(false))
+		_, ok = recovered.Get("creating")
+		Expect(ok).To(Equal(false))
+
+		// New version will be created after the recovered one.
+		prepared = NewMeta("req5", "removed", 10, 1, 0, 10)
+		revised, _, err := recovered.GetOrInsert("removed", prepared)
+		Expect(err).To(BeNil())
+		Expect(revised.Version()).To(Equal(removed.Version() + 1))
+	})
+
+	It("should not block changes logged by the placer during snapshotting", func() {
+		dir, err := os.MkdirTemp("", "metastore")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(dir)
+
+		journal, err := OpenJournal(dir)
+		Expect(err).To(BeNil())
+		store := New()
+		placer := NewLRUPlacer(store, nil)
+		_, err = placer.Recover(journal)
+		Expect(err).To(BeNil())
+		evicted, _, _ := store.GetOrInsert("evicted", NewMeta("req1", "evicted", 10, 1, 0, 10))
+		evicted.ConfirmCreated()
+
+		// Simulate an eviction in progress, which logs the evicted object while holding the placer.
+		placer.mu.Lock()
+		snapshotted := make(chan int, 1)
+		go func() {
+			written, _ := placer.Snapshot()
+			snapshotted <- written
+		}()
+		Eventually(func() bool {
+			journal.mu.Lock()
+			defer journal.mu.Unlock()
+			return journal.pending != nil
+		}).Should(BeTrue())
+
+		logged := make(chan struct{})
+		go func() {
+			evicted.Delete()
+			close(logged)
+		}()
+		Eventually(logged, time.Second).Should(BeClosed())
+		placer.mu.Unlock()
+		Eventually(snapshotted, time.Second).Should(Receive(Equal(1)))
+		Expect(journal.Close()).To(BeNil())
+
+		// The change logged during snapshotting survives truncating the log.
+		journal, err = OpenJournal(dir)
+		Expect(err).To(BeNil())
+		defer journal.Close()
+		recovered := New()
+		_, err = recovered.Recover(journal, nil)
+		Expect(err).To(BeNil())
+		meta, ok := recovered.metaMap.Load(evicted.VersioningKey())
+		Expect(ok).To(BeTrue())
+		Expect(meta.(*Meta).IsDeleted()).To(BeTrue())
+	})
+})
@@ -2,6 +2,7 @@ package metastore
 
 import (
 	"errors"
+	"net"
 	"sync"
 	"time"
 
@@ -17,6 +18,7 @@ const (
 
 var (
 	ErrPlacementConflict = errors.New("conflict on placing")
+	ErrNoReplaceable     = errors.New("no object of the storage class can be replaced")
 )
 
 type LRUPlacerMeta struct {
@@ -110,13 +112,14 @@ func (p *LRUPlacer) InsertAndPlace(key string, newMeta *Meta, cmd types.Command)
 	meta, got, err := p.store.GetOrInsert(key, newMeta)
 	if err != nil {
 		newMeta.close()
-		return nil, nil, err
+		return meta, nil, err
 	}
 	if got {
 		// Only copy placement assignment if the chunk has not been confirm.
 		if meta.placerMeta == nil || !meta.placerMeta.(*LRUPlacerMeta).confirmed[chunkId] {
 			meta.Placement[chunkId] = newMeta.Placement[chunkId]
 		}
+		meta.SetChecksum(chunkId, newMeta.Checksum(chunkId))
 		newMeta.close()
 	}
 	cmd.GetRequest().Key = meta.ChunkKey(chunkId)
@@ -166,6 +169,10 @@ func (p *LRUPlacer) MetaStats() types.MetaStoreStats {
 	return p.store
 }
 
+func (p *LRUPlacer) Store() *MetaStore {
+	return p.store
+}
+
 // NewMeta will remap idx according to following logic:
 // 0. If an LRU relocation is present, remap according to "chunk" in relocation array.
 // 1. Base on the size of slice, remap to a instance in the group.
@@ -264,6 +271,10 @@ func (p *LRUPlacer) FindPlacement(meta *Meta, chunkId int) (*lambdastore.Instanc
 		if numScaned > 0 && candidate != nil {
 			p.evictMeta(meta, candidate, false)
 			break
+		} else if numScaned > 2 {
+			// All objects have been unvisited and none of the storage class can be replaced.
+			p.mu.Unlock()
+			return nil, nil, ErrNoReplaceable
 		}
 		numScaned++
 	}
@@ -340,6 +351,123 @@ func (p *LRUPlacer) GetByVersion(key string, ver int, chunk int) (*Meta, bool) {
 	return meta, ok
 }
 
+func (p *LRUPlacer) Delete(key string) (*Meta, bool) {
+	meta, ok := p.store.Delete(key)
+	if !ok {
+		return nil, ok
+	}
+
+	p.removeObject(meta)
+	return meta, ok
+}
+
+func (p *LRUPlacer) Scan(cursor uint64, count int, match func(string) bool) ([]*Meta, uint64) {
+	return p.store.Scan(cursor, count, match)
+}
+
+func (p *LRUPlacer) Expire(now time.Time, expired MetaDoPostProcess) int {
+	return p.store.Expire(now, func(meta *Meta) {
+		p.removeObject(meta)
+		expired(meta)
+	})
+}
+
+// removeObject takes the removed object out of the LRU and reclaims the space of its chunks, so the object will not be
+// evicted again. Objects evicted already have been replaced in the LRU and are skipped.
+func (p *LRUPlacer) removeObject(meta *Meta) {
+	if meta.placerMeta == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	placerMeta := meta.placerMeta.(*LRUPlacerMeta)
+	removed := false
+	for _, i := range [2]int{p.primary, p.secondary} {
+		if pos := placerMeta.pos[i]; pos > 0 && pos < len(p.objects[i]) && p.objects[i][pos] == meta {
+			p.objects[i][pos] = nil
+			removed = true
+		}
+	}
+	if !removed {
+		return
+	}
+
+	for i, insId := range meta.Placement {
+		if insId == InvalidPlacement || !placerMeta.confirmed[i] {
+			continue
+		}
+		if ins := p.cluster.Instance(insId); ins != nil {
+			size := ins.Meta.DecreaseSize(meta.ChunkSize)
+			p.log.Debug("Lambda %d size updated: %d of %d (remove:%d@%s, Δ:%d).",
+				insId, size, ins.Meta.Capacity, i, meta.Key(), -meta.ChunkSize)
+		}
+	}
+}
+
+func (p *LRUPlacer) Recover(journal *Journal) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Metas are restored in the LRU order on snapshotting.
+	return p.store.Recover(journal, p.restoreObject)
+}
+
+func (p *LRUPlacer) Reconcile(metas []*Meta) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.store.Reconcile(metas, p.restoreObject)
+}
+
+// restoreObject adds the restored object to the LRU and reserves the space of chunks on instances.
+func (p *LRUPlacer) restoreObject(meta *Meta) {
+	// Evicted and removed objects are not managed by the LRU, chunks of removed objects have been deleted.
+	if meta.IsDeleted() {
+		return
+	}
+
+	placerMeta := newLRUPlacerMeta(len(meta.Placement))
+	for i := range placerMeta.confirmed {
+		placerMeta.confirm(i)
+	}
+	meta.placerMeta = placerMeta
+	p.AddObject(meta)
+
+	for _, insId := range meta.Placement {
+		if insId == InvalidPlacement {
+			continue
+		}
+		if ins := p.cluster.Instance(insId); ins != nil {
+			ins.Meta.IncreaseSize(meta.ChunkSize)
+		}
+	}
+}
+
+func (p *LRUPlacer) Snapshot() (int, error) {
+	return p.store.Snapshot(p.rangeInOrder)
+}
+
+func (p *LRUPlacer) Replicate(conn net.Conn) (int, error) {
+	return p.store.Replicate(conn, p.rangeInOrder)
+}
+
+// rangeInOrder iterates metas in the LRU order first, so the LRU can be restored. Metas will be iterated more than once.
+func (p *LRUPlacer) rangeInOrder(cb func(*Meta) bool) {
+	p.mu.RLock()
+	objects := make([]*Meta, len(p.objects[p.primary]))
+	copy(objects, p.objects[p.primary])
+	p.mu.RUnlock()
+
+	for _, meta := range objects[1:] {
+		if meta != nil && !cb(meta) {
+			return
+		}
+	}
+	p.store.Range(cb)
+}
+
 // Object management implementation: Clock LRU
 func (p *LRUPlacer) AddObject(meta *Meta) {
 	placerMeta := meta.placerMeta.(*LRUPlacerMeta)
@@ -381,6 +509,8 @@ func (p *LRUPlacer) NextAvailableObject(meta *Meta, candidate *Meta) (*Meta, boo
 		} else if mPlacerMeta.visited && mPlacerMeta.allConfirmed() {
 			// Only switch to unvisited for complete object.
 			mPlacerMeta.visited = false
+		} else if m.NumChunks() != meta.NumChunks() {
+			// Objects of other storage classes are placed differently, and can not be replaced.
 		} else if !mPlacerMeta.visited && meta.ChunkSize <= m.ChunkSize {
 			p.evictMeta(meta, m, false)
 			m = meta
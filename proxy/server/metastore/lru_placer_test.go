@@ -168,6 +168,18 @@ var _ = Describe("Placer", func() {
 		Expect(container[idx].placerMeta.(*LRUPlacerMeta).swapMap).To(Equal(container[4].Placement))
 	})
 
+	It("should not replace the unvisited object of other storage classes", func() {
+		placer := initPlacer(1)
+		idx := len(container)
+		container = append(container, newTestMeta(idx))
+		container[idx].DChunks = 2
+		container[idx].Placement = []uint64{uint64(idx), uint64(idx)}
+
+		_, found := placer.NextAvailableObject(container[idx], nil)
+		Expect(found).To(Equal(false))
+		Expect(dumpPlacer(placer)).To(Equal("0-0,1-0,2-0,3-0,4-0,5-0,6-0,7-0,8-0,9-0"))
+	})
+
 	It("should replace the unvisited object even the newer has been appended to the list", func() {
 		placer := initPlacer(1)
 		idx := len(container)
@@ -206,6 +218,36 @@ var _ = Describe("Placer", func() {
 		Expect(container[idx+1].placerMeta.(*LRUPlacerMeta).swapMap).To(Equal(container[0].Placement))
 	})
 
+	It("should remove the deleted object from the LRU", func() {
+		// Instances are created without a cluster, only sizes are managed by the placer.
+		im := &TestInstanceManager{all: []*lambdastore.Instance{{}, {}}}
+		for _, ins := range im.all {
+			ins.Meta.ResetCapacity(1000, 0)
+		}
+		placer := NewLRUPlacer(New(), im)
+		for i := 0; i < 2; i++ {
+			meta, _, err := placer.Insert(strconv.Itoa(i), placer.NewMeta("req", strconv.Itoa(i), 100, 1, 0, 0, 100, uint64(i), 0))
+			Expect(err).To(BeNil())
+			meta.ConfirmCreated()
+		}
+		Expect(dumpPlacer(placer)).To(Equal("0-1,1-1"))
+		Expect(placer.cluster.Instance(0).Meta.Size()).To(Equal(uint64(100)))
+
+		deleted, ok := placer.Delete("0")
+		Expect(ok).To(BeTrue())
+		Expect(dumpPlacer(placer)).To(Equal("nil,1-1"))
+		Expect(placer.cluster.Instance(0).Meta.Size()).To(Equal(uint64(0)))
+
+		// The removed object will not be evicted again.
+		meta := placer.NewMeta("req", "2", 100, 1, 0, 0, 100, 1, 0)
+		meta.placerMeta = newLRUPlacerMeta(1)
+		placer.NextAvailableObject(meta, nil)
+		Expect(deleted.placerMeta.(*LRUPlacerMeta).evicts).To(BeNil())
+		_, found := placer.NextAvailableObject(meta, nil)
+		Expect(found).To(BeTrue())
+		Expect(meta.placerMeta.(*LRUPlacerMeta).evicts.Key()).To(Equal("1"))
+	})
+
 	It("should post process callback works", func() {
 		var called string
 		cb := func(meta *Meta) {
@@ -1,13 +1,17 @@
 package metastore
 
 import (
+	"errors"
 	"fmt"
 	"regexp"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	safesync "github.com/sionreview/sion/common/sync"
+	protocol "github.com/sionreview/sion/common/types"
 )
 
 const (
@@ -19,6 +23,11 @@ const (
 	MetaFlagCreated = int32(0x02)
 	// MetaFlagDeleted flags that the object is deleted
 	MetaFlagDeleted = int32(0x04)
+	// MetaFlagRemoved flags that the object is deleted on request and should not be recovered.
+	MetaFlagRemoved = int32(0x08)
+
+	// AnyVersion skips version checking on creating a new version.
+	AnyVersion = -1
 
 	replacerDelimiter = "=at."
 	invalidVersion    = 0
@@ -26,6 +35,8 @@ const (
 
 var (
 	RegDelimiter = regexp.MustCompile(`@`)
+
+	ErrInvalidChunkKey = errors.New("invalid chunk key")
 )
 
 var (
@@ -62,11 +73,24 @@ func MetaKeyByVersion(key string, ver int) string {
 
 type Meta struct {
 	key     string
+	rawKey  string
 	Size    int64
 	DChunks int
 	PChunks int
 	Placement
 	ChunkSize int64
+	// Checksums of chunks, 0 if unknown.
+	Checksums []uint64
+	// Name of the storage class, empty for the default.
+	Class string
+	// Chunks are full replicas of the object instead of being erasure coded. There are DChunks(1)+PChunks replicas.
+	Replicated bool
+	// Number of fragments of a large object, each fragment is stored as a sub-object sharing the size of the object.
+	NumFrags int
+	// How the object is compressed by the client in the format "name:size", empty if not compressed.
+	Codec string
+	// Opaque flags set by the client, e.g. flags of memcached.
+	ClientFlags uint32
 
 	// Versioning parameters
 	// Version
@@ -77,42 +101,58 @@ type Meta struct {
 	lastVersion int
 	// The requestId of initiate request
 	initiator string
+	// Time in unix nano when the object expires, 0 if the object never expires.
+	expireAt int64
 	// Flags to indicate if the status of object
 	// 0x00: invalid
 	// 0x01: valid and creating (initial state)
 	// 0x03: created
 	// 0x05: deleted
+	// 0x0F: removed
 	// 0x01 -> 0x00 if creation failed or timeout.
 	// 0x01 -> 0x03 if creation succeeded.
 	// 0x03 -> 0x05 if deleted.
+	// 0x03 -> 0x0F if removed.
 	flags int32
 
-	slice      Slice
-	deadline   int64 // Deadline for the creation operation.
-	placerMeta interface{}
-	lastChunk  int
-	confirmed  safesync.WaitGroup
-	mu         sync.Mutex
+	slice           Slice
+	deadline        int64 // Deadline for the creation operation.
+	expectedVersion int   // Expected latest version for conditional creation, 0 if the object should not exist.
+	placerMeta      interface{}
+	lastChunk       int
+	confirmed       safesync.WaitGroup
+	journal         *Journal // Journal to log changes, set if the meta is stored in a persistent metastore.
+	mu              sync.Mutex
 }
 
 // For testing purpose
 func newEmptyMeta() *Meta {
 	meta := metaPool.Get().(*Meta)
 	meta.key = ""
+	meta.rawKey = ""
 	meta.Size = 0
 	meta.DChunks = 0
 	meta.PChunks = 0
 	meta.Placement = nil
 	meta.ChunkSize = 0
+	meta.Checksums = nil
+	meta.Class = ""
+	meta.Replicated = false
+	meta.NumFrags = 1
+	meta.Codec = ""
+	meta.ClientFlags = 0
 
 	meta.version = 0
 	meta.versionTs = 0
 	meta.lastVersion = 0
 	meta.initiator = ""
+	meta.expireAt = 0
 	meta.flags = 0
 
 	meta.deadline = 0
+	meta.expectedVersion = AnyVersion
 	meta.placerMeta = nil
+	meta.journal = nil
 
 	return meta
 }
@@ -120,20 +160,30 @@ func newEmptyMeta() *Meta {
 func NewMeta(reqId string, key string, size int64, d, p int, chunkSize int64) *Meta {
 	meta := metaPool.Get().(*Meta)
 	meta.key = santicizeKey(key)
+	meta.rawKey = key
 	meta.Size = size
 	meta.DChunks = d
 	meta.PChunks = p
 	meta.Placement = initPlacement(meta.Placement, meta.NumChunks())
 	meta.ChunkSize = chunkSize
+	meta.Checksums = initPlacement(meta.Checksums, meta.NumChunks()) // Zero filled.
+	meta.Class = ""
+	meta.Replicated = false
+	meta.NumFrags = 1
+	meta.Codec = ""
+	meta.ClientFlags = 0
 
 	meta.version = 1
 	meta.versionTs = time.Now().Unix()
 	meta.lastVersion = 0
 	meta.initiator = reqId
+	meta.expireAt = 0
 	meta.flags = MetaFlagValid
 
 	meta.deadline = 0
+	meta.expectedVersion = AnyVersion
 	meta.placerMeta = nil
+	meta.journal = nil
 	meta.confirmed.Add(1)
 
 	return meta
@@ -164,6 +214,11 @@ func (m *Meta) Key() string {
 	return m.key
 }
 
+// RawKey returns the key specified by the client.
+func (m *Meta) RawKey() string {
+	return m.rawKey
+}
+
 func (m *Meta) VersioningKey() string {
 	return metaKeyByVersion(m.key, m.version)
 }
@@ -176,18 +231,100 @@ func (m *Meta) ChunkKey(chunkId int) string {
 	return fmt.Sprintf("%d@%s@v%d", chunkId, m.key, m.version)
 }
 
+// ParseChunkKey is the reverse of Meta.ChunkKey. The key returned is santicized.
+func ParseChunkKey(chunkKey string) (key string, ver int, chunkId int, err error) {
+	parts := strings.Split(chunkKey, "@")
+	if len(parts) != 3 || !strings.HasPrefix(parts[2], "v") {
+		return "", 0, 0, ErrInvalidChunkKey
+	}
+
+	if chunkId, err = strconv.Atoi(parts[0]); err != nil {
+		return "", 0, 0, ErrInvalidChunkKey
+	}
+	if ver, err = strconv.Atoi(parts[2][1:]); err != nil {
+		return "", 0, 0, ErrInvalidChunkKey
+	}
+	return parts[1], ver, chunkId, nil
+}
+
+// Checksum returns the checksum of specified chunk, 0 if unknown.
+func (m *Meta) Checksum(chunkId int) uint64 {
+	if chunkId < 0 || chunkId >= len(m.Checksums) {
+		return 0
+	}
+	return m.Checksums[chunkId]
+}
+
+// SetChecksum sets the checksum of specified chunk. It should be called before the chunk is placed.
+func (m *Meta) SetChecksum(chunkId int, checksum uint64) {
+	if chunkId >= 0 && chunkId < len(m.Checksums) {
+		m.Checksums[chunkId] = checksum
+	}
+}
+
 func (m *Meta) NumChunks() int {
 	return m.DChunks + m.PChunks
 }
 
+// Layout returns how chunks are stored in the format "d-p" if erasure coded, or "rN" for N replicas.
+func (m *Meta) Layout() string {
+	if m.Replicated {
+		return fmt.Sprintf("r%d", m.NumChunks())
+	}
+	return fmt.Sprintf("%d-%d", m.DChunks, m.PChunks)
+}
+
+// OriginalSize returns the size of the object before compression or encryption.
+func (m *Meta) OriginalSize() int64 {
+	if stages := protocol.SplitObjectCodecs(m.Codec); len(stages) > 0 {
+		if _, size, err := protocol.ParseObjectCodec(stages[0]); err == nil {
+			return size
+		}
+	}
+	return m.Size
+}
+
+// Attrs returns attributes of the object stored along with chunks, so the meta can be rebuilt from chunks.
+func (m *Meta) Attrs() *protocol.ObjectAttrs {
+	return &protocol.ObjectAttrs{
+		Size:        m.Size,
+		DChunks:     m.DChunks,
+		PChunks:     m.PChunks,
+		Class:       m.Class,
+		Replicated:  m.Replicated,
+		NumFrags:    m.NumFrags,
+		Codec:       m.Codec,
+		ClientFlags: m.ClientFlags,
+		ExpireAt:    m.expireAt,
+	}
+}
+
+// RawSize returns the size of the object in the format "size[-fragments]".
+func (m *Meta) RawSize() string {
+	return protocol.FormatObjectSize(m.Size, m.NumFrags)
+}
+
 func (m *Meta) GetPlace(chunkId int) uint64 {
 	return m.Placement[chunkId]
 }
 
+// SetPlace relocates the chunk to specified instance. The change will be logged if the object is created.
+func (m *Meta) SetPlace(chunkId int, insId uint64) {
+	m.Placement[chunkId] = insId
+	if m.IsCreated() {
+		m.logChange()
+	}
+}
+
 func (m *Meta) Version() int {
 	return m.version
 }
 
+// VersionTime returns the time the version was created.
+func (m *Meta) VersionTime() time.Time {
+	return time.Unix(m.versionTs, 0)
+}
+
 func (m *Meta) HasHistory() bool {
 	return m.lastVersion > invalidVersion
 }
@@ -221,6 +358,7 @@ func (m *Meta) IsValid() bool {
 func (m *Meta) ConfirmCreated() {
 	// Ensure the meta will be set to created only once.
 	if atomic.CompareAndSwapInt32(&m.flags, MetaFlagValid, MetaFlagCreated|MetaFlagValid) {
+		m.logChange()
 		m.confirmed.Done()
 	}
 }
@@ -231,20 +369,71 @@ func (m *Meta) IsCreated() bool {
 
 func (m *Meta) Delete() {
 	m.flags |= MetaFlagDeleted
+	m.logChange()
 }
 
 func (m *Meta) IsDeleted() bool {
 	return m.flags&MetaFlagDeleted > 0
 }
 
+// Remove flags the created object as deleted on request. Returns false if the object is not created or has been removed.
+func (m *Meta) Remove() bool {
+	for {
+		flags := atomic.LoadInt32(&m.flags)
+		if flags&MetaFlagCreated == 0 || flags&MetaFlagRemoved > 0 {
+			return false
+		} else if atomic.CompareAndSwapInt32(&m.flags, flags, flags|MetaFlagDeleted|MetaFlagRemoved) {
+			m.logChange()
+			return true
+		}
+	}
+}
+
+func (m *Meta) IsRemoved() bool {
+	return m.flags&MetaFlagRemoved > 0
+}
+
+// SetTTL sets the time to live of the object since now. The object never expires if ttl is 0.
+func (m *Meta) SetTTL(ttl time.Duration) {
+	if ttl > 0 {
+		m.expireAt = time.Now().Add(ttl).UnixNano()
+	} else {
+		m.expireAt = 0
+	}
+}
+
+// TTL returns the time left before the object expires, 0 if the object never expires.
+func (m *Meta) TTL() time.Duration {
+	if m.expireAt == 0 {
+		return 0
+	}
+	return time.Until(time.Unix(0, m.expireAt))
+}
+
+// IsExpired returns true if the object expires at specified time.
+func (m *Meta) IsExpired(now time.Time) bool {
+	return m.expireAt > 0 && now.UnixNano() >= m.expireAt
+}
+
 func (m *Meta) SetTimout(timeout time.Duration) {
 	m.deadline = m.versionTs + int64(timeout)
 }
 
+// ExpectVersion makes the creation conditional on the latest created version. Use 0 to expect the object not exists.
+func (m *Meta) ExpectVersion(ver int) {
+	m.expectedVersion = ver
+}
+
 func (m *Meta) Wait() {
 	m.confirmed.Wait()
 }
 
+func (m *Meta) logChange() {
+	if m.journal != nil {
+		m.journal.Append(m)
+	}
+}
+
 func (m *Meta) close() {
 	m.Invalidate()
 	metaPool.Put(m)
@@ -1,13 +1,19 @@
 package metastore
 
 import (
+	"container/heap"
 	"errors"
+	"net"
+	"sort"
+	"time"
 
+	"github.com/sionreview/sion/common/types"
 	"github.com/sionreview/sion/common/util/hashmap"
 )
 
 var (
 	ErrConcurrentCreation = errors.New("concurrent creation")
+	ErrVersionConflict    = errors.New("version conflict")
 )
 
 type MetaPostProcess func(MetaDoPostProcess)
@@ -17,6 +23,7 @@ type MetaDoPostProcess func(*Meta)
 
 type MetaStore struct {
 	metaMap hashmap.HashMap
+	journal *Journal
 }
 
 func New() *MetaStore {
@@ -29,7 +36,15 @@ func NewWithCapacity(size int) *MetaStore {
 
 // GetOrInsert get the meta if exists, otherwise insert a new one.
 // The second return value is true if a existed meta is loaded.
+// If the insert expects a version, ErrVersionConflict will be returned if the latest created version does not match.
 func (ms *MetaStore) GetOrInsert(key string, insert *Meta) (*Meta, bool, error) {
+	// A nonexistent object can only match the expectation of no version.
+	if insert.expectedVersion > invalidVersion {
+		if _, ok := ms.metaMap.Load(key); !ok {
+			return nil, false, ErrVersionConflict
+		}
+	}
+
 	var latestMeta *Meta
 	candidate := insert
 	for {
@@ -46,6 +61,7 @@ func (ms *MetaStore) GetOrInsert(key string, insert *Meta) (*Meta, bool, error)
 
 		// The candidate wins and makes the change.
 		if firstChunk {
+			latestMeta.journal = ms.journal
 			ms.metaMap.Store(latestMeta.VersioningKey(), latestMeta) // Also, create a entry for the version key.
 			return latestMeta, false, nil                            // Keep return consistent with the LoadOrStore call.
 		}
@@ -65,9 +81,27 @@ func (ms *MetaStore) GetOrInsert(key string, insert *Meta) (*Meta, bool, error)
 			if candidate != insert {
 				candidate.close()
 			}
+			// Conditional creation fails on concurrent creation, for the expected version will be outdated.
+			if insert.expectedVersion != AnyVersion {
+				return latestMeta, true, ErrVersionConflict
+			}
 			return latestMeta, true, ErrConcurrentCreation
 		}
 
+		// Check the expectation before creating a new version.
+		if insert.expectedVersion != AnyVersion {
+			version := invalidVersion
+			if created, ok := ms.lastCreated(latestMeta); ok {
+				version = created.Version()
+			}
+			if version != insert.expectedVersion {
+				if candidate != insert {
+					candidate.close()
+				}
+				return latestMeta, true, ErrVersionConflict
+			}
+		}
+
 		// Or(in case of invalidated, created, or deleted) we create a new version
 		newVersion := latestMeta.ReviseBy(candidate)
 		if candidate != insert {
@@ -80,21 +114,33 @@ func (ms *MetaStore) GetOrInsert(key string, insert *Meta) (*Meta, bool, error)
 }
 
 func (ms *MetaStore) Get(key string) (*Meta, bool) {
-	for {
-		m, ok := ms.metaMap.Load(key)
-		if !ok {
-			return nil, ok
-		}
+	m, ok := ms.metaMap.Load(key)
+	if !ok {
+		return nil, ok
+	}
 
-		meta, _ := m.(*Meta)
+	return ms.lastCreated(m.(*Meta))
+}
+
+// lastCreated returns the latest created version, starting from specified version and falling back to previous versions.
+func (ms *MetaStore) lastCreated(meta *Meta) (*Meta, bool) {
+	for {
 		// Validate meta status first (so status can be concluded if PUT timeout),
 		// And if the object is created (can be deleted), return the meta.
 		if meta.Validate() && meta.IsCreated() {
-			return meta, ok
+			if meta.IsRemoved() || meta.IsExpired(time.Now()) {
+				// The latest version is removed or expired, no fallback to previous versions.
+				return nil, false
+			}
+			return meta, true
 		} else if meta.HasHistory() {
 			// The request that created the meta has not succeeded (requesting or failed).
 			// Load the previous version.
-			key = meta.KeyByVersion(meta.PreviousVersion())
+			m, ok := ms.metaMap.Load(meta.KeyByVersion(meta.PreviousVersion()))
+			if !ok {
+				return nil, ok
+			}
+			meta = m.(*Meta)
 			// continue
 		} else {
 			// This is the first version
@@ -110,13 +156,212 @@ func (ms *MetaStore) GetByVersion(key string, ver int) (*Meta, bool) {
 	}
 
 	meta, _ := m.(*Meta)
-	if meta.IsCreated() {
+	if meta.IsCreated() && !meta.IsRemoved() && !meta.IsExpired(time.Now()) {
 		return meta, ok
 	} else {
 		return nil, false
 	}
 }
 
+// Delete removes the latest created version of the object and returns the removed meta.
+// Chunks of the removed version are left to the caller to clean up.
+func (ms *MetaStore) Delete(key string) (*Meta, bool) {
+	for {
+		meta, ok := ms.Get(key)
+		if !ok {
+			return nil, false
+		} else if meta.Remove() {
+			return meta, true
+		}
+		// The meta is removed concurrently, try again.
+	}
+}
+
+// Expire removes all objects that expire at specified time and returns the number of objects removed.
+// Chunks of removed objects are left to the callback to clean up.
+func (ms *MetaStore) Expire(now time.Time, expired MetaDoPostProcess) int {
+	removed := 0
+	ms.Range(func(meta *Meta) bool {
+		if meta.IsExpired(now) && meta.Remove() {
+			removed++
+			expired(meta)
+		}
+		return true
+	})
+	return removed
+}
+
+// Range iterates all metas of created versions, including deleted ones.
+func (ms *MetaStore) Range(cb func(*Meta) bool) {
+	ms.metaMap.Range(func(key interface{}, m interface{}) bool {
+		meta := m.(*Meta)
+		// Skip the entry of the raw key, the meta is also stored with the version key.
+		if key.(string) != meta.VersioningKey() || !meta.IsCreated() {
+			return true
+		}
+		return cb(meta)
+	})
+}
+
+// Scan returns at most count latest created metas of objects in the scan order, starting from the cursor.
+// Metas of objects that do not match are skipped. Along with the metas, the cursor to continue scanning is returned,
+// which is 0 if all objects have been scanned. Objects created or deleted during scanning may or may not be returned.
+// All matched metas are returned in no particular order if count is not positive.
+func (ms *MetaStore) Scan(cursor uint64, count int, match func(string) bool) ([]*Meta, uint64) {
+	if count <= 0 {
+		metas := make([]*Meta, 0)
+		ms.scan(cursor, match, func(_ uint64, meta *Meta) {
+			metas = append(metas, meta)
+		})
+		return metas, 0
+	}
+
+	// Keep the candidates of the least orders in a max-heap, so only about count metas are held and sorted.
+	candidates := make(scanHeap, 0, count+1)
+	next := uint64(0)
+	ms.scan(cursor, match, func(order uint64, meta *Meta) {
+		if len(candidates) >= count && order > candidates[0].order {
+			if next == 0 || order < next {
+				next = order
+			}
+			return
+		}
+		heap.Push(&candidates, scanned{order: order, meta: meta})
+
+		// Keys of the same order are returned in the same batch, so the cursor can be resumed unambiguously.
+		// Evict the candidates of the greatest order only if enough candidates are left.
+		for len(candidates) > count {
+			top := candidates[0].order
+			var evicted []scanned
+			for len(candidates) > 0 && candidates[0].order == top {
+				evicted = append(evicted, heap.Pop(&candidates).(scanned))
+			}
+			if len(candidates) < count {
+				for _, e := range evicted {
+					heap.Push(&candidates, e)
+				}
+				break
+			}
+			if next == 0 || top < next {
+				next = top
+			}
+		}
+	})
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].order < candidates[j].order
+	})
+
+	metas := make([]*Meta, len(candidates))
+	for i, c := range candidates {
+		metas[i] = c.meta
+	}
+	return metas, next
+}
+
+// scan calls back with the latest created metas of matched objects from the cursor, along with their scan orders.
+func (ms *MetaStore) scan(cursor uint64, match func(string) bool, cb func(uint64, *Meta)) {
+	ms.metaMap.Range(func(key interface{}, m interface{}) bool {
+		meta := m.(*Meta)
+		// Skip the entries of version keys, only the latest version is returned.
+		if key.(string) != meta.RawKey() {
+			return true
+		}
+		order := types.ScanOrder(meta.RawKey())
+		if order < cursor || (match != nil && !match(meta.RawKey())) {
+			return true
+		}
+		if created, ok := ms.lastCreated(meta); ok && !created.IsDeleted() {
+			cb(order, created)
+		}
+		return true
+	})
+}
+
+type scanned struct {
+	order uint64
+	meta  *Meta
+}
+
+// scanHeap is a max-heap of scanned metas by order, see MetaStore.Scan.
+type scanHeap []scanned
+
+func (h scanHeap) Len() int            { return len(h) }
+func (h scanHeap) Less(i, j int) bool  { return h[i].order > h[j].order }
+func (h scanHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *scanHeap) Push(x interface{}) { *h = append(*h, x.(scanned)) }
+func (h *scanHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// Recover restores metas from the journal and enables journaling thereafter.
+// The restored callback is called on each meta in the order of the journal.
+func (ms *MetaStore) Recover(journal *Journal, restored MetaDoPostProcess) (int, error) {
+	n, err := journal.Replay(func(record *metaRecord) {
+		meta := newMetaFromRecord(record)
+		meta.journal = journal
+		ms.restore(meta)
+		if restored != nil {
+			restored(meta)
+		}
+	})
+	if err != nil {
+		return n, err
+	}
+
+	ms.journal = journal
+	return n, nil
+}
+
+// Reconcile inserts metas rebuilt from chunks reported by instances and returns the number of metas inserted.
+// Metas of versions known are skipped and closed. Inserted metas are logged if journaling is enabled.
+// The restored callback is called on each meta inserted except deleted ones, e.g. metas of lost objects.
+func (ms *MetaStore) Reconcile(metas []*Meta, restored MetaDoPostProcess) int {
+	inserted := 0
+	for _, meta := range metas {
+		if _, ok := ms.metaMap.Load(meta.VersioningKey()); ok {
+			meta.close()
+			continue
+		}
+
+		meta.journal = ms.journal
+		ms.restore(meta)
+		meta.logChange()
+		inserted++
+		if restored != nil && !meta.IsDeleted() {
+			restored(meta)
+		}
+	}
+	return inserted
+}
+
+// restore stores the meta with the versioning key, and with the raw key if the meta is of the latest version.
+func (ms *MetaStore) restore(meta *Meta) {
+	ms.metaMap.Store(meta.VersioningKey(), meta)
+	if m, ok := ms.metaMap.Load(meta.RawKey()); !ok || m.(*Meta).Version() < meta.Version() {
+		ms.metaMap.Store(meta.RawKey(), meta)
+	}
+}
+
+// Snapshot persists metas provided by the range and truncates the journal. It is a no-op if journaling is not enabled.
+func (ms *MetaStore) Snapshot(metas MetaRange) (int, error) {
+	if ms.journal == nil {
+		return 0, nil
+	}
+	return ms.journal.Snapshot(metas)
+}
+
+// Replicate streams metas provided by the range and changes thereafter to the standby, see Journal.Replicate.
+// ErrNotPersisted is returned if journaling is not enabled.
+func (ms *MetaStore) Replicate(conn net.Conn, metas MetaRange) (int, error) {
+	if ms.journal == nil {
+		return 0, ErrNotPersisted
+	}
+	return ms.journal.Replicate(conn, metas)
+}
+
 func (ms *MetaStore) Len() int {
 	return ms.metaMap.Len()
 }
@@ -0,0 +1,195 @@
+package metastore
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/sionreview/sion/common/types"
+)
+
+var _ = Describe("MetaStore", func() {
+	It("should not get removed object", func() {
+		store := New()
+
+		meta, got, err := store.GetOrInsert("key", NewMeta("req1", "key", 10, 1, 0, 10))
+		Expect(err).To(BeNil())
+		Expect(got).To(Equal(false))
+		meta.ConfirmCreated()
+
+		loaded, ok := store.Get("key")
+		Expect(ok).To(Equal(true))
+		Expect(loaded).To(Equal(meta))
+
+		removed, ok := store.Delete("key")
+		Expect(ok).To(Equal(true))
+		Expect(removed).To(Equal(meta))
+		Expect(removed.IsDeleted()).To(Equal(true))
+
+		_, ok = store.Get("key")
+		Expect(ok).To(Equal(false))
+		_, ok = store.GetByVersion("key", meta.Version())
+		Expect(ok).To(Equal(false))
+
+		_, ok = store.Delete("key")
+		Expect(ok).To(Equal(false))
+	})
+
+	It("should create new version after removed", func() {
+		store := New()
+
+		meta, _, _ := store.GetOrInsert("key", NewMeta("req1", "key", 10, 1, 0, 10))
+		meta.ConfirmCreated()
+		store.Delete("key")
+
+		prepared := NewMeta("req2", "key", 10, 1, 0, 10)
+		prepared.SetTimout(time.Minute)
+		revised, got, err := store.GetOrInsert("key", prepared)
+		Expect(err).To(BeNil())
+		Expect(got).To(Equal(false))
+		Expect(revised.Version()).To(Equal(meta.Version() + 1))
+
+		// Removed version will not be used as fallback.
+		_, ok := store.Get("key")
+		Expect(ok).To(Equal(false))
+
+		revised.ConfirmCreated()
+		loaded, ok := store.Get("key")
+		Expect(ok).To(Equal(true))
+		Expect(loaded).To(Equal(revised))
+	})
+
+	It("should create conditionally on version", func() {
+		store := New()
+
+		// Nonexistent object expects no version.
+		conditional := NewMeta("req1", "key", 10, 1, 0, 10)
+		conditional.ExpectVersion(1)
+		_, _, err := store.GetOrInsert("key", conditional)
+		Expect(err).To(Equal(ErrVersionConflict))
+
+		conditional = NewMeta("req2", "key", 10, 1, 0, 10)
+		conditional.ExpectVersion(0)
+		conditional.SetTimout(time.Minute)
+		meta, _, err := store.GetOrInsert("key", conditional)
+		Expect(err).To(BeNil())
+
+		// Concurrent creation conflicts.
+		conditional = NewMeta("req3", "key", 10, 1, 0, 10)
+		conditional.ExpectVersion(0)
+		_, _, err = store.GetOrInsert("key", conditional)
+		Expect(err).To(Equal(ErrVersionConflict))
+
+		meta.ConfirmCreated()
+		conditional = NewMeta("req4", "key", 10, 1, 0, 10)
+		conditional.ExpectVersion(0)
+		_, _, err = store.GetOrInsert("key", conditional)
+		Expect(err).To(Equal(ErrVersionConflict))
+
+		conditional = NewMeta("req5", "key", 10, 1, 0, 10)
+		conditional.ExpectVersion(meta.Version())
+		revised, got, err := store.GetOrInsert("key", conditional)
+		Expect(err).To(BeNil())
+		Expect(got).To(Equal(false))
+		Expect(revised.Version()).To(Equal(meta.Version() + 1))
+	})
+
+	It("should expire object", func() {
+		store := New()
+
+		meta, _, _ := store.GetOrInsert("key", NewMeta("req1", "key", 10, 1, 0, 10))
+		meta.SetTTL(time.Minute)
+		meta.ConfirmCreated()
+		persisted, _, _ := store.GetOrInsert("persisted", NewMeta("req2", "persisted", 10, 1, 0, 10))
+		persisted.ConfirmCreated()
+
+		_, ok := store.Get("key")
+		Expect(ok).To(Equal(true))
+
+		later := time.Now().Add(2 * time.Minute)
+		Expect(meta.IsExpired(later)).To(Equal(true))
+		Expect(persisted.IsExpired(later)).To(Equal(false))
+
+		expired := make([]*Meta, 0, 1)
+		Expect(store.Expire(later, func(meta *Meta) {
+			expired = append(expired, meta)
+		})).To(Equal(1))
+		Expect(expired).To(ConsistOf(meta))
+		Expect(meta.IsRemoved()).To(Equal(true))
+
+		_, ok = store.Get("key")
+		Expect(ok).To(Equal(false))
+		_, ok = store.Get("persisted")
+		Expect(ok).To(Equal(true))
+	})
+
+	It("should scan latest created objects", func() {
+		store := New()
+
+		keys := []string{"a1", "a2", "a3", "b1", "b@2"}
+		for i, key := range keys {
+			meta, _, _ := store.GetOrInsert(key, NewMeta(fmt.Sprintf("req%d", i), key, 10, 1, 0, 10))
+			meta.ConfirmCreated()
+		}
+		// A new version is listed once.
+		revised, _, _ := store.GetOrInsert("a1", NewMeta("req5", "a1", 10, 1, 0, 10))
+		revised.ConfirmCreated()
+		// A creating object is skipped.
+		creating := NewMeta("req6", "creating", 10, 1, 0, 10)
+		creating.SetTimout(time.Minute)
+		store.GetOrInsert("creating", creating)
+		// A removed object is skipped.
+		store.Delete("b1")
+
+		scanned := make([]string, 0, len(keys))
+		cursor := uint64(0)
+		for batches := 0; batches == 0 || cursor != 0; batches++ {
+			Expect(batches).To(BeNumerically("<", len(keys)))
+
+			var metas []*Meta
+			metas, cursor = store.Scan(cursor, 1, nil)
+			Expect(len(metas)).To(Equal(1))
+			scanned = append(scanned, metas[0].RawKey())
+			if metas[0].RawKey() == "a1" {
+				Expect(metas[0]).To(Equal(revised))
+			}
+		}
+		Expect(scanned).To(ConsistOf("a1", "a2", "a3", "b@2"))
+
+		metas, cursor := store.Scan(0, 0, func(key string) bool { return strings.HasPrefix(key, "a") })
+		Expect(cursor).To(Equal(uint64(0)))
+		Expect(len(metas)).To(Equal(3))
+	})
+
+	It("should scan objects in pages of the least orders", func() {
+		store := New()
+
+		keys := make([]string, 50)
+		for i := range keys {
+			keys[i] = fmt.Sprintf("key%d", i)
+			meta, _, _ := store.GetOrInsert(keys[i], NewMeta(fmt.Sprintf("req%d", i), keys[i], 10, 1, 0, 10))
+			meta.ConfirmCreated()
+		}
+
+		scanned := make([]string, 0, len(keys))
+		last := uint64(0)
+		for cursor, batches := uint64(0), 0; batches == 0 || cursor != 0; batches++ {
+			var metas []*Meta
+			metas, cursor = store.Scan(cursor, 3, nil)
+			Expect(len(metas)).To(BeNumerically("<=", 3))
+			for _, meta := range metas {
+				order := types.ScanOrder(meta.RawKey())
+				Expect(order).To(BeNumerically(">=", last))
+				if cursor != 0 {
+					Expect(order).To(BeNumerically("<", cursor))
+				}
+				last = order
+				scanned = append(scanned, meta.RawKey())
+			}
+		}
+		Expect(scanned).To(ConsistOf(keys))
+	})
+})
@@ -1,6 +1,9 @@
 package metastore
 
 import (
+	"net"
+	"time"
+
 	"github.com/sionreview/sion/common/logger"
 	protocol "github.com/sionreview/sion/common/types"
 	"github.com/sionreview/sion/proxy/config"
@@ -32,8 +35,24 @@ type Placer interface {
 	Place(meta *Meta, chunkId int, req types.Command) (ins *lambdastore.Instance, postProcess MetaPostProcess, err error)
 	Get(string, int) (*Meta, bool)
 	GetByVersion(string, int, int) (*Meta, bool)
+	// Delete removes the latest version of the object and returns the removed meta.
+	Delete(string) (*Meta, bool)
+	// Expire removes objects that expire at specified time. Removed metas are passed to the callback for cleaning up.
+	Expire(time.Time, MetaDoPostProcess) int
+	// Recover restores metas from the journal and returns the number of metas restored.
+	Recover(*Journal) (int, error)
+	// Reconcile inserts metas rebuilt from chunks reported by instances and returns the number of metas inserted.
+	Reconcile([]*Meta) int
+	// Snapshot persists all metas to the journal.
+	Snapshot() (int, error)
+	// Replicate streams all metas and changes thereafter to the standby proxy connected.
+	Replicate(net.Conn) (int, error)
+	// Scan returns at most specified number of metas of matched objects from the cursor, and the cursor to continue.
+	Scan(cursor uint64, count int, match func(string) bool) ([]*Meta, uint64)
 	Dispatch(*lambdastore.Instance, types.Command) error
 	MetaStats() types.MetaStoreStats
+	// Store returns the meta store for lookups without side effects.
+	Store() *MetaStore
 	RegisterHandler(event PlacerEvent, handler PlacerHandler)
 }
 
@@ -70,6 +89,7 @@ func (l *DefaultPlacer) InsertAndPlace(key string, newMeta *Meta, cmd types.Comm
 		return meta, nil, err
 	}
 	if got {
+		meta.SetChecksum(chunkId, newMeta.Checksum(chunkId))
 		newMeta.close()
 	}
 	cmd.GetRequest().Key = meta.ChunkKey(chunkId)
@@ -109,6 +129,59 @@ func (l *DefaultPlacer) GetByVersion(key string, ver int, chunk int) (*Meta, boo
 	return meta, ok
 }
 
+func (l *DefaultPlacer) Delete(key string) (*Meta, bool) {
+	meta, ok := l.metaStore.Delete(key)
+	if !ok {
+		return nil, ok
+	}
+
+	l.releaseChunks(meta)
+	return meta, ok
+}
+
+func (l *DefaultPlacer) Scan(cursor uint64, count int, match func(string) bool) ([]*Meta, uint64) {
+	return l.metaStore.Scan(cursor, count, match)
+}
+
+func (l *DefaultPlacer) Expire(now time.Time, expired MetaDoPostProcess) int {
+	return l.metaStore.Expire(now, func(meta *Meta) {
+		l.releaseChunks(meta)
+		expired(meta)
+	})
+}
+
+func (l *DefaultPlacer) Recover(journal *Journal) (int, error) {
+	return l.metaStore.Recover(journal, l.restoreChunks)
+}
+
+func (l *DefaultPlacer) Reconcile(metas []*Meta) int {
+	return l.metaStore.Reconcile(metas, l.restoreChunks)
+}
+
+// restoreChunks reserves the space of chunks on instances. Missing instances will be resolved by relocation on requesting.
+func (l *DefaultPlacer) restoreChunks(meta *Meta) {
+	if meta.IsDeleted() {
+		return
+	}
+
+	for i, insId := range meta.Placement {
+		if insId == InvalidPlacement {
+			continue
+		}
+		if ins := l.cluster.Instance(insId); ins != nil {
+			ins.AddChunk(meta.ChunkKey(i), meta.ChunkSize)
+		}
+	}
+}
+
+func (l *DefaultPlacer) Snapshot() (int, error) {
+	return l.metaStore.Snapshot(l.metaStore.Range)
+}
+
+func (l *DefaultPlacer) Replicate(conn net.Conn) (int, error) {
+	return l.metaStore.Replicate(conn, l.metaStore.Range)
+}
+
 func (l *DefaultPlacer) Place(meta *Meta, chunkId int, cmd types.Command) (*lambdastore.Instance, MetaPostProcess, error) {
 	test := chunkId
 	instances := l.cluster.GetActiveInstances(len(meta.Placement))
@@ -210,6 +283,24 @@ func (l *DefaultPlacer) MetaStats() types.MetaStoreStats {
 	return l.metaStore
 }
 
+func (l *DefaultPlacer) Store() *MetaStore {
+	return l.metaStore
+}
+
+// releaseChunks releases the space reserved on placing.
+func (l *DefaultPlacer) releaseChunks(meta *Meta) {
+	for i, insId := range meta.Placement {
+		if insId == InvalidPlacement {
+			continue
+		}
+		if ins := l.cluster.Instance(insId); ins != nil {
+			numChunks, size := ins.RemoveChunk(meta.ChunkKey(i), meta.ChunkSize)
+			l.log.Debug("Lambda %d size updated: %d of %d (key:%s, Δ:%d, chunks:%d).",
+				ins.Id(), size, ins.Meta.EffectiveCapacity(), meta.ChunkKey(i), -meta.ChunkSize, numChunks)
+		}
+	}
+}
+
 func (l *DefaultPlacer) testChunk(ins *lambdastore.Instance, inc uint64) bool {
 	numChunk := 0
 	threshold := config.Threshold
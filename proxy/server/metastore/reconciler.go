@@ -0,0 +1,190 @@
+package metastore
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sionreview/sion/common/logger"
+	protocol "github.com/sionreview/sion/common/types"
+	"github.com/sionreview/sion/proxy/global"
+	"github.com/sionreview/sion/proxy/lambdastore"
+)
+
+var (
+	ErrObjectAttrsMissing = errors.New("attributes of the object not reported")
+	ErrReconciling        = errors.New("reconciling with instances, retry later")
+)
+
+// Reconciler Rebuilds metas from chunks reported by instances, so objects stored on instances can be served after the
+// proxy restarts without metas. Keys, versions, and chunk ids are parsed from chunk keys, see Meta.ChunkKey, and other
+// attributes, e.g. the size and the layout, are parsed from attributes stored along with chunks, see Meta.Attrs.
+// Objects are regarded as lost if no chunk reports valid attributes.
+type Reconciler struct {
+	objects    map[string]*reconcilingObject
+	collecting bool
+	log        logger.ILogger
+	mu         sync.Mutex
+}
+
+type reconcilingChunk struct {
+	protocol.ChunkInventory
+	insId uint64
+}
+
+type reconcilingObject struct {
+	key     string
+	version int
+	chunks  map[int]*reconcilingChunk
+}
+
+// attrs returns attributes reported by the latest write of chunks, or nil if no chunk reports valid attributes.
+func (obj *reconcilingObject) attrs() *protocol.ObjectAttrs {
+	var attrs *protocol.ObjectAttrs
+	term := uint64(0)
+	for _, chunk := range obj.chunks {
+		if chunk.Attrs == "" || (attrs != nil && chunk.Term <= term) {
+			continue
+		}
+		if parsed, err := protocol.ParseObjectAttrs(chunk.Attrs); err == nil {
+			attrs, term = parsed, chunk.Term
+		}
+	}
+	return attrs
+}
+
+// NewReconciler creates a reconciler. Instances are requested to report chunks until Rebuild is called.
+func NewReconciler() *Reconciler {
+	return &Reconciler{
+		objects:    make(map[string]*reconcilingObject),
+		collecting: true,
+		log:        global.GetLogger("Reconciler: "),
+	}
+}
+
+// IsCollecting implements lambdastore.InventoryCollector.
+func (r *Reconciler) IsCollecting() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.collecting
+}
+
+// Collect implements lambdastore.InventoryCollector.
+func (r *Reconciler) Collect(ins *lambdastore.Instance, chunks []protocol.ChunkInventory) {
+	r.collect(ins.Id(), chunks)
+}
+
+func (r *Reconciler) collect(insId uint64, chunks []protocol.ChunkInventory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.collecting {
+		return
+	}
+
+	for _, chunk := range chunks {
+		key, ver, chunkId, err := ParseChunkKey(chunk.Key)
+		if err != nil {
+			r.log.Debug("Skip chunk %s reported by %d: %v", chunk.Key, insId, err)
+			continue
+		}
+
+		versioningKey := metaKeyByVersion(key, ver)
+		obj, ok := r.objects[versioningKey]
+		if !ok {
+			obj = &reconcilingObject{key: key, version: ver, chunks: make(map[int]*reconcilingChunk)}
+			r.objects[versioningKey] = obj
+		}
+		// Stale copies may be left on instances chunks were relocated from, prefer the latest write.
+		if reported, ok := obj.chunks[chunkId]; ok && reported.Term >= chunk.Term {
+			continue
+		}
+		obj.chunks[chunkId] = &reconcilingChunk{ChunkInventory: chunk, insId: insId}
+	}
+}
+
+// Rebuild stops collecting and returns metas rebuilt in the order of keys and versions, and the number of objects lost.
+// Objects without attributes reported or with fewer chunks than data chunks are lost, and their metas are deleted, so
+// versions will not be reused.
+func (r *Reconciler) Rebuild() ([]*Meta, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.collecting = false
+	objects := make([]*reconcilingObject, 0, len(r.objects))
+	for _, obj := range r.objects {
+		objects = append(objects, obj)
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		if objects[i].key != objects[j].key {
+			return objects[i].key < objects[j].key
+		}
+		return objects[i].version < objects[j].version
+	})
+
+	metas := make([]*Meta, len(objects))
+	lost := 0
+	for i, obj := range objects {
+		var err error
+		metas[i], err = r.rebuild(obj)
+		if i > 0 && objects[i-1].key == obj.key {
+			metas[i].lastVersion = objects[i-1].version
+		}
+		if err != nil {
+			lost++
+			r.log.Warn("Lost %s: %v", metas[i].VersioningKey(), err)
+		}
+	}
+	r.objects = nil
+	return metas, lost
+}
+
+// rebuild returns the meta rebuilt, which is deleted if the object is lost, and the reason why the object is lost.
+func (r *Reconciler) rebuild(obj *reconcilingObject) (*Meta, error) {
+	meta := newEmptyMeta()
+	meta.key = obj.key
+	meta.rawKey = strings.ReplaceAll(obj.key, replacerDelimiter, "@")
+	meta.version = obj.version
+	meta.versionTs = time.Now().Unix()
+	meta.flags = MetaFlagValid | MetaFlagCreated
+
+	attrs := obj.attrs()
+	if attrs == nil {
+		meta.flags |= MetaFlagDeleted | MetaFlagRemoved
+		return meta, ErrObjectAttrsMissing
+	}
+	meta.Size = attrs.Size
+	meta.DChunks = attrs.DChunks
+	meta.PChunks = attrs.PChunks
+	meta.Class = attrs.Class
+	meta.Replicated = attrs.Replicated
+	meta.NumFrags = attrs.NumFrags
+	meta.Codec = attrs.Codec
+	meta.ClientFlags = attrs.ClientFlags
+	meta.expireAt = attrs.ExpireAt
+	meta.Placement = initPlacement(meta.Placement, meta.NumChunks())
+	meta.Checksums = initPlacement(meta.Checksums, meta.NumChunks())
+	reported := 0
+	for i := range meta.Placement {
+		chunk, ok := obj.chunks[i]
+		if !ok {
+			meta.Placement[i] = InvalidPlacement
+			continue
+		}
+		reported++
+		meta.Placement[i] = chunk.insId
+		meta.Checksums[i] = chunk.Checksum
+		if int64(chunk.Size) > meta.ChunkSize {
+			meta.ChunkSize = int64(chunk.Size)
+		}
+	}
+	if reported < meta.DChunks {
+		meta.flags |= MetaFlagDeleted | MetaFlagRemoved
+		return meta, fmt.Errorf("%d of %d chunks reported, %d required", reported, meta.NumChunks(), meta.DChunks)
+	}
+	return meta, nil
+}
@@ -0,0 +1,100 @@
+package metastore
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	protocol "github.com/sionreview/sion/common/types"
+)
+
+var _ = Describe("Reconciler", func() {
+	chunkKey := func(chunkId int, key string, ver int) string {
+		meta := &Meta{key: santicizeKey(key), version: ver}
+		return meta.ChunkKey(chunkId)
+	}
+
+	It("should rebuild metas from chunks reported", func() {
+		objAttrs := protocol.FormatObjectAttrs(&protocol.ObjectAttrs{Size: 15, DChunks: 2, PChunks: 1, Codec: "flate:30", ClientFlags: 7})
+		hotAttrs := protocol.FormatObjectAttrs(&protocol.ObjectAttrs{Size: 5, DChunks: 1, PChunks: 1, Class: "hot", Replicated: true})
+		reconciler := NewReconciler()
+		Expect(reconciler.IsCollecting()).To(BeTrue())
+
+		reconciler.collect(1, []protocol.ChunkInventory{
+			{Key: chunkKey(0, "obj@1", 2), Size: 10, Term: 1, Checksum: 100, Attrs: objAttrs},
+			{Key: chunkKey(0, "hot", 1), Size: 5, Term: 1, Attrs: hotAttrs},
+			{Key: chunkKey(0, "unknown", 1), Size: 10, Term: 1},
+			{Key: "invalid", Size: 10, Term: 1},
+		})
+		reconciler.collect(2, []protocol.ChunkInventory{
+			{Key: chunkKey(2, "obj@1", 2), Size: 10, Term: 1, Attrs: objAttrs},
+			{Key: chunkKey(1, "hot", 1), Size: 5, Term: 1, Attrs: hotAttrs},
+			{Key: chunkKey(2, "lost", 1), Size: 10, Term: 1, Attrs: objAttrs},
+			{Key: chunkKey(1, "unknown", 1), Size: 10, Term: 1, Attrs: "invalid"},
+		})
+		// Stale copy.
+		reconciler.collect(3, []protocol.ChunkInventory{
+			{Key: chunkKey(0, "obj@1", 2), Size: 10, Term: 0},
+		})
+
+		metas, lost := reconciler.Rebuild()
+		Expect(reconciler.IsCollecting()).To(BeFalse())
+		Expect(metas).To(HaveLen(4))
+		Expect(lost).To(Equal(2))
+
+		hot := metas[0]
+		Expect(hot.RawKey()).To(Equal("hot"))
+		Expect(hot.Class).To(Equal("hot"))
+		Expect(hot.Replicated).To(BeTrue())
+		Expect(hot.Placement).To(Equal(Placement{1, 2}))
+		Expect(hot.Size).To(Equal(int64(5)))
+
+		Expect(metas[1].RawKey()).To(Equal("lost"))
+		Expect(metas[1].IsDeleted()).To(BeTrue())
+
+		obj := metas[2]
+		Expect(obj.RawKey()).To(Equal("obj@1"))
+		Expect(obj.Version()).To(Equal(2))
+		Expect(obj.DChunks).To(Equal(2))
+		Expect(obj.PChunks).To(Equal(1))
+		Expect(obj.Placement).To(Equal(Placement{1, InvalidPlacement, 2}))
+		Expect(obj.Checksum(0)).To(Equal(uint64(100)))
+		Expect(obj.Size).To(Equal(int64(15)))
+		Expect(obj.Codec).To(Equal("flate:30"))
+		Expect(obj.ClientFlags).To(Equal(uint32(7)))
+
+		// Objects without attributes are lost.
+		Expect(metas[3].RawKey()).To(Equal("unknown"))
+		Expect(metas[3].IsDeleted()).To(BeTrue())
+
+		// Chunks reported after rebuilding are ignored.
+		reconciler.collect(1, []protocol.ChunkInventory{{Key: chunkKey(0, "late", 1), Size: 10, Attrs: objAttrs}})
+		metas, _ = reconciler.Rebuild()
+		Expect(metas).To(BeEmpty())
+	})
+
+	It("should insert metas rebuilt except versions known", func() {
+		store := New()
+		known, _, _ := store.GetOrInsert("known", NewMeta("req1", "known", 10, 1, 0, 10))
+		known.ConfirmCreated()
+
+		attrs := protocol.FormatObjectAttrs(&protocol.ObjectAttrs{Size: 10, DChunks: 1})
+		reconciler := NewReconciler()
+		reconciler.collect(1, []protocol.ChunkInventory{
+			{Key: known.ChunkKey(0), Size: 10, Term: 1, Attrs: attrs},
+			{Key: chunkKey(0, "known", 2), Size: 10, Term: 2, Attrs: attrs},
+			{Key: chunkKey(0, "rebuilt", 1), Size: 10, Term: 1, Attrs: attrs},
+		})
+		metas, _ := reconciler.Rebuild()
+
+		restored := 0
+		Expect(store.Reconcile(metas, func(*Meta) { restored++ })).To(Equal(2))
+		Expect(restored).To(Equal(2))
+
+		meta, ok := store.Get("known")
+		Expect(ok).To(BeTrue())
+		Expect(meta.Version()).To(Equal(2))
+		Expect(meta.PreviousVersion()).To(Equal(1))
+		_, ok = store.Get("rebuilt")
+		Expect(ok).To(BeTrue())
+	})
+})
@@ -0,0 +1,269 @@
+package metastore
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	kbinary "github.com/kelindar/binary"
+	"github.com/sionreview/sion/common/logger"
+	"github.com/sionreview/sion/proxy/config"
+	"github.com/sionreview/sion/proxy/global"
+)
+
+const (
+	// journalReplicaQueueSize Changes queued for each standby proxy. Standby proxies falling further behind are dropped.
+	journalReplicaQueueSize = 1024
+)
+
+var (
+	ErrNotPersisted  = errors.New("metastore is not persisted")
+	ErrStandbyClosed = errors.New("standby closed")
+)
+
+// journalReplica A standby proxy that changes of the journal are streamed to. Changes are queued and streamed by a
+// goroutine of the replica, so the journal will not be blocked by the network. Writes time out if the standby stalls.
+type journalReplica struct {
+	conn   net.Conn
+	writer *bufio.Writer
+	queue  chan []byte // Payloads of changes, nil for heartbeats. Closed on the replica dropped or the journal closed.
+}
+
+func newJournalReplica(conn net.Conn) *journalReplica {
+	replica := &journalReplica{
+		conn:  conn,
+		queue: make(chan []byte, journalReplicaQueueSize),
+	}
+	replica.writer = bufio.NewWriter(replica)
+	return replica
+}
+
+func (r *journalReplica) Write(p []byte) (int, error) {
+	r.conn.SetWriteDeadline(time.Now().Add(config.MetaStoreFailoverTimeout))
+	return r.conn.Write(p)
+}
+
+// stream writes changes queued to the standby until the queue is closed or writing fails.
+func (r *journalReplica) stream(j *Journal) {
+	defer r.conn.Close()
+
+	for payload := range r.queue {
+		err := writeFrame(r.writer, payload)
+		if err == nil && len(r.queue) == 0 {
+			err = r.writer.Flush()
+		}
+		if err != nil {
+			j.log.Warn("Stop replicating to %s: %v", r.conn.RemoteAddr(), err)
+			j.dropReplica(r)
+			return
+		}
+	}
+}
+
+// Replicate streams metas provided by the range to the standby as a snapshot, followed by changes logged thereafter
+// until the standby fails. Records are streamed in the format of the log. Heartbeats are streamed as empty records,
+// the first of which concludes the snapshot. Like Snapshot, the range is iterated without locking the journal, and
+// changes logged during streaming the snapshot are queued and streamed after the snapshot.
+func (j *Journal) Replicate(conn net.Conn, metas MetaRange) (int, error) {
+	j.mu.Lock()
+	if j.writer == nil {
+		j.mu.Unlock()
+		conn.Close()
+		return 0, ErrJournalClosed
+	}
+	replica := newJournalReplica(conn)
+	j.replicas = append(j.replicas, replica)
+	j.mu.Unlock()
+
+	written, err := writeMetas(replica.writer, metas)
+	if err == nil {
+		err = writeFrame(replica.writer, nil)
+	}
+	if err == nil {
+		err = replica.writer.Flush()
+	}
+	if err != nil {
+		j.dropReplica(replica)
+		conn.Close() // In case the journal has been closed.
+		return written, err
+	}
+	go replica.stream(j)
+	return written, nil
+}
+
+// Heartbeat streams a heartbeat to standby proxies, so they can tell the primary is alive.
+func (j *Journal) Heartbeat() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.replicateLocked(nil)
+}
+
+// replicateLocked queues the payload of a record to standby proxies. Standby proxies with the queue full are dropped.
+func (j *Journal) replicateLocked(payload []byte) {
+	for i := 0; i < len(j.replicas); {
+		replica := j.replicas[i]
+		select {
+		case replica.queue <- payload:
+			i++
+		default:
+			j.log.Warn("Stop replicating to %s: %d changes behind", replica.conn.RemoteAddr(), len(replica.queue))
+			j.removeReplicaLocked(i)
+		}
+	}
+}
+
+// dropReplica stops streaming to the standby and disconnects it.
+func (j *Journal) dropReplica(replica *journalReplica) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for i, r := range j.replicas {
+		if r == replica {
+			j.removeReplicaLocked(i)
+			return
+		}
+	}
+}
+
+func (j *Journal) removeReplicaLocked(i int) {
+	replica := j.replicas[i]
+	close(replica.queue)
+	replica.conn.Close()
+	last := len(j.replicas) - 1
+	j.replicas[i] = j.replicas[last]
+	j.replicas[last] = nil
+	j.replicas = j.replicas[:last]
+}
+
+// Standby Follows the metastore replicated from the primary proxy, see Journal.Replicate. Once the primary is lost,
+// replicated metas are persisted under the directory of the metastore, so the standby can take over by recovering the
+// metastore as on restarting. Changes not yet confirmed, e.g. objects being created, are not replicated.
+type Standby struct {
+	primary string
+	dir     string
+	records *recordSet // Metas synced from the primary, nil if never synced.
+	conn    net.Conn
+	closed  chan struct{}
+	log     logger.ILogger
+	mu      sync.Mutex
+}
+
+// NewStandby creates a standby of the primary, replicated metas will be persisted under specified directory.
+func NewStandby(primary string, dir string) *Standby {
+	return &Standby{
+		primary: primary,
+		dir:     dir,
+		closed:  make(chan struct{}),
+		log:     global.GetLogger("Standby: "),
+	}
+}
+
+// Wait follows the primary until the primary is lost, and returns the number of metas persisted. The standby keeps
+// waiting if the primary has never been synced. A lost connection is retried once before the primary is considered lost.
+func (s *Standby) Wait() (int, error) {
+	for {
+		connected, err := s.follow()
+		if s.isClosed() {
+			return 0, ErrStandbyClosed
+		}
+
+		switch {
+		case s.records == nil:
+			s.log.Debug("Waiting for primary %s: %v", s.primary, err)
+			select {
+			case <-s.closed:
+				return 0, ErrStandbyClosed
+			case <-time.After(config.MetaStoreHeartbeatInterval):
+			}
+		case connected:
+			s.log.Warn("Disconnected from primary %s: %v, reconnecting...", s.primary, err)
+		default:
+			s.log.Warn("Primary %s lost: %v", s.primary, err)
+			return s.persist()
+		}
+	}
+}
+
+// Close stops waiting for the primary.
+func (s *Standby) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.closed:
+		return
+	default:
+		close(s.closed)
+	}
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
+
+// follow connects to the primary and applies records until the connection fails or the primary is silent for
+// MetaStoreFailoverTimeout. Returns false if the primary is not connected.
+func (s *Standby) follow() (bool, error) {
+	conn, err := net.DialTimeout("tcp", s.primary, config.MetaStoreFailoverTimeout)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	s.mu.Lock()
+	if s.isClosed() {
+		s.mu.Unlock()
+		return true, ErrStandbyClosed
+	}
+	s.conn = conn
+	s.mu.Unlock()
+
+	reader := bufio.NewReader(conn)
+	records := newRecordSet()
+	for {
+		conn.SetReadDeadline(time.Now().Add(config.MetaStoreFailoverTimeout))
+		size, err := binary.ReadUvarint(reader)
+		if err != nil {
+			return true, err
+		} else if size == 0 {
+			// Heartbeat, the first of which concludes the snapshot.
+			if s.records != records {
+				s.records = records
+				s.log.Info("Synced %d metas from primary %s.", records.Len(), s.primary)
+			}
+			continue
+		}
+
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			return true, err
+		}
+		var record metaRecord
+		if err := kbinary.Unmarshal(payload, &record); err != nil {
+			return true, err
+		}
+		records.add(&record)
+	}
+}
+
+// persist replaces the snapshot of the metastore with metas synced and removes the log.
+func (s *Standby) persist() (int, error) {
+	journal, err := OpenJournal(s.dir)
+	if err != nil {
+		return 0, err
+	}
+	return journal.reset(s.records)
+}
+
+func (s *Standby) isClosed() bool {
+	select {
+	case <-s.closed:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,187 @@
+package metastore
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Standby", func() {
+	It("should take over metas replicated from the primary", func() {
+		primaryDir, err := os.MkdirTemp("", "primary")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(primaryDir)
+		standbyDir, err := os.MkdirTemp("", "standby")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(standbyDir)
+
+		journal, err := OpenJournal(primaryDir)
+		Expect(err).To(BeNil())
+		store := New()
+		_, err = store.Recover(journal, nil)
+		Expect(err).To(BeNil())
+
+		snapshotted, _, _ := store.GetOrInsert("snapshotted", NewMeta("req1", "snapshotted", 10, 1, 0, 10))
+		snapshotted.ConfirmCreated()
+
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).To(BeNil())
+		replicated := make(chan int, 1)
+		go func() {
+			conn, err := lis.Accept()
+			if err == nil {
+				n, _ := store.Replicate(conn, store.Range)
+				replicated <- n
+			}
+		}()
+
+		standby := NewStandby(lis.Addr().String(), standbyDir)
+		persisted := make(chan int, 1)
+		go func() {
+			defer GinkgoRecover()
+
+			n, err := standby.Wait()
+			Expect(err).To(BeNil())
+			persisted <- n
+		}()
+		Eventually(replicated).Should(Receive(Equal(1)))
+
+		// Changes after the snapshot are streamed.
+		logged, _, _ := store.GetOrInsert("logged", NewMeta("req2", "logged", 10, 1, 0, 10))
+		logged.ConfirmCreated()
+		logged.SetPlace(0, 5)
+		store.Delete("snapshotted")
+		journal.Heartbeat()
+
+		// Primary lost.
+		lis.Close()
+		journal.Close()
+		Eventually(persisted, "10s").Should(Receive(Equal(2)))
+
+		journal, err = OpenJournal(standbyDir)
+		Expect(err).To(BeNil())
+		defer journal.Close()
+		recovered := New()
+		restored, err := recovered.Recover(journal, nil)
+		Expect(err).To(BeNil())
+		Expect(restored).To(Equal(2))
+
+		meta, ok := recovered.Get("logged")
+		Expect(ok).To(BeTrue())
+		Expect(meta.GetPlace(0)).To(Equal(uint64(5)))
+		_, ok = recovered.Get("snapshotted")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should keep waiting if the primary has never been synced", func() {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).To(BeNil())
+		addr := lis.Addr().String()
+		lis.Close()
+
+		standby := NewStandby(addr, "")
+		stopped := make(chan error, 1)
+		go func() {
+			_, err := standby.Wait()
+			stopped <- err
+		}()
+		Consistently(stopped, "100ms").ShouldNot(Receive())
+		standby.Close()
+		Eventually(stopped, "5s").Should(Receive(Equal(ErrStandbyClosed)))
+	})
+})
+
+var _ = Describe("Replication", func() {
+	var dir string
+	var journal *Journal
+	var store *MetaStore
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "replication")
+		Expect(err).To(BeNil())
+		journal, err = OpenJournal(dir)
+		Expect(err).To(BeNil())
+		store = New()
+		_, err = store.Recover(journal, nil)
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		journal.Close()
+		os.RemoveAll(dir)
+	})
+
+	// readSnapshot reads records until the first heartbeat.
+	readSnapshot := func(reader *bufio.Reader) int {
+		records := 0
+		for {
+			size, err := binary.ReadUvarint(reader)
+			Expect(err).To(BeNil())
+			if size == 0 {
+				return records
+			}
+			_, err = io.CopyN(io.Discard, reader, int64(size))
+			Expect(err).To(BeNil())
+			records++
+		}
+	}
+
+	It("should log changes while the snapshot is streamed", func() {
+		meta, _, _ := store.GetOrInsert("key", NewMeta("req", "key", 10, 1, 0, 10))
+		meta.ConfirmCreated()
+
+		primary, standby := net.Pipe()
+		defer standby.Close()
+		go readSnapshot(bufio.NewReader(standby))
+
+		// Owners of metas log changes while holding their locks during the range.
+		replicated, err := journal.Replicate(primary, func(cb func(*Meta) bool) {
+			logged := make(chan error, 1)
+			go func() {
+				logged <- journal.Append(meta)
+			}()
+			Eventually(logged).Should(Receive(BeNil()))
+			store.Range(cb)
+		})
+		Expect(err).To(BeNil())
+		Expect(replicated).To(Equal(1))
+	})
+
+	It("should drop standby proxies falling behind", func() {
+		meta, _, _ := store.GetOrInsert("key", NewMeta("req", "key", 10, 1, 0, 10))
+		meta.ConfirmCreated()
+
+		primary, standby := net.Pipe()
+		defer standby.Close()
+		synced := make(chan int, 1)
+		go func() {
+			synced <- readSnapshot(bufio.NewReader(standby))
+		}()
+		_, err := journal.Replicate(primary, store.Range)
+		Expect(err).To(BeNil())
+		Eventually(synced).Should(Receive(Equal(1)))
+
+		// The standby stops reading, changes are logged without blocking.
+		logged := make(chan error, 1)
+		go func() {
+			for i := 0; i < journalReplicaQueueSize*2; i++ {
+				if err := journal.Append(meta); err != nil {
+					logged <- err
+					return
+				}
+			}
+			logged <- nil
+		}()
+		Eventually(logged, "10s").Should(Receive(BeNil()))
+
+		journal.mu.Lock()
+		defer journal.mu.Unlock()
+		Expect(journal.replicas).To(BeEmpty())
+	})
+})
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"path"
 	"strconv"
 	"sync"
 	"sync/atomic"
@@ -22,20 +23,36 @@ import (
 	"github.com/sionreview/sion/proxy/config"
 	"github.com/sionreview/sion/proxy/global"
 	"github.com/sionreview/sion/proxy/lambdastore"
+	"github.com/sionreview/sion/proxy/metrics"
 	"github.com/sionreview/sion/proxy/server/cluster"
 	"github.com/sionreview/sion/proxy/server/metastore"
 	"github.com/sionreview/sion/proxy/types"
 )
 
+const (
+	// Number of arguments of "set chunk" without optional ones: seq, key, reqId, size, chunkId, dChunks, pChunks, lambdaId, randBase, and the body.
+	// Optional arguments are positional: [version [ttl [checksum [class [replicated [codec [flags]]]]]]].
+	numSetChunkArgs = 10
+
+	// PersistCacheDir is the directory under the base path to store the persist cache.
+	PersistCacheDir = "persist"
+)
+
 type Proxy struct {
 	log               logger.ILogger
 	cluster           cluster.Cluster
 	placer            metastore.Placer
+	store             *metastore.MetaStore
 	port              int // Starting listen port
 	ports             int // Number of ports to listen
 	listeners         []net.Listener
 	roundRobinCounter uint64
 	cache             types.PersistCache
+	journal           *metastore.Journal
+	replication       net.Listener // Listener of standby proxies, see ServeReplication.
+	reconciler        *metastore.Reconciler
+	reconciled        chan struct{} // Closed once metas are rebuilt, nil if not reconciling.
+	closed            chan struct{}
 
 	initListeners sync.WaitGroup
 	done          sync.WaitGroup
@@ -48,6 +65,7 @@ func New() *Proxy {
 		port:      global.BasePort + 1,
 		ports:     global.LambdaServePorts,
 		listeners: make([]net.Listener, global.LambdaServePorts),
+		closed:    make(chan struct{}),
 	}
 
 	p.Serve()
@@ -60,15 +78,32 @@ func New() *Proxy {
 		p.cluster = cluster.NewMovingWindow(p)
 	}
 	p.placer = p.cluster.GetPlacer()
+	p.store = p.placer.Store()
 
 	// Enable persist cache.
 	if global.IsLocalCacheEnabled() {
-		p.cache = cache.NewPersistCache()
+		if global.Options.PersistCache > 0 {
+			dir := path.Join(global.Options.LogPath, PersistCacheDir)
+			persistCache, err := cache.NewPersistCacheWithStorage(dir, int64(global.Options.PersistCache)*1000000)
+			if err != nil {
+				p.log.Error("Failed to open persist cache at %s: %v, chunks will be cached in memory only.", dir, err)
+			} else {
+				p.cache = persistCache
+			}
+		}
+		if p.cache == nil {
+			p.cache = cache.NewPersistCache()
+		}
 		p.placer.RegisterHandler(metastore.PlacerEventBeforePlacing, p.beforePlacingHandler)
 	}
 
 	// Set CM before starting the cluster.
 	lambdastore.CM = p.cluster
+	if global.Options.Reconcile {
+		p.reconciler = metastore.NewReconciler()
+		p.reconciled = make(chan struct{})
+		lambdastore.Inventories = p.reconciler
+	}
 
 	// first group init
 	err := p.cluster.Start()
@@ -76,6 +111,23 @@ func New() *Proxy {
 		p.log.Error("Failed to start cluster: %v", err)
 	}
 
+	// Restore metas. Chunks on instances that are not available after restarting will be relocated on requesting.
+	if global.Options.MetaStore != "" {
+		p.recoverMetaStore(global.Options.MetaStore)
+	}
+
+	// Restore chunks not yet persisted to COS. Metas must be restored first.
+	if p.cache != nil && global.Options.PersistCache > 0 {
+		p.restorePersistCache()
+	}
+
+	// Rebuild metas from chunks reported by instances. Metas restored are kept.
+	if p.reconciler != nil {
+		go p.reconcile()
+	}
+
+	go p.scheduleExpiration()
+
 	return p
 }
 
@@ -147,6 +199,11 @@ func (p *Proxy) PersistCacheLen() int {
 	return p.cache.Len()
 }
 
+// GetMeta returns the meta of the latest version of the object without touching it.
+func (p *Proxy) GetMeta(key string) (*metastore.Meta, bool) {
+	return p.store.Get(key)
+}
+
 func (p *Proxy) WaitReady() {
 	p.cluster.WaitReady()
 	p.log.Info("[Proxy is ready]")
@@ -159,12 +216,24 @@ func (p *Proxy) Close() {
 			p.listeners[i] = nil
 		}
 	}
+	if p.replication != nil {
+		p.replication.Close()
+	}
+	select {
+	case <-p.closed:
+	default:
+		close(p.closed)
+	}
 }
 
 func (p *Proxy) Release() {
 	if p.cache != nil {
 		p.cache.Report()
 	}
+	if p.journal != nil {
+		p.snapshotMetaStore()
+		p.journal.Close()
+	}
 	p.cluster.Close()
 	cluster.CleanUpPool()
 }
@@ -177,13 +246,52 @@ func (p *Proxy) HandleSetChunk(w resp.ResponseWriter, c *resp.CommandStream) {
 	seq, _ := c.NextArg().Int()
 	key, _ := c.NextArg().String()
 	reqId, _ := c.NextArg().String()
-	size, _ := c.NextArg().Int()
+	rawSize, _ := c.NextArg().String()
+	size, numFrags, _ := protocol.ParseObjectSize(rawSize)
 	dChunkId, _ := c.NextArg().Int()
 	chunkId := strconv.FormatInt(dChunkId, 10)
 	dataChunks, _ := c.NextArg().Int()
 	parityChunks, _ := c.NextArg().Int()
 	lambdaId, _ := c.NextArg().Int()
 	randBase, _ := c.NextArg().Int()
+	expectedVersion := int64(metastore.AnyVersion)
+	if c.ArgN() > numSetChunkArgs {
+		// Optional: the expected version for conditional setting.
+		expectedVersion, _ = c.NextArg().Int()
+	}
+	ttl := int64(0)
+	if c.ArgN() > numSetChunkArgs+1 {
+		// Optional: the time to live in milliseconds.
+		ttl, _ = c.NextArg().Int()
+	}
+	checksum := uint64(0)
+	if c.ArgN() > numSetChunkArgs+2 {
+		// Optional: the checksum of the chunk.
+		strChecksum, _ := c.NextArg().String()
+		checksum, _ = strconv.ParseUint(strChecksum, 10, 64)
+	}
+	className := ""
+	if c.ArgN() > numSetChunkArgs+3 {
+		// Optional: the name of the storage class, empty for the default.
+		className, _ = c.NextArg().String()
+	}
+	replicated := false
+	if c.ArgN() > numSetChunkArgs+4 {
+		// Optional: chunks are full replicas of a small object, dChunks must be 1.
+		strReplicated, _ := c.NextArg().String()
+		replicated, _ = strconv.ParseBool(strReplicated)
+	}
+	codec := ""
+	if c.ArgN() > numSetChunkArgs+5 {
+		// Optional: how the object is compressed in the format "name:size", empty if not compressed.
+		codec, _ = c.NextArg().String()
+	}
+	clientFlags := uint64(0)
+	if c.ArgN() > numSetChunkArgs+6 {
+		// Optional: opaque flags of the object set by the client.
+		strFlags, _ := c.NextArg().String()
+		clientFlags, _ = strconv.ParseUint(strFlags, 10, 32)
+	}
 
 	bodyStream, err := c.Next()
 	if err != nil {
@@ -191,6 +299,21 @@ func (p *Proxy) HandleSetChunk(w resp.ResponseWriter, c *resp.CommandStream) {
 		return
 	}
 
+	if p.isReconciling() {
+		bodyStream.Close() // Ensure client request finished before set response.
+		server.NewErrorResponse(w, seq, "%v", metastore.ErrReconciling).Flush()
+		return
+	}
+
+	// The erasure coding of the storage class must match the chunk. Replicas of small objects tolerate the same number of
+	// losses as erasure coded objects.
+	class, ok := global.StorageClasses[className]
+	if className != "" && (!ok || class.ParityShards != int(parityChunks) || (!replicated && class.DataShards != int(dataChunks))) {
+		bodyStream.Close() // Ensure client request finished before set response.
+		server.NewErrorResponse(w, seq, "%v %s with d=%d,p=%d", protocol.ErrUnknownStorageClass, className, dataChunks, parityChunks).Flush()
+		return
+	}
+
 	p.log.Debug("HandleSet %s(%d): %d@%s", reqId, dChunkId, dChunkId, key)
 
 	// Start counting time.
@@ -199,6 +322,14 @@ func (p *Proxy) HandleSetChunk(w resp.ResponseWriter, c *resp.CommandStream) {
 	prepared := p.placer.NewMeta(reqId,
 		key, size, int(dataChunks), int(parityChunks), int(dChunkId), int64(bodyStream.Len()), uint64(lambdaId), int(randBase))
 	prepared.SetTimout(protocol.GetBodyTimeout(bodyStream.Len())) // Set timeout for the operation to be considered as failed.
+	prepared.ExpectVersion(int(expectedVersion))
+	prepared.SetTTL(time.Duration(ttl) * time.Millisecond)
+	prepared.SetChecksum(int(dChunkId), checksum)
+	prepared.Class = className
+	prepared.Replicated = replicated
+	prepared.NumFrags = numFrags
+	prepared.Codec = codec
+	prepared.ClientFlags = uint32(clientFlags)
 	// Added by Tianium: 20221102
 	// We need the counter to figure out when the object is fully stored.
 	counter := global.ReqCoordinator.Register(reqId, protocol.CMD_SET, prepared.DChunks, prepared.PChunks, nil)
@@ -213,6 +344,9 @@ func (p *Proxy) HandleSetChunk(w resp.ResponseWriter, c *resp.CommandStream) {
 	req.Cmd = protocol.CMD_SET
 	req.BodyStream = bodyStream
 	req.BodyStream.(resp.Holdable).Hold() // Hold to prevent being closed
+	req.Checksum = checksum
+	req.Persistence = global.StorageClasses.Persistence(className)
+	req.Attrs = protocol.FormatObjectAttrs(prepared.Attrs())
 	req.CollectorEntry = collectEntry
 	req.Info = prepared
 	// Added by Tianium: 20221102
@@ -231,6 +365,7 @@ func (p *Proxy) HandleSetChunk(w resp.ResponseWriter, c *resp.CommandStream) {
 		req.BodyStream.(resp.Holdable).Unhold() // bodyStream now will automatically be closed.
 		req.BodyStream.Close()                  // Ensure client request finished before set response.
 		meta.Wait()
+		req.Info = meta // Respond with the version of the earlier one.
 		if meta.IsValid() {
 			req.SetResponse(req.ToConcurrentSetResponse(meta.Placement[dChunkId]))
 		} else {
@@ -275,12 +410,32 @@ func (p *Proxy) HandleGetChunk(w resp.ResponseWriter, c *resp.Command) {
 	reqId := c.Arg(i.Add1()).String()
 	dChunkId, _ := c.Arg(i.Add1()).Int()
 	chunkId := strconv.FormatInt(dChunkId, 10)
+	version := int64(0)
+	if c.ArgN() > i.Add1() {
+		// Optional: the version to get, 0 for the latest.
+		version, _ = c.Arg(i.Int()).Int()
+	}
+	var offset, length, frag int64
+	ranged := c.ArgN() > i.Add1()+2
+	if ranged {
+		// Optional: the range to read in the format "offset length fragment", only data chunks covering the range in the
+		// fragment are served.
+		offset, _ = c.Arg(i.Int()).Int()
+		length, _ = c.Arg(i.Add1()).Int()
+		frag, _ = c.Arg(i.Add1()).Int()
+	}
 
 	// Start couting time.
 	collectorEntry, _ := collector.CollectRequest(collector.LogRequestStart, nil, protocol.CMD_GET, reqId, chunkId, time.Now().UnixNano())
 
 	// key is "key"+"chunkId"
-	meta, ok := p.placer.Get(key, int(dChunkId))
+	var meta *metastore.Meta
+	var ok bool
+	if version > 0 {
+		meta, ok = p.placer.GetByVersion(key, int(version), int(dChunkId))
+	} else {
+		meta, ok = p.placer.Get(key, int(dChunkId))
+	}
 	if !ok {
 		p.log.Warn("KEY %s@%s not found", chunkId, key)
 		server.NewNilResponse(w, seq).Flush()
@@ -288,13 +443,25 @@ func (p *Proxy) HandleGetChunk(w resp.ResponseWriter, c *resp.Command) {
 	}
 
 	// Validate the version of meta matches.
-	counter := global.ReqCoordinator.Register(reqId, protocol.CMD_GET, meta.DChunks, meta.PChunks, meta)
+	var counter *global.RequestCounter
+	if ranged {
+		span := protocol.LocateRange(meta.Size, meta.NumFrags, int(frag), meta.DChunks, offset, length)
+		if !span.Contains(int(dChunkId)) {
+			// Skip the chunk with meta returned, so the client can locate the range in other fragments.
+			p.skipChunk(w, seq, reqId, meta)
+			return
+		}
+		counter = global.ReqCoordinator.RegisterRequests(reqId, protocol.CMD_GET, meta.DChunks, meta.PChunks, span.Len(), meta)
+	} else {
+		counter = global.ReqCoordinator.Register(reqId, protocol.CMD_GET, meta.DChunks, meta.PChunks, meta)
+	}
 	if counter.Meta.(*metastore.Meta).Version() != meta.Version() {
 		meta = counter.Meta.(*metastore.Meta)
 	}
 
 	// Validate if the chunk id is still valid for the returned meta.
 	if dChunkId >= int64(meta.NumChunks()) {
+		counter.Close()
 		server.NewNilResponse(w, seq).Flush()
 		return
 	}
@@ -309,6 +476,8 @@ func (p *Proxy) HandleGetChunk(w resp.ResponseWriter, c *resp.Command) {
 	req.Cmd = protocol.CMD_GET
 	req.BodySize = meta.ChunkSize
 	req.Key = chunkKey
+	req.Checksum = meta.Checksum(int(dChunkId))
+	req.Attrs = protocol.FormatObjectAttrs(meta.Attrs())
 	req.CollectorEntry = collectorEntry
 	req.Info = meta
 	req.RequestGroup = counter
@@ -381,6 +550,94 @@ func (p *Proxy) HandleGetChunk(w resp.ResponseWriter, c *resp.Command) {
 	}
 }
 
+// skipChunk responds the chunk not requested with the meta of the object.
+func (p *Proxy) skipChunk(w resp.ResponseWriter, seq int64, reqId string, meta *metastore.Meta) {
+	rsp := types.NewResponse(protocol.CMD_GET)
+	rsp.Id.ReqId = reqId
+	rsp.Size = meta.RawSize()
+	rsp.Version = strconv.Itoa(meta.Version())
+	rsp.Checksum = "0"
+	rsp.Shards = meta.Layout()
+	rsp.Codec = meta.Codec
+	rsp.ClientFlags = strconv.FormatUint(uint64(meta.ClientFlags), 10)
+	rsp.PrepareForGet(w, seq)
+	if err := w.Flush(); err != nil {
+		p.log.Warn("Failed to skip chunk of %s: %v", reqId, err)
+	}
+}
+
+// HandleDelChunk is the handler for "del chunk".
+// Unlike "set chunk" and "get chunk", a single request removes all chunks of the object.
+func (p *Proxy) HandleDelChunk(w resp.ResponseWriter, c *resp.Command) {
+	var i util.Int
+	seq, _ := c.Arg(i.Int()).Int()
+	key := c.Arg(i.Add1()).String()
+	reqId := c.Arg(i.Add1()).String()
+
+	if p.isReconciling() {
+		server.NewErrorResponse(w, seq, "%v", metastore.ErrReconciling).Flush()
+		return
+	}
+
+	// Mark the latest version removed, so following GETs will get not found.
+	meta, ok := p.placer.Delete(key)
+	if !ok {
+		p.log.Debug("KEY %s not found on deleting", key)
+		server.NewNilResponse(w, seq).Flush()
+		return
+	}
+
+	p.log.Debug("HandleDel %s: %s(v%d)", reqId, key, meta.Version())
+
+	// Chunks are deleted asynchronously, the lambda side lineage will record the deletion.
+	p.dropChunks(meta, reqId)
+
+	w.AppendInt(seq)
+	w.AppendBulkString(reqId)
+	w.AppendBulkString(strconv.Itoa(meta.Version()))
+	if err := w.Flush(); err != nil {
+		p.log.Warn("Error on flush del response %s: %v", reqId, err)
+	}
+}
+
+// HandleScanKeys lists keys of the objects stored on the proxy, starting from the cursor. Each key is followed by the
+// size of the object and the unix time the object was set.
+func (p *Proxy) HandleScanKeys(w resp.ResponseWriter, c *resp.Command) {
+	var i util.Int
+	seq, _ := c.Arg(i.Int()).Int()
+	reqId := c.Arg(i.Add1()).String()
+	cursor, err := strconv.ParseUint(c.Arg(i.Add1()).String(), 10, 64)
+	if err != nil {
+		server.NewErrorResponse(w, seq, "invalid cursor: %v", err).Flush()
+		return
+	}
+	count, _ := c.Arg(i.Add1()).Int()
+
+	var match func(string) bool
+	if c.ArgN() > i.Add1() {
+		pattern := c.Arg(i.Int()).String()
+		match = func(key string) bool {
+			return util.MatchPattern(pattern, key)
+		}
+	}
+
+	metas, next := p.placer.Scan(cursor, int(count), match)
+	p.log.Debug("HandleScanKeys %s: %d keys scanned from %d, next %d", reqId, len(metas), cursor, next)
+
+	w.AppendInt(seq)
+	w.AppendBulkString(reqId)
+	w.AppendBulkString(strconv.FormatUint(next, 10))
+	w.AppendArrayLen(len(metas) * 3)
+	for _, meta := range metas {
+		w.AppendBulkString(meta.RawKey())
+		w.AppendBulkString(strconv.FormatInt(meta.OriginalSize(), 10))
+		w.AppendBulkString(strconv.FormatInt(meta.VersionTime().Unix(), 10))
+	}
+	if err := w.Flush(); err != nil {
+		p.log.Warn("Error on flush scan response %s: %v", reqId, err)
+	}
+}
+
 // HandleCallback callback handler
 func (p *Proxy) HandleCallback(w resp.ResponseWriter, r interface{}) {
 	wrapper := r.(types.ProxyResponse)
@@ -393,11 +650,18 @@ func (p *Proxy) HandleCallback(w resp.ResponseWriter, r interface{}) {
 		case protocol.CMD_RECOVER:
 			// on GET request from reclaimed instances, it will get recovered from new instances,
 			// the response of this cmd_recover's behavior is the same as cmd_get
+			metrics.Recoveries.Inc()
 			fallthrough
 		case protocol.CMD_GET:
-			rsp.Size = strconv.FormatInt(wrapper.Request().Info.(*metastore.Meta).Size, 10)
+			rsp.Size = wrapper.Request().Info.(*metastore.Meta).RawSize()
+			rsp.Version = strconv.Itoa(wrapper.Request().Info.(*metastore.Meta).Version())
+			rsp.Checksum = strconv.FormatUint(wrapper.Request().Info.(*metastore.Meta).Checksum(wrapper.Request().Id.Chunk()), 10)
+			rsp.Shards = wrapper.Request().Info.(*metastore.Meta).Layout()
+			rsp.Codec = wrapper.Request().Info.(*metastore.Meta).Codec
+			rsp.ClientFlags = strconv.FormatUint(uint64(wrapper.Request().Info.(*metastore.Meta).ClientFlags), 10)
 			rsp.PrepareForGet(w, wrapper.Request().Seq)
 		case protocol.CMD_SET:
+			rsp.Version = strconv.Itoa(wrapper.Request().Info.(*metastore.Meta).Version())
 			rsp.PrepareForSet(w, wrapper.Request().Seq)
 			// Added by Tianium 20221102
 			// Confirm the meta
@@ -438,7 +702,9 @@ func (p *Proxy) HandleCallback(w resp.ResponseWriter, r interface{}) {
 		}
 
 		// Async logic
-		if wrapper.Request().Cmd == protocol.CMD_GET {
+		// Chunks of storage classes without COS can not be recovered from COS.
+		if wrapper.Request().Cmd == protocol.CMD_GET &&
+			global.StorageClasses.Persistence(wrapper.Request().Info.(*metastore.Meta).Class).IsCOSEnabled() {
 			// Build control command
 			recoverReqId := uuid.New().String()
 			control := &types.Control{
@@ -450,6 +716,8 @@ func (p *Proxy) HandleCallback(w resp.ResponseWriter, r interface{}) {
 					RetCommand: protocol.CMD_RECOVER,
 					BodySize:   wrapper.Request().BodySize,
 					Key:        wrapper.Request().Key,
+					Checksum:   wrapper.Request().Checksum,
+					Attrs:      wrapper.Request().Attrs,
 					Info:       wrapper.Request().Info,
 					Changes:    types.CHANGE_PLACEMENT,
 				},
@@ -462,6 +730,7 @@ func (p *Proxy) HandleCallback(w resp.ResponseWriter, r interface{}) {
 			} else if err != nil {
 				p.log.Debug("Relocation triggered. Failed to relocate %s(%d): %v", wrapper.Request().Key, p.getPlacementFromRequest(wrapper.Request()), err)
 			} else {
+				metrics.Relocations.Inc()
 				p.log.Debug("Relocation triggered. Relocating %s(%d) to %d", wrapper.Request().Key, p.getPlacementFromRequest(wrapper.Request()), instance.Id())
 			}
 		}
@@ -487,9 +756,15 @@ func (p *Proxy) CollectData() {
 }
 
 func (p *Proxy) dropEvicted(meta *metastore.Meta) {
-	reqId := uuid.New().String()
+	p.dropChunks(meta, uuid.New().String())
+	p.log.Warn("Evict %s", meta.Key)
+}
+
+func (p *Proxy) dropChunks(meta *metastore.Meta, reqId string) {
 	for i, lambdaId := range meta.Placement {
-		if instance := p.cluster.Instance(uint64(lambdaId)); instance != nil {
+		if lambdaId == metastore.InvalidPlacement {
+			continue
+		} else if instance := p.cluster.Instance(uint64(lambdaId)); instance != nil {
 			instance.Dispatch(&types.Request{
 				Id:    types.Id{ReqId: reqId, ChunkId: strconv.Itoa(i)},
 				InsId: uint64(lambdaId),
@@ -498,7 +773,207 @@ func (p *Proxy) dropEvicted(meta *metastore.Meta) {
 			})
 		} // Or it has been expired.
 	}
-	p.log.Warn("Evict %s", meta.Key)
+}
+
+func (p *Proxy) recoverMetaStore(dir string) {
+	journal, err := metastore.OpenJournal(dir)
+	if err != nil {
+		p.log.Error("Failed to open metastore at %s: %v", dir, err)
+		return
+	}
+
+	restored, err := p.placer.Recover(journal)
+	if err != nil {
+		p.log.Error("Failed to recover metastore from %s: %v", dir, err)
+		return
+	}
+	p.log.Info("Metastore recovered from %s: %d metas restored.", dir, restored)
+	p.journal = journal
+
+	go p.scheduleSnapshot()
+}
+
+// reconcile warms up instances to collect chunks reported, and rebuilds metas after ReconcileWindow.
+func (p *Proxy) reconcile() {
+	instances := p.cluster.GetActiveInstances(0)
+	for i := 0; i < instances.Len(); i++ {
+		go instances.Instance(i).WarmUp()
+	}
+
+	select {
+	case <-p.closed:
+		return
+	case <-time.After(config.ReconcileWindow):
+	}
+
+	metas, lost := p.reconciler.Rebuild()
+	rebuilt := p.placer.Reconcile(metas)
+	close(p.reconciled)
+	p.log.Info("Reconciled with instances: %d metas rebuilt, %d objects lost.", rebuilt, lost)
+}
+
+// isReconciling returns true until metas are rebuilt. Writes are rejected during reconciling, for they may be shadowed
+// or undone by versions rebuilt.
+func (p *Proxy) isReconciling() bool {
+	if p.reconciled == nil {
+		return false
+	}
+	select {
+	case <-p.reconciled:
+		return false
+	default:
+		return true
+	}
+}
+
+func (p *Proxy) restorePersistCache() {
+	if global.Options.MetaStore == "" {
+		p.log.Warn("Metastore is disabled, chunks restored from persist cache will be discarded.")
+	}
+
+	restored, err := p.cache.Restore(p.repersist)
+	if err == types.ErrUnimplemented {
+		return
+	} else if err != nil {
+		p.log.Error("Failed to restore persist cache: %v", err)
+		return
+	}
+	p.log.Info("Persist cache restored: %d chunks restored.", restored)
+}
+
+// repersist pushes a restored chunk to its instance again, so that it will be persisted to COS.
+func (p *Proxy) repersist(chunk types.PersistChunk) {
+	key, ver, chunkId, err := metastore.ParseChunkKey(chunk.Key())
+	if err != nil {
+		p.log.Warn("Skip restoring %s: %v", chunk.Key(), err)
+		return
+	}
+
+	meta, ok := p.placer.GetByVersion(key, ver, chunkId)
+	if !ok || chunkId >= meta.NumChunks() {
+		p.log.Warn("Skip restoring %s: object not found.", chunk.Key())
+		return
+	}
+
+	lambdaId := meta.Placement[chunkId]
+	instance := p.cluster.Instance(lambdaId)
+	if instance == nil {
+		p.log.Warn("Skip restoring %s: instance %d not found.", chunk.Key(), lambdaId)
+		return
+	}
+
+	body, err := chunk.LoadAll(context.Background())
+	if err != nil {
+		p.log.Warn("Skip restoring %s: %v", chunk.Key(), err)
+		return
+	}
+
+	// Initiate a request with no response needed.
+	req := types.GetRequest(nil)
+	req.Id.ReqId = uuid.New().String()
+	req.Id.ChunkId = strconv.Itoa(chunkId)
+	req.InsId = lambdaId
+	req.Cmd = protocol.CMD_SET
+	req.Key = chunk.Key()
+	req.BodyStream = resp.NewInlineReader(body)
+	req.Checksum = meta.Checksum(chunkId)
+	req.Persistence = global.StorageClasses.Persistence(meta.Class)
+	req.Attrs = protocol.FormatObjectAttrs(meta.Attrs())
+	req.Info = meta
+	req.PersistChunk = chunk
+	// Declare persisting to keep the chunk, the instance will take over on sending the request.
+	chunk.StartPersist(req, protocol.PersistTimeout, nil)
+	if err := instance.Dispatch(req); err != nil {
+		p.log.Warn("Failed to restore %s: %v", chunk.Key(), err)
+		chunk.DonePersist()
+		return
+	}
+	p.log.Debug("Restored %s to instance %d", chunk.Key(), lambdaId)
+}
+
+func (p *Proxy) scheduleSnapshot() {
+	ticker := time.NewTicker(config.MetaStoreSnapshotInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.closed:
+			return
+		case <-ticker.C:
+			p.snapshotMetaStore()
+		}
+	}
+}
+
+// ServeReplication streams the metastore to standby proxies connected to the address, so a standby can take over
+// if the proxy is lost. The metastore must be persisted.
+func (p *Proxy) ServeReplication(addr string) error {
+	if p.journal == nil {
+		return metastore.ErrNotPersisted
+	}
+
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	p.replication = lis
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			if replicated, err := p.placer.Replicate(conn); err != nil {
+				p.log.Warn("Failed to replicate metastore to %s: %v", conn.RemoteAddr(), err)
+			} else {
+				p.log.Info("Standby %s connected: %d metas replicated.", conn.RemoteAddr(), replicated)
+			}
+		}
+	}()
+	go p.scheduleHeartbeat()
+	return nil
+}
+
+func (p *Proxy) scheduleHeartbeat() {
+	ticker := time.NewTicker(config.MetaStoreHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.closed:
+			return
+		case <-ticker.C:
+			p.journal.Heartbeat()
+		}
+	}
+}
+
+func (p *Proxy) snapshotMetaStore() {
+	if written, err := p.placer.Snapshot(); err != nil {
+		p.log.Warn("Failed to snapshot metastore: %v", err)
+	} else {
+		p.log.Debug("Metastore snapshotted: %d metas written.", written)
+	}
+}
+
+func (p *Proxy) scheduleExpiration() {
+	ticker := time.NewTicker(config.ExpirationSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.closed:
+			return
+		case now := <-ticker.C:
+			expired := p.placer.Expire(now, func(meta *metastore.Meta) {
+				p.dropChunks(meta, uuid.New().String())
+			})
+			if expired > 0 {
+				p.log.Debug("Expired %d objects.", expired)
+			}
+		}
+	}
 }
 
 func (p *Proxy) getPlacementFromRequest(req *types.Request) uint64 {
@@ -508,6 +983,7 @@ func (p *Proxy) getPlacementFromRequest(req *types.Request) uint64 {
 func (p *Proxy) relocate(req *types.Request, meta *metastore.Meta, chunk int, key string, reason string) (*lambdastore.Instance, error) {
 	instance, err := p.cluster.Relocate(meta, chunk, req.ToRecover())
 	if err == nil {
+		metrics.Relocations.Inc()
 		p.log.Debug("%s Requesting to relocate and recover %s: %d", reason, key, instance.Id())
 	}
 	return instance, err
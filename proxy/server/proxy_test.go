@@ -0,0 +1,46 @@
+package server
+
+import (
+	"bytes"
+
+	"github.com/mason-leap-lab/redeo/resp"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	protocol "github.com/sionreview/sion/common/types"
+	"github.com/sionreview/sion/proxy/server/metastore"
+)
+
+var _ = Describe("Proxy", func() {
+	It("should reject writes until reconciled", func() {
+		p := &Proxy{reconciled: make(chan struct{})}
+		Expect(p.isReconciling()).To(BeTrue())
+
+		var out bytes.Buffer
+		p.HandleDelChunk(resp.NewResponseWriter(&out), resp.NewCommand(protocol.CMD_DEL_CHUNK,
+			resp.CommandArgument("1"), resp.CommandArgument("key"), resp.CommandArgument("req")))
+		Expect(out.String()).To(Equal(":1\r\n-" + metastore.ErrReconciling.Error() + "\r\n"))
+
+		close(p.reconciled)
+		Expect(p.isReconciling()).To(BeFalse())
+		Expect((&Proxy{}).isReconciling()).To(BeFalse())
+	})
+
+	It("should get metas of objects not removed", func() {
+		p := &Proxy{store: metastore.New()}
+		meta, _, _ := p.store.GetOrInsert("key", metastore.NewMeta("req", "key", 100, 2, 1, 50))
+		meta.SetPlace(0, 1)
+		meta.SetPlace(1, 2)
+		meta.SetPlace(2, 3)
+		meta.ConfirmCreated()
+		got, ok := p.GetMeta("key")
+		Expect(ok).To(BeTrue())
+		Expect(got).To(Equal(meta))
+
+		meta.Remove()
+		_, ok = p.GetMeta("key")
+		Expect(ok).To(BeFalse())
+		_, ok = p.GetMeta("unknown")
+		Expect(ok).To(BeFalse())
+	})
+})
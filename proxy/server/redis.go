@@ -1,7 +1,11 @@
 package server
 
 import (
+	"context"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/mason-leap-lab/redeo"
@@ -15,6 +19,8 @@ import (
 	"github.com/sionreview/sion/proxy/collector"
 	"github.com/sionreview/sion/proxy/config"
 	"github.com/sionreview/sion/proxy/global"
+	"github.com/sionreview/sion/proxy/metrics"
+	"github.com/sionreview/sion/proxy/types"
 )
 
 type RedisAdapter struct {
@@ -22,14 +28,23 @@ type RedisAdapter struct {
 	proxy     *Proxy
 	d         int
 	p         int
+	maxShards int // Max shards among the default erasure coding and storage classes.
 	addresses []string
 	localAddr string
 	localIdx  int
 	log       logger.ILogger
+
+	// Redis Cluster protocol, see redis_cluster.go.
+	cluster      bool
+	clusterAddrs []string // Proxies owning hash slots in order.
+	clusterIdx   int      // Index of the local proxy in clusterAddrs.
 }
 
 var (
 	ECMaxGoroutine = 32
+
+	// DefaultScanCount is the number of keys listed per SCAN if COUNT is not specified.
+	DefaultScanCount = 10
 )
 
 func NewRedisAdapter(srv *redeo.Server, proxy *Proxy, d int, p int) *RedisAdapter {
@@ -49,12 +64,19 @@ func NewRedisAdapter(srv *redeo.Server, proxy *Proxy, d int, p int) *RedisAdapte
 		included = len(addresses)
 		addresses = append(addresses, "place holder")
 	}
+	maxShards := d + p
+	for _, class := range global.StorageClasses {
+		if class.Shards() > maxShards {
+			maxShards = class.Shards()
+		}
+	}
 
 	adapter := &RedisAdapter{
 		server:    srv,
 		proxy:     proxy,
 		d:         d,
 		p:         p,
+		maxShards: maxShards,
 		addresses: addresses,
 		localAddr: localAddr,
 		localIdx:  included,
@@ -63,10 +85,23 @@ func NewRedisAdapter(srv *redeo.Server, proxy *Proxy, d int, p int) *RedisAdapte
 			Level:  global.Log.GetLevel(),
 			Color:  !global.Options.NoColor,
 		},
+		cluster: global.Options.RedisCluster,
 	}
+	adapter.clusterAddrs, adapter.clusterIdx = adapter.clusterAddresses()
 
 	srv.HandleStreamFunc(protocol.CMD_SET, adapter.handleSet)
 	srv.HandleFunc(protocol.CMD_GET, adapter.handleGet)
+	srv.HandleFunc(protocol.CMD_GETRANGE, adapter.handleGetRange)
+	srv.HandleFunc(protocol.CMD_DEL, adapter.handleDel)
+	srv.HandleFunc(protocol.CMD_PING, adapter.handlePing)
+	srv.HandleFunc(protocol.CMD_EXISTS, adapter.handleExists)
+	srv.HandleFunc(protocol.CMD_STRLEN, adapter.handleStrlen)
+	srv.HandleFunc(protocol.CMD_MGET, adapter.handleMGet)
+	srv.HandleFunc(protocol.CMD_MSET, adapter.handleMSet)
+	srv.HandleFunc(protocol.CMD_INFO, adapter.handleInfo)
+	srv.HandleFunc(protocol.CMD_SCAN, adapter.handleScan)
+	srv.HandleFunc(protocol.CMD_KEYS, adapter.handleKeys)
+	srv.HandleFunc(protocol.CMD_CLUSTER, adapter.handleCluster)
 
 	return adapter
 }
@@ -82,6 +117,19 @@ func (a *RedisAdapter) handleSet(w resp.ResponseWriter, c *resp.CommandStream) {
 		w.Flush()
 		return
 	}
+	if moved := a.checkSlot(key); moved != "" {
+		bodyReader.Close()
+		w.AppendError(moved)
+		w.Flush()
+		return
+	}
+
+	// Options follow the value, stream the value only if no option is specified.
+	if !c.More() {
+		a.streamSet(w, client, key, bodyReader)
+		return
+	}
+
 	body, err := bodyReader.ReadAll()
 	if err != nil {
 		w.AppendError(err.Error())
@@ -89,9 +137,69 @@ func (a *RedisAdapter) handleSet(w resp.ResponseWriter, c *resp.CommandStream) {
 		return
 	}
 
+	// Options: EX seconds | PX milliseconds | CLASS name
+	opts := &sion.SetOptions{}
+	for c.More() {
+		option, _ := c.NextArg().String()
+		unit := time.Second
+		switch strings.ToUpper(option) {
+		case "PX":
+			unit = time.Millisecond
+			fallthrough
+		case "EX":
+			if !c.More() {
+				w.AppendError("ERR syntax error")
+				w.Flush()
+				return
+			}
+			expire, err := c.NextArg().Int()
+			if err != nil || expire <= 0 {
+				w.AppendError("ERR invalid expire time in 'set' command")
+				w.Flush()
+				return
+			}
+			opts.TTL = time.Duration(expire) * unit
+		case "CLASS":
+			if !c.More() {
+				w.AppendError("ERR syntax error")
+				w.Flush()
+				return
+			}
+			name, _ := c.NextArg().String()
+			if _, ok := global.StorageClasses[name]; !ok {
+				w.AppendError("ERR unknown storage class '" + name + "'")
+				w.Flush()
+				return
+			}
+			opts.Class = name
+		default:
+			w.AppendError("ERR syntax error")
+			w.Flush()
+			return
+		}
+	}
+
+	t := time.Now()
+	_, _, err = client.EcSetContext(context.Background(), key, body, opts)
+	dt := time.Since(t)
+	if err != nil {
+		w.AppendError(err.Error())
+		w.Flush()
+	} else {
+		w.AppendInlineString("OK")
+		w.Flush()
+	}
+	collectEndToEnd(protocol.CMD_SET, util.Ifelse(err == nil, "200", "500").(string), int64(len(body)), t, dt)
+}
+
+func (a *RedisAdapter) streamSet(w resp.ResponseWriter, client *sion.Client, key string, bodyReader resp.AllReadCloser) {
+	size := bodyReader.Len()
+
 	t := time.Now()
-	_, err = client.EcSet(key, body)
+	_, _, err := client.EcSetStream(key, bodyReader, int64(size))
 	dt := time.Since(t)
+	// Drain the value left on error.
+	bodyReader.Close()
 	if err != nil {
 		w.AppendError(err.Error())
 		w.Flush()
@@ -99,14 +207,18 @@ func (a *RedisAdapter) handleSet(w resp.ResponseWriter, c *resp.CommandStream) {
 		w.AppendInlineString("OK")
 		w.Flush()
 	}
-	collector.Collect(collector.LogEndtoEnd, protocol.CMD_SET, util.Ifelse(err == nil, "200", "500"),
-		int64(len(body)), t.UnixNano(), int64(dt))
+	collectEndToEnd(protocol.CMD_SET, util.Ifelse(err == nil, "200", "500").(string), int64(size), t, dt)
 }
 
 func (a *RedisAdapter) handleGet(w resp.ResponseWriter, c *resp.Command) {
 	client := a.getClient(redeo.GetClient(c.Context()))
 
 	key := c.Arg(0).String()
+	if moved := a.checkSlot(key); moved != "" {
+		w.AppendError(moved)
+		w.Flush()
+		return
+	}
 
 	t := time.Now()
 	_, reader, err := client.EcGet(key)
@@ -128,11 +240,505 @@ func (a *RedisAdapter) handleGet(w resp.ResponseWriter, c *resp.Command) {
 		reader.Close()
 		code = "200"
 	}
-	collector.Collect(collector.LogEndtoEnd, protocol.CMD_GET, code, int64(size), t.UnixNano(), int64(dt))
+	collectEndToEnd(protocol.CMD_GET, code, int64(size), t, dt)
+}
+
+// handleGetRange reads the substring from start to end inclusively. Negative offsets count from the end of the object,
+// which requires the size of the object to be known first.
+func (a *RedisAdapter) handleGetRange(w resp.ResponseWriter, c *resp.Command) {
+	client := a.getClient(redeo.GetClient(c.Context()))
+
+	if c.ArgN() != 3 {
+		w.AppendError("ERR wrong number of arguments for 'getrange' command")
+		w.Flush()
+		return
+	}
+	key := c.Arg(0).String()
+	if moved := a.checkSlot(key); moved != "" {
+		w.AppendError(moved)
+		w.Flush()
+		return
+	}
+	start, err := c.Arg(1).Int()
+	if err != nil {
+		w.AppendError("ERR value is not an integer or out of range")
+		w.Flush()
+		return
+	}
+	end, err := c.Arg(2).Int()
+	if err != nil {
+		w.AppendError("ERR value is not an integer or out of range")
+		w.Flush()
+		return
+	}
+
+	t := time.Now()
+	if start < 0 || end < 0 {
+		size, err := a.stat(client, key)
+		if err != nil && err != sion.ErrNotFound {
+			w.AppendError(err.Error())
+			w.Flush()
+			return
+		}
+		if start < 0 {
+			start += size
+		}
+		if end < 0 {
+			end += size
+		}
+		if start < 0 {
+			start = 0
+		}
+	}
+	if end < start {
+		w.AppendBulkString("")
+		w.Flush()
+		return
+	}
+
+	_, reader, err := client.EcGetRange(key, start, end-start+1)
+	dt := time.Since(t)
+	code := "500"
+	size := 0
+	if err == sion.ErrNotFound {
+		// Missing keys are treated as empty strings.
+		w.AppendBulkString("")
+		w.Flush()
+		code = "404"
+	} else if err != nil {
+		w.AppendError(err.Error())
+		w.Flush()
+	} else {
+		size = reader.Len()
+		if err := w.CopyBulk(reader, int64(size)); err != nil {
+			a.log.Warn("Error on sending range of %s: %v", key, err)
+		}
+		reader.Close()
+		code = "200"
+	}
+	collectEndToEnd(protocol.CMD_GETRANGE, code, int64(size), t, dt)
+}
+
+func (a *RedisAdapter) handleDel(w resp.ResponseWriter, c *resp.Command) {
+	client := a.getClient(redeo.GetClient(c.Context()))
+
+	if c.ArgN() == 0 {
+		w.AppendError("ERR wrong number of arguments for 'del' command")
+		w.Flush()
+		return
+	}
+	if moved := a.checkSlot(argStrings(c.Args)...); moved != "" {
+		w.AppendError(moved)
+		w.Flush()
+		return
+	}
+
+	deleted := 0
+	for _, arg := range c.Args {
+		key := arg.String()
+
+		t := time.Now()
+		_, err := client.EcDel(key)
+		dt := time.Since(t)
+		code := "200"
+		if err == nil {
+			deleted++
+		} else if err == sion.ErrNotFound {
+			code = "404"
+		} else {
+			w.AppendError(err.Error())
+			w.Flush()
+			collectEndToEnd(protocol.CMD_DEL, "500", int64(0), t, dt)
+			return
+		}
+		collectEndToEnd(protocol.CMD_DEL, code, int64(0), t, dt)
+	}
+	w.AppendInt(int64(deleted))
+	w.Flush()
+}
+
+func (a *RedisAdapter) handlePing(w resp.ResponseWriter, c *resp.Command) {
+	switch c.ArgN() {
+	case 0:
+		w.AppendInlineString("PONG")
+	case 1:
+		w.AppendBulk(c.Arg(0))
+	default:
+		w.AppendError("ERR wrong number of arguments for 'ping' command")
+	}
+	w.Flush()
+}
+
+func (a *RedisAdapter) handleExists(w resp.ResponseWriter, c *resp.Command) {
+	client := a.getClient(redeo.GetClient(c.Context()))
+
+	if c.ArgN() == 0 {
+		w.AppendError("ERR wrong number of arguments for 'exists' command")
+		w.Flush()
+		return
+	}
+	if moved := a.checkSlot(argStrings(c.Args)...); moved != "" {
+		w.AppendError(moved)
+		w.Flush()
+		return
+	}
+
+	// Duplicated keys are counted multiple times as Redis does.
+	existed := 0
+	for _, arg := range c.Args {
+		_, err := a.stat(client, arg.String())
+		if err == nil {
+			existed++
+		} else if err != sion.ErrNotFound {
+			w.AppendError(err.Error())
+			w.Flush()
+			return
+		}
+	}
+	w.AppendInt(int64(existed))
+	w.Flush()
+}
+
+func (a *RedisAdapter) handleStrlen(w resp.ResponseWriter, c *resp.Command) {
+	client := a.getClient(redeo.GetClient(c.Context()))
+
+	if c.ArgN() != 1 {
+		w.AppendError("ERR wrong number of arguments for 'strlen' command")
+		w.Flush()
+		return
+	}
+	if moved := a.checkSlot(c.Arg(0).String()); moved != "" {
+		w.AppendError(moved)
+		w.Flush()
+		return
+	}
+
+	size, err := a.stat(client, c.Arg(0).String())
+	if err == sion.ErrNotFound {
+		w.AppendInt(0)
+	} else if err != nil {
+		w.AppendError(err.Error())
+	} else {
+		w.AppendInt(size)
+	}
+	w.Flush()
+}
+
+func (a *RedisAdapter) handleMGet(w resp.ResponseWriter, c *resp.Command) {
+	client := a.getClient(redeo.GetClient(c.Context()))
+
+	if c.ArgN() == 0 {
+		w.AppendError("ERR wrong number of arguments for 'mget' command")
+		w.Flush()
+		return
+	}
+	if moved := a.checkSlot(argStrings(c.Args)...); moved != "" {
+		w.AppendError(moved)
+		w.Flush()
+		return
+	}
+
+	readers := make([]sion.ReadAllCloser, c.ArgN())
+	errs := make([]error, c.ArgN())
+	var wg sync.WaitGroup
+	for i, arg := range c.Args {
+		wg.Add(1)
+		go func(i int, key string) {
+			defer wg.Done()
+
+			t := time.Now()
+			_, readers[i], errs[i] = client.EcGet(key)
+			dt := time.Since(t)
+			code, size := "200", 0
+			if errs[i] == sion.ErrNotFound {
+				code = "404"
+			} else if errs[i] != nil {
+				code = "500"
+			} else {
+				size = readers[i].Len()
+			}
+			collectEndToEnd(protocol.CMD_GET, code, int64(size), t, dt)
+		}(i, arg.String())
+	}
+	wg.Wait()
+
+	// Reply error if any, nonexistent keys are replied with nil.
+	for _, err := range errs {
+		if err != nil && err != sion.ErrNotFound {
+			for _, reader := range readers {
+				if reader != nil {
+					reader.Close()
+				}
+			}
+			w.AppendError(err.Error())
+			w.Flush()
+			return
+		}
+	}
+
+	w.AppendArrayLen(len(readers))
+	for i, reader := range readers {
+		if reader == nil {
+			w.AppendNil()
+			continue
+		}
+		if err := w.CopyBulk(reader, int64(reader.Len())); err != nil {
+			a.log.Warn("Error on sending %s: %v", c.Arg(i).String(), err)
+		}
+		reader.Close()
+	}
+	w.Flush()
+}
+
+func (a *RedisAdapter) handleMSet(w resp.ResponseWriter, c *resp.Command) {
+	client := a.getClient(redeo.GetClient(c.Context()))
+
+	if c.ArgN() == 0 || c.ArgN()%2 != 0 {
+		w.AppendError("ERR wrong number of arguments for 'mset' command")
+		w.Flush()
+		return
+	}
+
+	errs := make([]error, c.ArgN()/2)
+	keys := make([]string, len(errs))
+	for i := range keys {
+		keys[i] = c.Arg(2 * i).String()
+	}
+	if moved := a.checkSlot(keys...); moved != "" {
+		w.AppendError(moved)
+		w.Flush()
+		return
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < len(errs); i++ {
+		wg.Add(1)
+		go func(i int, key string, body []byte) {
+			defer wg.Done()
+
+			t := time.Now()
+			_, _, errs[i] = client.EcSet(key, body)
+			dt := time.Since(t)
+			collectEndToEnd(protocol.CMD_SET, util.Ifelse(errs[i] == nil, "200", "500").(string), int64(len(body)), t, dt)
+		}(i, c.Arg(2*i).String(), c.Arg(2*i+1))
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			w.AppendError(err.Error())
+			w.Flush()
+			return
+		}
+	}
+	w.AppendInlineString("OK")
+	w.Flush()
+}
+
+func (a *RedisAdapter) handleInfo(w resp.ResponseWriter, c *resp.Command) {
+	section := "default"
+	if c.ArgN() > 0 {
+		section = strings.ToLower(c.Arg(0).String())
+	}
+
+	var info strings.Builder
+	if section == "default" || section == "all" || section == "server" {
+		info.WriteString("# Server\r\n")
+		fmt.Fprintf(&info, "proxy_address:%s\r\n", a.localAddr)
+		fmt.Fprintf(&info, "proxies:%d\r\n", util.Ifelse(len(a.addresses) > 0, len(a.addresses), 1))
+		fmt.Fprintf(&info, "data_shards:%d\r\n", a.d)
+		fmt.Fprintf(&info, "parity_shards:%d\r\n", a.p)
+		fmt.Fprintf(&info, "serving_requests:%d\r\n", global.ReqCoordinator.Len())
+		if a.proxy.GetPersistCache() != nil {
+			fmt.Fprintf(&info, "persist_cache_len:%d\r\n", a.proxy.PersistCacheLen())
+		}
+		info.WriteString("\r\n")
+	}
+
+	stats := a.proxy.GetStatsProvider()
+	if section == "default" || section == "all" || section == "metastore" {
+		var meta types.MetaStoreStats
+		switch cluster := stats.(type) {
+		case types.ClusterStats:
+			meta = cluster.MetaStats()
+		case types.GroupedClusterStats:
+			meta = cluster.MetaStats()
+		}
+		info.WriteString("# Metastore\r\n")
+		fmt.Fprintf(&info, "objects:%d\r\n", util.Ifelse(meta != nil, meta.Len(), 0).(int))
+		info.WriteString("\r\n")
+	}
+
+	if section == "default" || section == "all" || section == "cluster" {
+		clusters, instances, occupancy := 0, 0, 0.0
+		switch cluster := stats.(type) {
+		case types.ClusterStats:
+			clusters = 1
+			instances, occupancy = sumClusterStats(cluster)
+		case types.GroupedClusterStats:
+			iter := cluster.AllClustersStats()
+			for iter.Next() {
+				_, bucket := cluster.ClusterStatsFromIterator(iter)
+				clusters++
+				n, occ := sumClusterStats(bucket)
+				instances += n
+				occupancy += occ
+			}
+		}
+		info.WriteString("# Cluster\r\n")
+		fmt.Fprintf(&info, "cluster_enabled:%d\r\n", util.Ifelse(a.cluster, 1, 0).(int))
+		fmt.Fprintf(&info, "clusters:%d\r\n", clusters)
+		fmt.Fprintf(&info, "instances:%d\r\n", instances)
+		if instances > 0 {
+			occupancy /= float64(instances)
+		}
+		fmt.Fprintf(&info, "avg_occupancy:%.4f\r\n", occupancy)
+		info.WriteString("\r\n")
+	}
+
+	w.AppendBulkString(info.String())
+	w.Flush()
+}
+
+func (a *RedisAdapter) handleScan(w resp.ResponseWriter, c *resp.Command) {
+	client := a.getClient(redeo.GetClient(c.Context()))
+
+	if c.ArgN() == 0 || c.ArgN()%2 == 0 {
+		w.AppendError("ERR wrong number of arguments for 'scan' command")
+		w.Flush()
+		return
+	}
+	cursor, err := strconv.ParseUint(c.Arg(0).String(), 10, 64)
+	if err != nil {
+		w.AppendError("ERR invalid cursor")
+		w.Flush()
+		return
+	}
+
+	// SCAN cursor [MATCH pattern] [COUNT count]
+	match, count := "", DefaultScanCount
+	for i := 1; i < c.ArgN(); i += 2 {
+		switch strings.ToLower(c.Arg(i).String()) {
+		case "match":
+			match = c.Arg(i + 1).String()
+		case "count":
+			n, err := c.Arg(i + 1).Int()
+			if err != nil || n < 1 {
+				w.AppendError("ERR value is not an integer or out of range")
+				w.Flush()
+				return
+			}
+			count = int(n)
+		default:
+			w.AppendError("ERR syntax error")
+			w.Flush()
+			return
+		}
+	}
+
+	keys, next, err := client.Scan(cursor, match, count)
+	if err != nil {
+		w.AppendError(err.Error())
+		w.Flush()
+		return
+	}
+
+	w.AppendArrayLen(2)
+	w.AppendBulkString(strconv.FormatUint(next, 10))
+	w.AppendArrayLen(len(keys))
+	for _, key := range keys {
+		w.AppendBulkString(key)
+	}
+	w.Flush()
+}
+
+func (a *RedisAdapter) handleKeys(w resp.ResponseWriter, c *resp.Command) {
+	client := a.getClient(redeo.GetClient(c.Context()))
+
+	if c.ArgN() != 1 {
+		w.AppendError("ERR wrong number of arguments for 'keys' command")
+		w.Flush()
+		return
+	}
+
+	// KEYS lists all keys in one scan, keys listed more than once are deduplicated.
+	batch, _, err := client.Scan(0, c.Arg(0).String(), 0)
+	if err != nil {
+		w.AppendError(err.Error())
+		w.Flush()
+		return
+	}
+	keys := make([]string, 0, len(batch))
+	listed := make(map[string]struct{}, len(batch))
+	for _, key := range batch {
+		if _, ok := listed[key]; !ok {
+			listed[key] = struct{}{}
+			keys = append(keys, key)
+		}
+	}
+
+	w.AppendArrayLen(len(keys))
+	for _, key := range keys {
+		w.AppendBulkString(key)
+	}
+	w.Flush()
+}
+
+// collectEndToEnd logs the end-to-end request and observes its latency.
+func collectEndToEnd(cmd string, code string, size int64, t time.Time, dt time.Duration) {
+	collector.Collect(collector.LogEndtoEnd, cmd, code, size, t.UnixNano(), int64(dt))
+	metrics.ObserveRequest(cmd, code, dt)
+}
+
+// stat returns the size of the object, sion.ErrNotFound will be returned if the object does not exist.
+// Objects served by other proxies are not read, only the meta is requested.
+func (a *RedisAdapter) stat(client *sion.Client, key string) (int64, error) {
+	if _, local := net.Shortcut.Validate(client.Locate(key)); local {
+		meta, ok := a.proxy.GetMeta(key)
+		if !ok {
+			return 0, sion.ErrNotFound
+		}
+		return meta.OriginalSize(), nil
+	}
+
+	_, meta, err := client.EcStat(key)
+	if err != nil {
+		return 0, err
+	}
+	return meta.Size, nil
+}
+
+// argStrings returns arguments as strings.
+func argStrings(args []resp.CommandArgument) []string {
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		strs[i] = arg.String()
+	}
+	return strs
+}
+
+// sumClusterStats returns the number of instances and the sum of their occupancies.
+func sumClusterStats(cluster types.ClusterStats) (int, float64) {
+	instances, occupancy := 0, 0.0
+	iter := cluster.AllInstancesStats()
+	for iter.Next() {
+		_, ins := cluster.InstanceStatsFromIterator(iter)
+		if ins == types.InstanceStats(nil) {
+			continue
+		}
+		instances++
+		occupancy += ins.Occupancy(types.InstanceOccupancyMain)
+	}
+	return instances, occupancy
 }
 
 func (a *RedisAdapter) getClient(redeoClient *redeo.Client) *sion.Client {
-	shortcut := net.Shortcut.Prepare(a.localAddr, int(redeoClient.ID()), a.d+a.p)
+	return a.getClientOf(int(redeoClient.ID()), redeoClient.WaitClose)
+}
+
+// getClientOf returns the client bound to the id, which is closed after waitClose returns.
+func (a *RedisAdapter) getClientOf(id int, waitClose func()) *sion.Client {
+	shortcut := net.Shortcut.Prepare(a.localAddr, id, a.maxShards)
 	if shortcut.Client == nil {
 		var addresses []string
 		if len(a.addresses) == 0 {
@@ -144,6 +750,11 @@ func (a *RedisAdapter) getClient(redeoClient *redeo.Client) *sion.Client {
 		}
 
 		client := sion.NewClient(a.d, a.p, ECMaxGoroutine)
+		client.UseStorageClasses(global.StorageClasses, ECMaxGoroutine)
+		if a.cluster {
+			// Locate keys as cluster-aware clients do, so keys are served where they are redirected to.
+			client.UseHashSlots(addresses...)
+		}
 		shortcut.Client = client
 		shortcut.OnValidate = func(mock *net.MockConn) {
 			go a.server.ServeForeignClient(mock.Server, false)
@@ -152,7 +763,7 @@ func (a *RedisAdapter) getClient(redeoClient *redeo.Client) *sion.Client {
 		client.Dial(addresses)
 
 		go func() {
-			redeoClient.WaitClose()
+			waitClose()
 			client.Close()
 			shortcut.Client = nil
 			net.Shortcut.Invalidate(shortcut)
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	sysnet "net"
+	"strconv"
+	"strings"
+
+	"github.com/mason-leap-lab/redeo/resp"
+
+	protocol "github.com/sionreview/sion/common/types"
+)
+
+// Hash slots of Redis Cluster are evenly assigned to proxies in the order of the proxy list, so cluster-aware clients
+// send requests of a key to the proxy that owns the key. Every proxy should be configured with the same proxy list.
+
+// clusterAddresses returns proxies owning hash slots in order and the index of the local proxy. The local proxy owns
+// no slot and the index is -1 if it is not in the proxy list, which is refused by -redis-cluster on starting.
+func (a *RedisAdapter) clusterAddresses() ([]string, int) {
+	if len(a.addresses) == 0 {
+		return []string{a.localAddr}, 0
+	} else if a.addresses[a.localIdx] != a.localAddr {
+		// Skip the place holder.
+		return append([]string{}, a.addresses[:a.localIdx]...), -1
+	}
+	return append([]string{}, a.addresses...), a.localIdx
+}
+
+// checkSlot returns the error to reply if keys are not served by the local proxy, empty if all keys are served.
+// Keys of a request must share the same hash slot, and clients are redirected to the owner of the slot by MOVED.
+func (a *RedisAdapter) checkSlot(keys ...string) string {
+	if !a.cluster || len(keys) == 0 {
+		return ""
+	}
+
+	slot := protocol.HashSlot(keys[0])
+	for _, key := range keys[1:] {
+		if protocol.HashSlot(key) != slot {
+			return "CROSSSLOT Keys in request don't hash to the same slot"
+		}
+	}
+	owner := protocol.SlotOwner(slot, len(a.clusterAddrs))
+	if owner == a.clusterIdx {
+		return ""
+	}
+	return fmt.Sprintf("MOVED %d %s", slot, a.clusterAddrs[owner])
+}
+
+func (a *RedisAdapter) handleCluster(w resp.ResponseWriter, c *resp.Command) {
+	if !a.cluster {
+		w.AppendError("ERR This instance has cluster support disabled")
+		w.Flush()
+		return
+	}
+	if c.ArgN() == 0 {
+		w.AppendError("ERR wrong number of arguments for 'cluster' command")
+		w.Flush()
+		return
+	}
+
+	switch strings.ToUpper(c.Arg(0).String()) {
+	case "SLOTS":
+		w.AppendArrayLen(len(a.clusterAddrs))
+		for i, addr := range a.clusterAddrs {
+			first, last := protocol.SlotRange(i, len(a.clusterAddrs))
+			host, port := splitClusterAddress(addr)
+			w.AppendArrayLen(3)
+			w.AppendInt(int64(first))
+			w.AppendInt(int64(last))
+			w.AppendArrayLen(3)
+			w.AppendBulkString(host)
+			w.AppendInt(int64(port))
+			w.AppendBulkString(clusterNodeID(addr))
+		}
+	case "SHARDS":
+		// Maps are replied as flat arrays of fields and values in RESP2.
+		w.AppendArrayLen(len(a.clusterAddrs))
+		for i, addr := range a.clusterAddrs {
+			first, last := protocol.SlotRange(i, len(a.clusterAddrs))
+			host, port := splitClusterAddress(addr)
+			w.AppendArrayLen(4)
+			w.AppendBulkString("slots")
+			w.AppendArrayLen(2)
+			w.AppendInt(int64(first))
+			w.AppendInt(int64(last))
+			w.AppendBulkString("nodes")
+			w.AppendArrayLen(1)
+			w.AppendArrayLen(14)
+			w.AppendBulkString("id")
+			w.AppendBulkString(clusterNodeID(addr))
+			w.AppendBulkString("port")
+			w.AppendInt(int64(port))
+			w.AppendBulkString("ip")
+			w.AppendBulkString(host)
+			w.AppendBulkString("endpoint")
+			w.AppendBulkString(host)
+			w.AppendBulkString("role")
+			w.AppendBulkString("master")
+			w.AppendBulkString("replication-offset")
+			w.AppendInt(0)
+			w.AppendBulkString("health")
+			w.AppendBulkString("online")
+		}
+	case "NODES":
+		var nodes strings.Builder
+		for i, addr := range a.clusterAddrs {
+			first, last := protocol.SlotRange(i, len(a.clusterAddrs))
+			_, port := splitClusterAddress(addr)
+			flags := "master"
+			if i == a.clusterIdx {
+				flags = "myself,master"
+			}
+			fmt.Fprintf(&nodes, "%s %s@%d %s - 0 0 0 connected %d-%d\n", clusterNodeID(addr), addr, port, flags, first, last)
+		}
+		w.AppendBulkString(nodes.String())
+	case "INFO":
+		var info strings.Builder
+		info.WriteString("cluster_enabled:1\r\n")
+		info.WriteString("cluster_state:ok\r\n")
+		fmt.Fprintf(&info, "cluster_slots_assigned:%d\r\n", protocol.NumHashSlots)
+		fmt.Fprintf(&info, "cluster_slots_ok:%d\r\n", protocol.NumHashSlots)
+		fmt.Fprintf(&info, "cluster_known_nodes:%d\r\n", len(a.clusterAddrs))
+		fmt.Fprintf(&info, "cluster_size:%d\r\n", len(a.clusterAddrs))
+		w.AppendBulkString(info.String())
+	case "KEYSLOT":
+		if c.ArgN() != 2 {
+			w.AppendError("ERR wrong number of arguments for 'cluster|keyslot' command")
+			break
+		}
+		w.AppendInt(int64(protocol.HashSlot(c.Arg(1).String())))
+	case "MYID":
+		w.AppendBulkString(clusterNodeID(a.localAddr))
+	default:
+		w.AppendError("ERR unknown subcommand '" + c.Arg(0).String() + "'")
+	}
+	w.Flush()
+}
+
+// clusterNodeID returns the id of the proxy in the cluster, which is stable across proxies.
+func clusterNodeID(addr string) string {
+	sum := sha1.Sum([]byte(addr))
+	return hex.EncodeToString(sum[:])
+}
+
+func splitClusterAddress(addr string) (string, int) {
+	host, rawPort, err := sysnet.SplitHostPort(addr)
+	if err != nil {
+		return addr, 0
+	}
+	port, _ := strconv.Atoi(rawPort)
+	return host, port
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RedisAdapter cluster", func() {
+	newAdapter := func(cluster bool) *RedisAdapter {
+		adapter := &RedisAdapter{
+			addresses: []string{"10.0.0.2:6378", "10.0.0.1:6378"},
+			localAddr: "10.0.0.1:6378",
+			localIdx:  1,
+			cluster:   cluster,
+		}
+		adapter.clusterAddrs, adapter.clusterIdx = adapter.clusterAddresses()
+		return adapter
+	}
+
+	It("should assign slots to proxies in order", func() {
+		adapter := newAdapter(true)
+		Expect(adapter.clusterAddrs).To(Equal([]string{"10.0.0.2:6378", "10.0.0.1:6378"}))
+		Expect(adapter.clusterIdx).To(Equal(1))
+	})
+
+	It("should assign no slot to the local proxy not in the proxy list", func() {
+		adapter := &RedisAdapter{
+			addresses: []string{"10.0.0.2:6378", "place holder"},
+			localAddr: "10.0.0.1:6378",
+			localIdx:  1,
+			cluster:   true,
+		}
+		adapter.clusterAddrs, adapter.clusterIdx = adapter.clusterAddresses()
+		Expect(adapter.clusterAddrs).To(Equal([]string{"10.0.0.2:6378"}))
+		Expect(adapter.clusterIdx).To(Equal(-1))
+		Expect(adapter.checkSlot("foo")).To(Equal("MOVED 12182 10.0.0.2:6378"))
+	})
+
+	It("should redirect keys owned by other proxies", func() {
+		adapter := newAdapter(true)
+		// Slot of "foo" is 12182, "bar" is 5061.
+		Expect(adapter.checkSlot("foo")).To(Equal(""))
+		Expect(adapter.checkSlot("bar")).To(Equal("MOVED 5061 10.0.0.2:6378"))
+		Expect(adapter.checkSlot("{foo}1", "{foo}2")).To(Equal(""))
+		Expect(adapter.checkSlot("foo", "bar")).To(HavePrefix("CROSSSLOT"))
+	})
+
+	It("should serve all keys if cluster is disabled", func() {
+		adapter := newAdapter(false)
+		Expect(adapter.checkSlot("bar")).To(Equal(""))
+		Expect(adapter.checkSlot("foo", "bar")).To(Equal(""))
+	})
+})
@@ -0,0 +1,453 @@
+package server
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	sion "github.com/sionreview/sion/client"
+	"github.com/sionreview/sion/common/logger"
+	protocol "github.com/sionreview/sion/common/types"
+	"github.com/sionreview/sion/common/util"
+	"github.com/sionreview/sion/proxy/global"
+)
+
+const (
+	// S3MaxKeys is the max number of keys listed per ListObjectsV2.
+	S3MaxKeys = 1000
+
+	s3Namespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+	// s3TimeFormat is the format of timestamps in S3 responses.
+	s3TimeFormat = "2006-01-02T15:04:05.000Z"
+
+	// gatewayClientIdBase is the base of shortcut ids of clients used by the gateway. Ids of redis clients start from 1,
+	// so clients of HTTP connections are numbered from the base to avoid conflicts.
+	gatewayClientIdBase = 1 << 30
+)
+
+var (
+	errRangeUnsatisfiable = errors.New("range not satisfiable")
+
+	ctxKeyS3Client = s3CtxKey("client")
+)
+
+type s3CtxKey string
+
+// S3Gateway serves a subset of the S3 REST API on a single virtual bucket: PutObject, GetObject with Range, HeadObject,
+// DeleteObject, and ListObjectsV2. Like redis connections, each HTTP connection is served by a client of its own created
+// by the RedisAdapter, and bodies are streamed from and to the client. Requests are not authenticated, the gateway is
+// expected to be served in a trusted network.
+type S3Gateway struct {
+	adapter *RedisAdapter
+	bucket  string
+	server  *http.Server
+	conns   sync.Map // net.Conn -> chan struct{}, closed on the connection closed.
+	nextId  int32
+	done    chan struct{}
+	log     logger.ILogger
+}
+
+func NewS3Gateway(adapter *RedisAdapter, bucket string) *S3Gateway {
+	return &S3Gateway{
+		adapter: adapter,
+		bucket:  bucket,
+		done:    make(chan struct{}),
+		log: &logger.ColorLogger{
+			Prefix: "S3Gateway ",
+			Level:  global.Log.GetLevel(),
+			Color:  !global.Options.NoColor,
+		},
+	}
+}
+
+// Serve starts serving the gateway on the address in background. The proxy should be ready before serving.
+func (g *S3Gateway) Serve(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	g.server = &http.Server{Handler: g, ConnContext: g.connContext, ConnState: g.connState}
+	go g.server.Serve(lis)
+	return nil
+}
+
+// connContext binds a client to the connection, which is closed along with the connection or the gateway.
+func (g *S3Gateway) connContext(ctx context.Context, conn net.Conn) context.Context {
+	closed := make(chan struct{})
+	g.conns.Store(conn, closed)
+	id := gatewayClientIdBase + int(atomic.AddInt32(&g.nextId, 1))
+	client := g.adapter.getClientOf(id, func() {
+		select {
+		case <-closed:
+		case <-g.done:
+		}
+	})
+	return context.WithValue(ctx, ctxKeyS3Client, client)
+}
+
+func (g *S3Gateway) connState(conn net.Conn, state http.ConnState) {
+	if state != http.StateClosed && state != http.StateHijacked {
+		return
+	}
+	if closed, ok := g.conns.LoadAndDelete(conn); ok {
+		close(closed.(chan struct{}))
+	}
+}
+
+// clientOf returns the client bound to the connection of the request.
+func (g *S3Gateway) clientOf(r *http.Request) *sion.Client {
+	return r.Context().Value(ctxKeyS3Client).(*sion.Client)
+}
+
+// ServeHTTP implements the http.Handler interface. Only path-style requests are supported, e.g. "/bucket/key".
+func (g *S3Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	bucket, key := path[0], ""
+	if len(path) > 1 {
+		key = path[1]
+	}
+	if bucket != g.bucket {
+		g.writeError(w, r, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+		return
+	}
+
+	if key == "" {
+		switch {
+		case r.Method == http.MethodHead:
+			// HeadBucket
+			w.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+			g.listObjects(w, r)
+		default:
+			g.writeError(w, r, http.StatusNotImplemented, "NotImplemented", "Only ListObjectsV2 is supported on the bucket")
+		}
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		g.putObject(w, r, key)
+	case http.MethodGet:
+		g.getObject(w, r, key)
+	case http.MethodHead:
+		g.headObject(w, r, key)
+	case http.MethodDelete:
+		g.deleteObject(w, r, key)
+	default:
+		g.writeError(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed")
+	}
+}
+
+func (g *S3Gateway) putObject(w http.ResponseWriter, r *http.Request, key string) {
+	if r.Header.Get("x-amz-copy-source") != "" {
+		g.writeError(w, r, http.StatusNotImplemented, "NotImplemented", "CopyObject is not supported")
+		return
+	} else if strings.HasPrefix(r.Header.Get("x-amz-content-sha256"), "STREAMING-") {
+		g.writeError(w, r, http.StatusNotImplemented, "NotImplemented", "Chunked uploads are not supported")
+		return
+	} else if r.ContentLength < 0 {
+		g.writeError(w, r, http.StatusLengthRequired, "MissingContentLength", "You must provide the Content-Length HTTP header")
+		return
+	}
+
+	// Storage classes of the proxy are specified by name, "STANDARD" for the default erasure coding.
+	opts := &sion.SetOptions{}
+	if name := r.Header.Get("x-amz-storage-class"); name != "" && name != "STANDARD" {
+		if _, ok := global.StorageClasses[name]; !ok {
+			g.writeError(w, r, http.StatusBadRequest, "InvalidStorageClass", "The storage class you specified is not valid")
+			return
+		}
+		opts.Class = name
+	}
+
+	hash := md5.New()
+	t := time.Now()
+	_, _, err := g.clientOf(r).EcSetStreamContext(r.Context(), key, io.TeeReader(r.Body, hash), r.ContentLength, opts)
+	dt := time.Since(t)
+	if err != nil {
+		g.log.Warn("Failed to put %s: %v", key, err)
+		g.writeError(w, r, http.StatusInternalServerError, "InternalError", err.Error())
+	} else {
+		w.Header().Set("ETag", fmt.Sprintf("\"%s\"", hex.EncodeToString(hash.Sum(nil))))
+		w.WriteHeader(http.StatusOK)
+	}
+	collectEndToEnd(protocol.CMD_SET, util.Ifelse(err == nil, "200", "500").(string), r.ContentLength, t, dt)
+}
+
+func (g *S3Gateway) getObject(w http.ResponseWriter, r *http.Request, key string) {
+	client := g.clientOf(r)
+	rangeSpec := r.Header.Get("Range")
+	if rangeSpec == "" {
+		t := time.Now()
+		_, reader, err := client.EcGet(key)
+		dt := time.Since(t)
+		if err != nil {
+			code := g.writeClientError(w, r, err)
+			collectEndToEnd(protocol.CMD_GET, strconv.Itoa(code), 0, t, dt)
+			return
+		}
+		size := reader.Len()
+		g.copyObject(w, key, reader, http.StatusOK)
+		collectEndToEnd(protocol.CMD_GET, "200", int64(size), t, dt)
+		return
+	}
+
+	// The size of the object is required to resolve the range and reply Content-Range.
+	t := time.Now()
+	total, err := g.adapter.stat(client, key)
+	if err != nil {
+		g.writeClientError(w, r, err)
+		return
+	}
+	status := http.StatusPartialContent
+	start, length, err := parseRange(rangeSpec, total)
+	if err == errRangeUnsatisfiable {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", total))
+		g.writeError(w, r, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "The requested range is not satisfiable")
+		return
+	} else if err != nil {
+		// Invalid ranges are ignored as RFC 7233 specifies.
+		status, start, length = http.StatusOK, 0, total
+	}
+
+	_, reader, err := client.EcGetRange(key, start, length)
+	dt := time.Since(t)
+	if err != nil {
+		code := g.writeClientError(w, r, err)
+		collectEndToEnd(protocol.CMD_GETRANGE, strconv.Itoa(code), 0, t, dt)
+		return
+	}
+	size := reader.Len()
+	if status == http.StatusPartialContent {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+int64(size)-1, total))
+	}
+	g.copyObject(w, key, reader, status)
+	collectEndToEnd(protocol.CMD_GETRANGE, "200", int64(size), t, dt)
+}
+
+func (g *S3Gateway) headObject(w http.ResponseWriter, r *http.Request, key string) {
+	size, err := g.adapter.stat(g.clientOf(r), key)
+	if err == sion.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (g *S3Gateway) deleteObject(w http.ResponseWriter, r *http.Request, key string) {
+	t := time.Now()
+	_, err := g.clientOf(r).EcDel(key)
+	dt := time.Since(t)
+	code := "200"
+	if err == sion.ErrNotFound {
+		// Deleting a nonexistent object succeeds as S3 does.
+		code = "404"
+	} else if err != nil {
+		g.writeError(w, r, http.StatusInternalServerError, "InternalError", err.Error())
+		collectEndToEnd(protocol.CMD_DEL, "500", 0, t, dt)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+	collectEndToEnd(protocol.CMD_DEL, code, 0, t, dt)
+}
+
+type s3ListResult struct {
+	XMLName               xml.Name   `xml:"ListBucketResult"`
+	Namespace             string     `xml:"xmlns,attr"`
+	Name                  string     `xml:"Name"`
+	Prefix                string     `xml:"Prefix"`
+	KeyCount              int        `xml:"KeyCount"`
+	MaxKeys               int        `xml:"MaxKeys"`
+	ContinuationToken     string     `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string     `xml:"NextContinuationToken,omitempty"`
+	IsTruncated           bool       `xml:"IsTruncated"`
+	Contents              []s3Object `xml:"Contents"`
+}
+
+type s3Object struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+func newS3Object(object *sion.ObjectInfo) s3Object {
+	return s3Object{
+		Key:          object.Key,
+		LastModified: object.Modified.UTC().Format(s3TimeFormat),
+		Size:         object.Size,
+		StorageClass: "STANDARD",
+	}
+}
+
+// listObjects lists a page of keys by one SCAN, so the continuation token is the cursor of the SCAN. Like the SCAN,
+// keys are listed in no particular order and a page may be empty before the listing is complete.
+func (g *S3Gateway) listObjects(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	result := &s3ListResult{
+		Namespace:         s3Namespace,
+		Name:              g.bucket,
+		Prefix:            query.Get("prefix"),
+		MaxKeys:           S3MaxKeys,
+		ContinuationToken: query.Get("continuation-token"),
+	}
+	if raw := query.Get("max-keys"); raw != "" {
+		maxKeys, err := strconv.Atoi(raw)
+		if err != nil || maxKeys < 0 {
+			g.writeError(w, r, http.StatusBadRequest, "InvalidArgument", "Invalid max-keys")
+			return
+		} else if maxKeys < S3MaxKeys {
+			result.MaxKeys = maxKeys
+		}
+	}
+	cursor := uint64(0)
+	if result.ContinuationToken != "" {
+		var err error
+		if cursor, err = strconv.ParseUint(result.ContinuationToken, 10, 64); err != nil {
+			g.writeError(w, r, http.StatusBadRequest, "InvalidArgument", "The continuation token provided is incorrect")
+			return
+		}
+	}
+
+	if result.MaxKeys > 0 {
+		match := ""
+		if result.Prefix != "" {
+			match = util.QuotePattern(result.Prefix) + "*"
+		}
+		objects, next, err := g.clientOf(r).ScanObjects(cursor, match, result.MaxKeys)
+		if err != nil {
+			g.writeError(w, r, http.StatusInternalServerError, "InternalError", err.Error())
+			return
+		}
+		sort.Slice(objects, func(i, j int) bool {
+			return objects[i].Key < objects[j].Key
+		})
+		for i := range objects {
+			if i > 0 && objects[i].Key == objects[i-1].Key {
+				continue
+			}
+			result.Contents = append(result.Contents, newS3Object(&objects[i]))
+		}
+		if next != 0 {
+			result.IsTruncated = true
+			result.NextContinuationToken = strconv.FormatUint(next, 10)
+		}
+	}
+	result.KeyCount = len(result.Contents)
+	g.writeXML(w, http.StatusOK, result)
+}
+
+func (g *S3Gateway) copyObject(w http.ResponseWriter, key string, reader sion.ReadAllCloser, status int) {
+	defer reader.Close()
+
+	w.Header().Set("Content-Length", strconv.Itoa(reader.Len()))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.WriteHeader(status)
+	if _, err := io.Copy(w, reader); err != nil {
+		g.log.Warn("Error on sending %s: %v", key, err)
+	}
+}
+
+// writeClientError replies the error returned by the client, and returns the status replied.
+func (g *S3Gateway) writeClientError(w http.ResponseWriter, r *http.Request, err error) int {
+	if err == sion.ErrNotFound {
+		g.writeError(w, r, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+		return http.StatusNotFound
+	}
+	g.writeError(w, r, http.StatusInternalServerError, "InternalError", err.Error())
+	return http.StatusInternalServerError
+}
+
+type s3Error struct {
+	XMLName  xml.Name `xml:"Error"`
+	Code     string   `xml:"Code"`
+	Message  string   `xml:"Message"`
+	Resource string   `xml:"Resource"`
+}
+
+func (g *S3Gateway) writeError(w http.ResponseWriter, r *http.Request, status int, code string, message string) {
+	g.writeXML(w, status, &s3Error{Code: code, Message: message, Resource: r.URL.Path})
+}
+
+func (g *S3Gateway) writeXML(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	io.WriteString(w, xml.Header)
+	if err := xml.NewEncoder(w).Encode(v); err != nil {
+		g.log.Warn("Error on sending response: %v", err)
+	}
+}
+
+// Close stops serving and closes clients.
+func (g *S3Gateway) Close() {
+	if g.server != nil {
+		g.server.Close()
+	}
+	select {
+	case <-g.done:
+	default:
+		close(g.done)
+	}
+}
+
+// parseRange parses the single byte range in the format "bytes=start-end", "bytes=start-", or "bytes=-suffix". Returns
+// where the range starts and the length of the range truncated to the size of the object.
+func parseRange(spec string, size int64) (int64, int64, error) {
+	if !strings.HasPrefix(spec, "bytes=") || strings.Contains(spec, ",") {
+		return 0, 0, protocol.ErrInvalidRange
+	}
+	bounds := strings.SplitN(strings.TrimSpace(spec[len("bytes="):]), "-", 2)
+	if len(bounds) < 2 || (bounds[0] == "" && bounds[1] == "") {
+		return 0, 0, protocol.ErrInvalidRange
+	}
+
+	if bounds[0] == "" {
+		suffix, err := strconv.ParseInt(bounds[1], 10, 64)
+		if err != nil || suffix < 0 {
+			return 0, 0, protocol.ErrInvalidRange
+		} else if suffix == 0 || size == 0 {
+			return 0, 0, errRangeUnsatisfiable
+		} else if suffix > size {
+			suffix = size
+		}
+		return size - suffix, suffix, nil
+	}
+
+	start, err := strconv.ParseInt(bounds[0], 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, protocol.ErrInvalidRange
+	}
+	end := size - 1
+	if bounds[1] != "" {
+		if end, err = strconv.ParseInt(bounds[1], 10, 64); err != nil || end < start {
+			return 0, 0, protocol.ErrInvalidRange
+		} else if end >= size {
+			end = size - 1
+		}
+	}
+	if start >= size {
+		return 0, 0, errRangeUnsatisfiable
+	}
+	return start, end - start + 1, nil
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/mason-leap-lab/redeo"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	sion "github.com/sionreview/sion/client"
+	cnet "github.com/sionreview/sion/common/net"
+	protocol "github.com/sionreview/sion/common/types"
+)
+
+var _ = Describe("S3Gateway", func() {
+	It("should parse ranges", func() {
+		start, length, err := parseRange("bytes=10-19", 100)
+		Expect(err).To(BeNil())
+		Expect([]int64{start, length}).To(Equal([]int64{10, 10}))
+
+		start, length, err = parseRange("bytes=90-", 100)
+		Expect(err).To(BeNil())
+		Expect([]int64{start, length}).To(Equal([]int64{90, 10}))
+
+		start, length, err = parseRange("bytes=-30", 100)
+		Expect(err).To(BeNil())
+		Expect([]int64{start, length}).To(Equal([]int64{70, 30}))
+
+		// Ranges beyond the object are truncated.
+		start, length, err = parseRange("bytes=90-199", 100)
+		Expect(err).To(BeNil())
+		Expect([]int64{start, length}).To(Equal([]int64{90, 10}))
+		start, length, err = parseRange("bytes=-200", 100)
+		Expect(err).To(BeNil())
+		Expect([]int64{start, length}).To(Equal([]int64{0, 100}))
+	})
+
+	It("should reject invalid or unsatisfiable ranges", func() {
+		for _, spec := range []string{"10-19", "bytes=", "bytes=-", "bytes=a-b", "bytes=20-10", "bytes=0-1,5-6"} {
+			_, _, err := parseRange(spec, 100)
+			Expect(err).To(Equal(protocol.ErrInvalidRange), spec)
+		}
+
+		_, _, err := parseRange("bytes=100-", 100)
+		Expect(err).To(Equal(errRangeUnsatisfiable))
+		_, _, err = parseRange("bytes=-0", 100)
+		Expect(err).To(Equal(errRangeUnsatisfiable))
+		_, _, err = parseRange("bytes=0-", 0)
+		Expect(err).To(Equal(errRangeUnsatisfiable))
+	})
+
+	It("should list objects with sizes and modified times", func() {
+		object := newS3Object(&sion.ObjectInfo{Key: "key", Size: 100, Modified: time.Unix(1700000000, 0)})
+		raw, err := xml.Marshal(object)
+		Expect(err).To(BeNil())
+		Expect(string(raw)).To(Equal("<s3Object><Key>key</Key><LastModified>2023-11-14T22:13:20.000Z</LastModified>" +
+			"<Size>100</Size><StorageClass>STANDARD</StorageClass></s3Object>"))
+	})
+
+	It("should serve each connection with a client of its own", func() {
+		cnet.InitShortcut()
+		adapter := &RedisAdapter{server: redeo.NewServer(nil), d: 2, p: 1, maxShards: 3, localAddr: "10.0.0.1:6378"}
+		gateway := NewS3Gateway(adapter, "sion")
+		defer gateway.Close()
+
+		conn1, peer1 := net.Pipe()
+		defer peer1.Close()
+		conn2, peer2 := net.Pipe()
+		defer peer2.Close()
+		client1 := gateway.connContext(context.Background(), conn1).Value(ctxKeyS3Client)
+		client2 := gateway.connContext(context.Background(), conn2).Value(ctxKeyS3Client)
+		Expect(client1).NotTo(BeNil())
+		Expect(client2).NotTo(BeIdenticalTo(client1))
+
+		// The client is closed along with the connection.
+		shortcut := func(i int) bool {
+			_, ok := cnet.Shortcut.GetConn(fmt.Sprintf("shortcut:%d:%s", gatewayClientIdBase+i, adapter.localAddr))
+			return ok
+		}
+		Expect(shortcut(1)).To(BeTrue())
+		gateway.connState(conn1, http.StateActive)
+		gateway.connState(conn1, http.StateClosed)
+		Eventually(func() bool { return shortcut(1) }).Should(BeFalse())
+		Expect(shortcut(2)).To(BeTrue())
+	})
+})
@@ -48,8 +48,10 @@ type PersistCache interface {
 	// Get will return a existed PersistChunk, nil if not found.
 	Get(key string) PersistChunk
 
-	// Restore restores the cache from local storage.
-	Restore() error
+	// Restore restores chunks not yet persisted from local storage and returns the number of chunks restored.
+	// Each restored chunk is passed to the callback, in which StartPersist should be called to persist it again,
+	// or the chunk will be discarded.
+	Restore(restored func(PersistChunk)) (int, error)
 
 	// Report outputs the cache status.
 	Report()
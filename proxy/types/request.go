@@ -82,6 +82,9 @@ type Request struct {
 	BodySize       int64
 	Body           []byte
 	BodyStream     resp.AllReadCloser
+	Checksum       uint64                     // Checksum of the chunk, 0 if unknown.
+	Persistence    protocol.PersistencePolicy // Persistence policy of the storage class, for SET only.
+	Attrs          string                     // Attributes of the object stored along with the chunk, for SET, GET, and RECOVER.
 	Info           interface{}
 	Changes        int
 	CollectorEntry interface{}
@@ -202,17 +205,23 @@ func (req *Request) ToSetRetrial(stream resp.AllReadCloser) *Request {
 	retrial.InsId = req.InsId
 	retrial.Cmd = req.Cmd
 	retrial.BodyStream = stream
+	retrial.Checksum = req.Checksum
+	retrial.Persistence = req.Persistence
+	retrial.Attrs = req.Attrs
 	retrial.Info = req.Info
 	retrial.PersistChunk = req.PersistChunk
 	return retrial
 }
 
 func (req *Request) PrepareForSet(conn Conn) {
-	conn.Writer().WriteMultiBulkSize(5)
+	conn.Writer().WriteMultiBulkSize(8)
 	conn.Writer().WriteBulkString(req.Cmd)
 	conn.Writer().WriteBulkString(req.Id.ReqId)
 	conn.Writer().WriteBulkString(req.Id.ChunkId)
 	conn.Writer().WriteBulkString(req.Key)
+	conn.Writer().WriteBulkString(strconv.FormatUint(req.Checksum, 10))
+	conn.Writer().WriteBulkString(strconv.Itoa(int(req.Persistence)))
+	conn.Writer().WriteBulkString(req.Attrs)
 	req.conn = conn
 }
 
@@ -226,13 +235,15 @@ func (req *Request) ToConcurrentSetResponse(placement uint64) *Response {
 }
 
 func (req *Request) PrepareForGet(conn Conn) {
-	conn.Writer().WriteMultiBulkSize(6)
+	conn.Writer().WriteMultiBulkSize(8)
 	conn.Writer().WriteBulkString(req.Cmd)
 	conn.Writer().WriteBulkString(req.Id.ReqId)
 	conn.Writer().WriteBulkString(req.Id.ChunkId)
 	conn.Writer().WriteBulkString(req.Key)
 	conn.Writer().WriteBulkString(strconv.FormatInt(req.BodySize, 10))
 	conn.Writer().WriteBulkString(strconv.FormatInt(req.Option, 10))
+	conn.Writer().WriteBulkString(strconv.FormatUint(req.Checksum, 10))
+	conn.Writer().WriteBulkString(req.Attrs)
 	req.conn = conn
 	req.responseTimeout = protocol.GetBodyTimeout(req.BodySize)
 }
@@ -283,13 +294,15 @@ func (req *Request) ToRecover() *Request {
 }
 
 func (req *Request) PrepareForRecover(conn Conn) {
-	conn.Writer().WriteMultiBulkSize(6)
+	conn.Writer().WriteMultiBulkSize(8)
 	conn.Writer().WriteBulkString(req.Cmd)
 	conn.Writer().WriteBulkString(req.Id.ReqId)
 	conn.Writer().WriteBulkString(req.Id.ChunkId)
 	conn.Writer().WriteBulkString(req.Key)
 	conn.Writer().WriteBulkString(req.RetCommand)
 	conn.Writer().WriteBulkString(strconv.FormatInt(req.BodySize, 10))
+	conn.Writer().WriteBulkString(strconv.FormatUint(req.Checksum, 10))
+	conn.Writer().WriteBulkString(req.Attrs)
 	req.conn = conn
 	req.responseTimeout = protocol.GetBodyTimeout(req.BodySize) // Consider the time to download and cache the object
 	if req.RetCommand == protocol.CMD_GET {
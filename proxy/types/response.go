@@ -41,13 +41,18 @@ type Response struct {
 	util.Closer
 	protocol.Contextable
 
-	Id         Id
-	Cmd        string
-	Size       string
-	Body       []byte
-	bodyStream resp.AllReadCloser
-	stream     resp.AllReadCloser // A copy of bodyStream, used for draining even after the response has been abandoned.
-	Status     int64              // Customized status. For GET: 1 - recovered
+	Id          Id
+	Cmd         string
+	Size        string
+	Version     string
+	Checksum    string
+	Shards      string // Layout of the object in the format "d-p", or "rN" if replicated, for GET only.
+	Codec       string // How the object is compressed in the format "name:size", empty if not compressed, for GET only.
+	ClientFlags string // Opaque flags of the object set by the client, for GET only.
+	Body        []byte
+	bodyStream  resp.AllReadCloser
+	stream      resp.AllReadCloser // A copy of bodyStream, used for draining even after the response has been abandoned.
+	Status      int64              // Customized status. For GET: 1 - recovered
 
 	request   *Request
 	finalizer ResponseFinalizer
@@ -96,6 +101,7 @@ func (rsp *Response) PrepareForSet(w resp.ResponseWriter, seq int64) {
 	w.AppendBulkString(rsp.Id.ReqId)
 	w.AppendBulkString(rsp.Id.ChunkId)
 	w.AppendBulk(rsp.Body)
+	w.AppendBulkString(rsp.Version)
 	rsp.w = w
 }
 
@@ -107,6 +113,11 @@ func (rsp *Response) PrepareForGet(w resp.ResponseWriter, seq int64) {
 	w.AppendInt(seq)
 	w.AppendBulkString(rsp.Id.ReqId)
 	w.AppendBulkString(rsp.Size)
+	w.AppendBulkString(rsp.Version)
+	w.AppendBulkString(rsp.Checksum)
+	w.AppendBulkString(rsp.Shards)
+	w.AppendBulkString(rsp.Codec)
+	w.AppendBulkString(rsp.ClientFlags)
 	if rsp.Body == nil && rsp.bodyStream == nil {
 		w.AppendBulkString("-1")
 	} else if rsp.getCtxError() != nil { // Here is a good place to test the ctxCancellation again if the rsp was ctxCancelled before the client is available.
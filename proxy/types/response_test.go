@@ -40,6 +40,11 @@ func readHeader(reader resp.ResponseReader) (chunk string) {
 	reader.ReadInt()        // seq
 	reader.ReadBulkString() // reqId
 	reader.ReadBulkString() // size
+	reader.ReadBulkString() // version
+	reader.ReadBulkString() // checksum
+	reader.ReadBulkString() // shards
+	reader.ReadBulkString() // codec
+	reader.ReadBulkString() // flags
 	chunk, _ = reader.ReadBulkString()
 	return
 }